@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"log"
-	"time"
 
 	"github.com/krasish/payment-system/internal/csv"
 
@@ -13,8 +12,12 @@ import (
 
 	"github.com/krasish/payment-system/internal/config"
 	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/events"
 	ps_http "github.com/krasish/payment-system/internal/http"
+	"github.com/krasish/payment-system/internal/jwks"
 	"github.com/krasish/payment-system/internal/models"
+	"github.com/krasish/payment-system/internal/risk"
+	"github.com/krasish/payment-system/internal/webhooks"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -46,19 +49,72 @@ func main() {
 	merchantController := controllers.NewMerchantController(merchantStore)
 
 	transactionStore := models.NewTransactionStore(db)
-	transactionController := controllers.NewTransactionController(transactionStore, merchantStore)
+	idempotencyStore := models.NewIdempotencyStore(db)
+	riskEngine, err := risk.NewEngineFromFile(cfg.RiskRulesPath, models.NewRiskStore(db))
+	if err != nil {
+		log.Fatalf("while loading risk rules: %v", err)
+	}
+	transactionController := controllers.NewTransactionController(transactionStore, merchantStore, idempotencyStore, riskEngine)
+
+	userStore := models.NewUserStore(db)
+	userController := controllers.NewUserController(userStore)
+	authController := controllers.NewAuthController(userStore, cfg.HttpConfig.RefreshTokenTTL)
+
+	apiKeyStore := models.NewAPIKeyStore(db)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyStore)
 
 	view, err := views.NewView(ViewLayout, cfg.ViewTemplatesPath)
 	if err != nil {
 		log.Fatalf("failed to create view: %v", err)
 	}
 
-	httpServer, err := ps_http.CreateHTTPServer(cfg.HttpConfig, transactionController, merchantController, view)
+	webhookStore := models.NewWebhookStore(db)
+	webhookController := controllers.NewWebhookController(webhookStore)
+	webhookDeliverer := webhooks.NewDeliverer(webhookStore, models.RetryPolicy{
+		BaseDelay:   cfg.WebhookRetryBaseDelay,
+		MaxDelay:    cfg.WebhookRetryMaxDelay,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+	}, cfg.WebhookTimeout)
+
+	disputeStore := models.NewDisputeStore(db)
+	disputeController := controllers.NewDisputeController(disputeStore, transactionStore, merchantStore, cfg.DisputeEvidenceWindow)
+
+	settlementStore := models.NewSettlementStore(db)
+	settlementController := controllers.NewSettlementController(settlementStore, merchantStore)
+
+	feePlanController := controllers.NewFeePlanController(models.NewFeePlanStore(db), merchantStore)
+	limitsController := controllers.NewLimitsController(models.NewLimitsStore(db), merchantStore)
+	customerController := controllers.NewCustomerController(models.NewCustomerStore(db), merchantStore)
+
+	jwtKeys, err := jwks.NewKeySet(cfg.HttpConfig.JwtJWKSPath, cfg.HttpConfig.JwtPublicKeysDir, cfg.HttpConfig.JwtKeyRotationOverlap)
+	if err != nil {
+		log.Fatalf("while loading JWT verification keys: %v", err)
+	}
+	jwtKeysReloader := jwtKeys.GetPeriodicJobReloader(cfg.HttpConfig.JwtKeysReloadInterval)
+	go jwtKeysReloader(ctx)
+
+	httpServer, err := ps_http.CreateHTTPServer(cfg.HttpConfig, transactionController, merchantController, userController, authController, apiKeyController, webhookController, disputeController, settlementController, feePlanController, limitsController, customerController, jwtKeys, view)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	transactionDeleter := transactionStore.GetPeriodicJobDeleter(time.Hour, cfg.DeletionJobInterval)
-	go transactionDeleter(ctx)
+	retentionPolicy, err := models.NewRetentionPolicy(cfg.TransactionRetention)
+	if err != nil {
+		log.Fatalf("while reading transaction retention: %v", err)
+	}
+	transactionArchiver := transactionStore.GetPeriodicJobArchiver(retentionPolicy, cfg.ArchivalJobInterval)
+	go transactionArchiver(ctx)
+	authorizationExpirer := transactionStore.GetPeriodicJobAuthorizationExpirer(cfg.AuthorizationTTL, cfg.AuthorizationExpiryJobInterval)
+	go authorizationExpirer(ctx)
+	disputeExpirer := disputeStore.GetPeriodicJobDisputeExpirer(cfg.DisputeExpiryJobInterval)
+	go disputeExpirer(ctx)
+	settler := settlementStore.GetPeriodicJobSettler(cfg.SettlementJobInterval)
+	go settler(ctx)
+	webhookDeliveryJob := webhookDeliverer.GetPeriodicJobDeliverer(cfg.WebhookJobInterval)
+	go webhookDeliveryJob(ctx)
+	eventPublisher, closePublisher := createEventPublisher(cfg)
+	defer closePublisher()
+	eventRelay := events.NewRelay(models.NewOutboxStore(db), eventPublisher).GetPeriodicJobRelay(cfg.EventsRelayJobInterval)
+	go eventRelay(ctx)
 
 	logrus.Infof("Running HTTP server on %s...", cfg.HttpConfig.Port)
 	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
@@ -67,6 +123,28 @@ func main() {
 
 }
 
+func createEventPublisher(cfg config.Config) (events.Publisher, func()) {
+	switch cfg.EventsPublisher {
+	case events.PublisherInProcess:
+		publisher := events.NewInProcessPublisher()
+		publisher.Subscribe(events.LogHandler)
+		return publisher, func() {}
+	case events.PublisherFile:
+		publisher, err := events.NewFilePublisher(cfg.EventsFilePath)
+		if err != nil {
+			log.Fatalf("while creating event publisher: %v", err)
+		}
+		return publisher, func() {
+			if err := publisher.Close(); err != nil {
+				logrus.Warnf("while closing events file: %v", err)
+			}
+		}
+	default:
+		log.Fatalf("unknown event publisher %q", cfg.EventsPublisher)
+		return nil, nil
+	}
+}
+
 func handleCSVImports(cfg config.Config, db *gorm.DB) {
 	if cfg.AdminsImportPath != "" {
 		userStore := models.NewUserStore(db)
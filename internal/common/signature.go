@@ -0,0 +1,18 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// ComputeSignature returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" with secret.
+// It is used both for signed requests of merchants and for webhook events sent to merchants.
+func ComputeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
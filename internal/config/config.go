@@ -10,9 +10,31 @@ type Config struct {
 	HttpConfig
 	DatabaseConfig
 	ViewTemplatesPath   string        `envconfig:"APP_VIEW_TEMPLATES_PATH"`
-	DeletionJobInterval time.Duration `envconfig:"default=3s,APP_DELETION_JOB_INTERVAL"`
-	AdminsImportPath    string        `envconfig:"APP_ADMINS_IMPORT_PATH,optional"`
-	MerchantsImportPath string        `envconfig:"APP_MERCHANTS_IMPORT_PATH,optional"`
+	ArchivalJobInterval time.Duration `envconfig:"default=1m,APP_ARCHIVAL_JOB_INTERVAL"`
+	// TransactionRetention holds how long transactions are kept before they get archived
+	TransactionRetention RetentionPeriods `envconfig:"default=*=720h;ERROR=168h,APP_TRANSACTION_RETENTION"`
+	// AuthorizationTTL is the time after which approved authorizations without a charge are reversed
+	AuthorizationTTL               time.Duration `envconfig:"default=168h,APP_AUTHORIZATION_TTL"`
+	AuthorizationExpiryJobInterval time.Duration `envconfig:"default=1m,APP_AUTHORIZATION_EXPIRY_JOB_INTERVAL"`
+	// WebhookRetryBaseDelay is the delay before retrying a failed webhook delivery, which doubles with every failed attempt up to WebhookRetryMaxDelay
+	WebhookRetryBaseDelay time.Duration `envconfig:"default=30s,APP_WEBHOOK_RETRY_BASE_DELAY"`
+	WebhookRetryMaxDelay  time.Duration `envconfig:"default=6h,APP_WEBHOOK_RETRY_MAX_DELAY"`
+	WebhookMaxAttempts    int           `envconfig:"default=10,APP_WEBHOOK_MAX_ATTEMPTS"`
+	WebhookTimeout        time.Duration `envconfig:"default=10s,APP_WEBHOOK_TIMEOUT"`
+	WebhookJobInterval    time.Duration `envconfig:"default=5s,APP_WEBHOOK_JOB_INTERVAL"`
+	// DisputeEvidenceWindow is the time merchants have to submit evidence for a dispute opened without a deadline
+	DisputeEvidenceWindow    time.Duration `envconfig:"default=168h,APP_DISPUTE_EVIDENCE_WINDOW"`
+	DisputeExpiryJobInterval time.Duration `envconfig:"default=1m,APP_DISPUTE_EXPIRY_JOB_INTERVAL"`
+	SettlementJobInterval    time.Duration `envconfig:"default=24h,APP_SETTLEMENT_JOB_INTERVAL"`
+	// EventsPublisher is where the event relay publishes outbox events to, either inprocess or file.
+	// The file publisher appends them to EventsFilePath in JSON Lines format.
+	EventsPublisher        string        `envconfig:"default=inprocess,APP_EVENTS_PUBLISHER"`
+	EventsFilePath         string        `envconfig:"default=events.jsonl,APP_EVENTS_FILE_PATH"`
+	EventsRelayJobInterval time.Duration `envconfig:"default=1s,APP_EVENTS_RELAY_JOB_INTERVAL"`
+	// RiskRulesPath is the JSON file the rules of the risk engine are configured in. Without it all transactions are approved.
+	RiskRulesPath       string `envconfig:"APP_RISK_RULES_PATH,optional"`
+	AdminsImportPath    string `envconfig:"APP_ADMINS_IMPORT_PATH,optional"`
+	MerchantsImportPath string `envconfig:"APP_MERCHANTS_IMPORT_PATH,optional"`
 }
 
 func NewConfigFromEnv() (Config, error) {
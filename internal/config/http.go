@@ -3,11 +3,40 @@ package config
 import "time"
 
 type HttpConfig struct {
-	JwtKey          string        `envconfig:"default=secretKey,APP_HTTP_JWT_KEY"`
-	TransactionPath string        `envconfig:"default=/transaction,APP_HTTP_TRANSACTION_PATH"`
-	MerchantPath    string        `envconfig:"default=/merchant,APP_HTTP_MERCHANT_PATH"`
-	UserPath        string        `envconfig:"default=/user,APP_HTTP_USER_PATH"`
-	ViewsPath       string        `envconfig:"default=/views,APP_HTTP_VIEWS_PATH"`
-	Port            string        `envconfig:"default=8080,APP_HTTP_PORT"`
-	ServerTimeout   time.Duration `envconfig:"default=110s,APP_HTTP_SERVER_TIMEOUT"`
+	// JwtKey is the secret of HS256 tokens. It has no default and is required when JwtHMACEnabled is set.
+	JwtKey string `envconfig:"APP_HTTP_JWT_KEY,optional"`
+	// JwtHMACEnabled controls whether HS256 tokens signed with JwtKey are accepted
+	JwtHMACEnabled bool `envconfig:"default=false,APP_HTTP_JWT_HMAC_ENABLED"`
+	// JwtSigningKeyPath is the path of an RSA or ECDSA private key in PEM format used to sign issued tokens
+	// instead of JwtKey. JwtSigningKeyID is put in the kid header of the tokens.
+	JwtSigningKeyPath string `envconfig:"APP_HTTP_JWT_SIGNING_KEY_PATH,optional"`
+	JwtSigningKeyID   string `envconfig:"APP_HTTP_JWT_SIGNING_KEY_ID,optional"`
+	// JwtJWKSPath and JwtPublicKeysDir are the sources of the public keys of RS256 and ES256 tokens
+	JwtJWKSPath           string        `envconfig:"APP_HTTP_JWT_JWKS_PATH,optional"`
+	JwtPublicKeysDir      string        `envconfig:"APP_HTTP_JWT_PUBLIC_KEYS_DIR,optional"`
+	JwtKeysReloadInterval time.Duration `envconfig:"default=1m,APP_HTTP_JWT_KEYS_RELOAD_INTERVAL"`
+	// JwtKeyRotationOverlap is how long keys removed from their source remain valid
+	JwtKeyRotationOverlap time.Duration `envconfig:"default=24h,APP_HTTP_JWT_KEY_ROTATION_OVERLAP"`
+	JwtIssuer             string        `envconfig:"default=payment-system,APP_HTTP_JWT_ISSUER"`
+	JwtAudience           string        `envconfig:"default=payment-system-api,APP_HTTP_JWT_AUDIENCE"`
+	AccessTokenTTL        time.Duration `envconfig:"default=15m,APP_HTTP_ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL       time.Duration `envconfig:"default=720h,APP_HTTP_REFRESH_TOKEN_TTL"`
+	AuthPath              string        `envconfig:"default=/auth,APP_HTTP_AUTH_PATH"`
+	TransactionPath       string        `envconfig:"default=/transaction,APP_HTTP_TRANSACTION_PATH"`
+	MerchantPath          string        `envconfig:"default=/merchant,APP_HTTP_MERCHANT_PATH"`
+	UserPath              string        `envconfig:"default=/user,APP_HTTP_USER_PATH"`
+	APIKeyPath            string        `envconfig:"default=/api-key,APP_HTTP_API_KEY_PATH"`
+	SigningSecretPath     string        `envconfig:"default=/signing-secret,APP_HTTP_SIGNING_SECRET_PATH"`
+	WebhookPath           string        `envconfig:"default=/webhook,APP_HTTP_WEBHOOK_PATH"`
+	DisputePath           string        `envconfig:"default=/dispute,APP_HTTP_DISPUTE_PATH"`
+	SettlementPath        string        `envconfig:"default=/settlement,APP_HTTP_SETTLEMENT_PATH"`
+	FeePlanPath           string        `envconfig:"default=/fee-plan,APP_HTTP_FEE_PLAN_PATH"`
+	ReviewPath            string        `envconfig:"default=/review,APP_HTTP_REVIEW_PATH"`
+	LimitsPath            string        `envconfig:"default=/limits,APP_HTTP_LIMITS_PATH"`
+	CustomerPath          string        `envconfig:"default=/customer,APP_HTTP_CUSTOMER_PATH"`
+	// SignatureClockSkew is the maximum difference between the timestamp of a signed request and the server's clock
+	SignatureClockSkew time.Duration `envconfig:"default=5m,APP_HTTP_SIGNATURE_CLOCK_SKEW"`
+	ViewsPath          string        `envconfig:"default=/views,APP_HTTP_VIEWS_PATH"`
+	Port               string        `envconfig:"default=8080,APP_HTTP_PORT"`
+	ServerTimeout      time.Duration `envconfig:"default=110s,APP_HTTP_SERVER_TIMEOUT"`
 }
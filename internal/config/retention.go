@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionPeriods maps transaction statuses, types or "*" (the default) to the period
+// transactions are retained for before being archived. It is read from a semicolon
+// separated list of KEY=PERIOD pairs, e.g. "*=720h;ERROR=24h;AUTHORIZE=2160h".
+type RetentionPeriods map[string]time.Duration
+
+func (r *RetentionPeriods) Unmarshal(s string) error {
+	periods := make(RetentionPeriods)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("retention period %q is not in KEY=PERIOD format", pair)
+		}
+		period, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("while parsing retention period of %q: %w", key, err)
+		}
+		periods[strings.ToUpper(strings.TrimSpace(key))] = period
+	}
+	*r = periods
+	return nil
+}
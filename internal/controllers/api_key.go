@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type APIKey struct {
+	ID         uint
+	CreatedAt  time.Time
+	Name       string
+	Prefix     string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+func (k *APIKey) fromModel(model *models.APIKey) {
+	k.ID = model.ID
+	k.CreatedAt = model.CreatedAt
+	k.Name = model.Name
+	k.Prefix = model.Prefix
+	k.LastUsedAt = model.LastUsedAt
+	k.ExpiresAt = model.ExpiresAt
+	k.RevokedAt = model.RevokedAt
+}
+
+// CreatedAPIKey is an API key together with the key itself, which is only returned on creation
+type CreatedAPIKey struct {
+	APIKey
+	Key string
+}
+
+type APIKeyController struct {
+	store *models.APIKeyStore
+}
+
+func NewAPIKeyController(store *models.APIKeyStore) *APIKeyController {
+	return &APIKeyController{store: store}
+}
+
+// CreateAPIKey creates an API key for the calling merchant. A nil expiresAt creates a key which never expires.
+func (c *APIKeyController) CreateAPIKey(ctx context.Context, name string, expiresAt *time.Time) (*CreatedAPIKey, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model, key, err := c.store.CreateAPIKey(ctx, p.Email, name, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	res := &CreatedAPIKey{Key: key}
+	res.fromModel(model)
+	return res, nil
+}
+
+// GetAPIKeys returns the API keys of the calling merchant
+func (c *APIKeyController) GetAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.store.GetAPIKeys(ctx, p.Email)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*APIKey, len(keys))
+	for i := range keys {
+		res[i] = &APIKey{}
+		res[i].fromModel(keys[i])
+	}
+	return res, nil
+}
+
+// RevokeAPIKey revokes the API key with id of the calling merchant
+func (c *APIKeyController) RevokeAPIKey(ctx context.Context, id uint) error {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return err
+	}
+	return c.store.RevokeAPIKey(ctx, p.Email, id)
+}
+
+// Authenticate returns the principal of the merchant key belongs to. Keys of inactive merchants are rejected.
+func (c *APIKeyController) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	user, err := c.store.Authenticate(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != models.StatusActive {
+		return nil, models.ErrInvalidAPIKey
+	}
+	return &Principal{Email: user.Email, Role: user.Role}, nil
+}
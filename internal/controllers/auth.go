@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// Session is the result of a successful login or refresh
+type Session struct {
+	Principal    *Principal
+	RefreshToken string
+}
+
+type AuthController struct {
+	store           *models.UserStore
+	refreshTokenTTL time.Duration
+}
+
+func NewAuthController(store *models.UserStore, refreshTokenTTL time.Duration) *AuthController {
+	return &AuthController{store: store, refreshTokenTTL: refreshTokenTTL}
+}
+
+// Login checks the password of the user with email and starts a new session for it.
+// models.ErrInvalidCredentials is returned for unknown emails, wrong passwords and inactive users alike.
+func (c *AuthController) Login(ctx context.Context, email, password string) (*Session, error) {
+	user, err := c.store.GetUserIdentityByEmail(ctx, email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		return nil, models.ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if !user.CheckPassword(password) || user.Status != models.StatusActive {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	token, err := c.store.CreateRefreshToken(ctx, user.ID, c.refreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Principal: &Principal{Email: user.Email, Role: user.Role}, RefreshToken: token}, nil
+}
+
+// Refresh exchanges refreshToken for a new session. Every refresh token can be used only once.
+func (c *AuthController) Refresh(ctx context.Context, refreshToken string) (*Session, error) {
+	user, token, err := c.store.RotateRefreshToken(ctx, refreshToken, c.refreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != models.StatusActive {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	return &Session{Principal: &Principal{Email: user.Email, Role: user.Role}, RefreshToken: token}, nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// Customer is the profile of a customer of a merchant. LifetimeSpend is the sum of its charges and chargeback
+// reversals less its refunds and chargebacks per currency and TransactionCount excludes transactions in ERROR status.
+type Customer struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UUID          string
+	MerchantEmail string
+	Email         string
+	Phone         string
+
+	LifetimeSpend    map[string]float64
+	TransactionCount int64
+	LastSeenAt       *time.Time
+}
+
+func (c *Customer) fromModel(model *models.Customer, merchantEmail string) {
+	c.CreatedAt = model.CreatedAt
+	c.UpdatedAt = model.UpdatedAt
+	c.UUID = model.ExternalID
+	c.MerchantEmail = merchantEmail
+	c.Email = model.Email
+	c.Phone = model.Phone
+	c.LifetimeSpend = model.LifetimeSpend.Float64()
+	c.TransactionCount = model.TransactionCount
+	c.LastSeenAt = model.LastSeenAt
+}
+
+type CustomerController struct {
+	store         *models.CustomerStore
+	merchantStore *models.MerchantStore
+}
+
+func NewCustomerController(store *models.CustomerStore, merchantStore *models.MerchantStore) *CustomerController {
+	return &CustomerController{store: store, merchantStore: merchantStore}
+}
+
+// GetCustomers returns the customers of the merchant with email. Only admins can get the customers of other merchants.
+func (c *CustomerController) GetCustomers(ctx context.Context, email string) ([]*Customer, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return c.getCustomers(ctx, email)
+}
+
+// GetOwnCustomers returns the customers of the calling merchant
+func (c *CustomerController) GetOwnCustomers(ctx context.Context) ([]*Customer, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.getCustomers(ctx, p.Email)
+}
+
+func (c *CustomerController) getCustomers(ctx context.Context, email string) ([]*Customer, error) {
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	customers, err := c.store.GetCustomers(ctx, merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Customer, len(customers))
+	for i := range customers {
+		res[i] = &Customer{}
+		res[i].fromModel(customers[i], merchant.Email)
+	}
+	return res, nil
+}
+
+// GetOwnCustomer returns the customer with uuid of the calling merchant
+func (c *CustomerController) GetOwnCustomer(ctx context.Context, uuid string) (*Customer, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, p.Email)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.GetCustomerByUUID(ctx, uuid, merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Customer{}
+	res.fromModel(model, merchant.Email)
+	return res, nil
+}
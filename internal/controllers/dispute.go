@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+var (
+	// ErrInvalidDispute is returned when a dispute cannot be opened with the passed data
+	ErrInvalidDispute = errors.New("invalid dispute")
+	// ErrInvalidEvidence is returned when evidence metadata is incomplete
+	ErrInvalidEvidence = errors.New("evidence must have a file name, a content type and a positive size")
+)
+
+type DisputeEvidence struct {
+	CreatedAt   time.Time
+	FileName    string
+	ContentType string
+	Size        int64
+	Description string
+}
+
+func (e *DisputeEvidence) toModel() (*models.DisputeEvidence, error) {
+	if strings.TrimSpace(e.FileName) == "" || strings.TrimSpace(e.ContentType) == "" || e.Size <= 0 {
+		return nil, ErrInvalidEvidence
+	}
+	return &models.DisputeEvidence{FileName: e.FileName, ContentType: e.ContentType, Size: e.Size, Description: e.Description}, nil
+}
+
+// Dispute is a dispute of a CHARGE. TransactionUUID, Amount, Reason and EvidenceDueBy are used to open a dispute,
+// where a zero Amount disputes the whole remaining amount and a zero EvidenceDueBy uses the default evidence window.
+type Dispute struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UUID                   string
+	TransactionUUID        string
+	ChargebackUUID         *string
+	ChargebackReversalUUID *string
+	MerchantEmail          string
+
+	Status   string
+	Reason   string
+	Amount   float64
+	Currency string
+
+	EvidenceDueBy       time.Time
+	EvidenceSubmittedAt *time.Time
+	ResolvedAt          *time.Time
+	Evidence            []DisputeEvidence
+}
+
+func (d *Dispute) fromModel(model *models.Dispute) {
+	d.CreatedAt = model.CreatedAt
+	d.UpdatedAt = model.UpdatedAt
+	d.UUID = model.ExternalID
+	d.TransactionUUID = model.Transaction.ExternalID
+	if model.Chargeback != nil {
+		d.ChargebackUUID = &model.Chargeback.ExternalID
+	}
+	if model.ChargebackReversal != nil {
+		d.ChargebackReversalUUID = &model.ChargebackReversal.ExternalID
+	}
+	d.MerchantEmail = model.Merchant.Email
+	d.Status = string(model.Status)
+	d.Reason = model.Reason
+	d.Amount = model.CurrencyCode.Float64(model.Amount)
+	d.Currency = string(model.CurrencyCode)
+	d.EvidenceDueBy = model.EvidenceDueBy
+	d.EvidenceSubmittedAt = model.EvidenceSubmittedAt
+	d.ResolvedAt = model.ResolvedAt
+	d.Evidence = make([]DisputeEvidence, len(model.Evidence))
+	for i, e := range model.Evidence {
+		d.Evidence[i] = DisputeEvidence{CreatedAt: e.CreatedAt, FileName: e.FileName, ContentType: e.ContentType, Size: e.Size, Description: e.Description}
+	}
+}
+
+func newDisputes(ds []*models.Dispute) []*Dispute {
+	res := make([]*Dispute, len(ds))
+	for i := range ds {
+		res[i] = &Dispute{}
+		res[i].fromModel(ds[i])
+	}
+	return res
+}
+
+type DisputeController struct {
+	store            *models.DisputeStore
+	transactionStore *models.TransactionStore
+	merchantStore    *models.MerchantStore
+	// evidenceWindow is the time merchants have to submit evidence when no deadline is passed
+	evidenceWindow time.Duration
+}
+
+func NewDisputeController(store *models.DisputeStore, transactionStore *models.TransactionStore, merchantStore *models.MerchantStore, evidenceWindow time.Duration) *DisputeController {
+	return &DisputeController{store: store, transactionStore: transactionStore, merchantStore: merchantStore, evidenceWindow: evidenceWindow}
+}
+
+// OpenDispute opens a dispute against the CHARGE with d.TransactionUUID on behalf of the cardholder. Only admins can open disputes.
+func (c *DisputeController) OpenDispute(ctx context.Context, d *Dispute) (*Dispute, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if d.Amount < 0 {
+		return nil, fmt.Errorf("%w: amount cannot be negative", ErrInvalidDispute)
+	}
+	charge, err := c.transactionStore.GetTransactionByUUID(ctx, d.TransactionUUID)
+	if err != nil {
+		return nil, models.ErrTransactionNotFound
+	}
+	if d.Currency != "" && !strings.EqualFold(d.Currency, string(charge.CurrencyCode)) {
+		return nil, fmt.Errorf("while opening dispute in %s for transaction in %s: %w", d.Currency, charge.CurrencyCode, models.ErrCurrencyMismatch)
+	}
+	dueBy := d.EvidenceDueBy
+	if dueBy.IsZero() {
+		dueBy = time.Now().Add(c.evidenceWindow)
+	} else if dueBy.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: evidence deadline must be in the future", ErrInvalidDispute)
+	}
+	model, err := c.store.OpenDispute(ctx, charge.ExternalID, charge.CurrencyCode.ToCurrency(d.Amount), d.Reason, dueBy)
+	if err != nil {
+		return nil, err
+	}
+	model.Merchant = charge.Merchant
+	res := &Dispute{}
+	res.fromModel(model)
+	return res, nil
+}
+
+// merchantScope returns the ID of the merchant whose disputes the principal in ctx can access or nil for admins
+func (c *DisputeController) merchantScope(ctx context.Context) (*uint, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if principal.IsAdmin() {
+		return nil, nil
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, principal.Email)
+	if err != nil {
+		return nil, fmt.Errorf("while getting merchant of disputes: %w", err)
+	}
+	return &merchant.UserID, nil
+}
+
+// GetDisputes returns the disputes visible to the principal in ctx.
+// Merchants only see their own disputes, while admins see the disputes of all merchants.
+func (c *DisputeController) GetDisputes(ctx context.Context) ([]*Dispute, error) {
+	merchantID, err := c.merchantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	disputes, err := c.store.GetDisputes(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return newDisputes(disputes), nil
+}
+
+// GetDispute returns the dispute with uuid if it is visible to the principal in ctx
+func (c *DisputeController) GetDispute(ctx context.Context, uuid string) (*Dispute, error) {
+	merchantID, err := c.merchantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.GetDisputeByUUID(ctx, uuid, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Dispute{}
+	res.fromModel(model)
+	return res, nil
+}
+
+// AddEvidence attaches the metadata of an evidence document to the dispute with uuid of the calling merchant
+func (c *DisputeController) AddEvidence(ctx context.Context, uuid string, e *DisputeEvidence) (*Dispute, error) {
+	merchantID, err := c.callingMerchantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	evidence, err := e.toModel()
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.AddEvidence(ctx, uuid, merchantID, evidence)
+	if err != nil {
+		return nil, err
+	}
+	res := &Dispute{}
+	res.fromModel(model)
+	return res, nil
+}
+
+// SubmitEvidence submits the evidence of the dispute with uuid of the calling merchant for review
+func (c *DisputeController) SubmitEvidence(ctx context.Context, uuid string) (*Dispute, error) {
+	merchantID, err := c.callingMerchantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.SubmitEvidence(ctx, uuid, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Dispute{}
+	res.fromModel(model)
+	return res, nil
+}
+
+// ResolveDispute closes the dispute with uuid as either WON or LOST by the merchant. Only admins can resolve disputes.
+func (c *DisputeController) ResolveDispute(ctx context.Context, uuid, outcome string) (*Dispute, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	status, err := models.NewDisputeStatus(strings.ToUpper(outcome))
+	if err != nil {
+		return nil, models.ErrInvalidDisputeOutcome
+	}
+	model, err := c.store.ResolveDispute(ctx, uuid, status)
+	if err != nil {
+		return nil, err
+	}
+	res := &Dispute{}
+	res.fromModel(model)
+	return res, nil
+}
+
+func (c *DisputeController) callingMerchantID(ctx context.Context) (uint, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, p.Email)
+	if err != nil {
+		return 0, fmt.Errorf("while getting merchant of dispute: %w", err)
+	}
+	return merchant.UserID, nil
+}
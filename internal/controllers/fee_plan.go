@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// FeeRate is a Percentage of the transaction amount, e.g. 2.9, plus a FixedAmount, raised to MinimumAmount if lower.
+// FixedAmount and MinimumAmount are in the currency of the fee plan.
+type FeeRate struct {
+	Percentage    float64
+	FixedAmount   float64
+	MinimumAmount float64
+}
+
+func (r *FeeRate) toModel(currencyCode models.CurrencyCode) (models.FeeRate, error) {
+	if r.Percentage < 0 || r.FixedAmount < 0 || r.MinimumAmount < 0 {
+		return models.FeeRate{}, fmt.Errorf("%w: fees cannot be negative", models.ErrInvalidFeePlan)
+	}
+	return models.FeeRate{
+		BasisPoints:   uint(math.Round(r.Percentage * 100)),
+		FixedAmount:   currencyCode.ToCurrency(r.FixedAmount),
+		MinimumAmount: currencyCode.ToCurrency(r.MinimumAmount),
+	}, nil
+}
+
+func (r *FeeRate) fromModel(model models.FeeRate, currencyCode models.CurrencyCode) {
+	r.Percentage = float64(model.BasisPoints) / 100
+	r.FixedAmount = currencyCode.Float64(model.FixedAmount)
+	r.MinimumAmount = currencyCode.Float64(model.MinimumAmount)
+}
+
+// FeePlan is the pricing of a merchant. Overrides replace the rate for CHARGE or REFUND transactions and
+// RefundPolicy is one of NONE (default), RETURN_PROPORTIONAL or CHARGE.
+type FeePlan struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	MerchantEmail string
+	Currency      string
+	FeeRate
+	RefundPolicy string
+	Overrides    map[string]FeeRate
+}
+
+func (p *FeePlan) toModel(merchantID uint) (*models.FeePlan, error) {
+	currencyCode := models.DefaultCurrencyCode
+	if p.Currency != "" {
+		var err error
+		if currencyCode, err = models.NewCurrencyCode(p.Currency); err != nil {
+			return nil, fmt.Errorf("%w: %v", models.ErrInvalidFeePlan, err)
+		}
+	}
+	rate, err := p.FeeRate.toModel(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+	refundPolicy := models.RefundFeeNone
+	if p.RefundPolicy != "" {
+		if refundPolicy, err = models.NewRefundFeePolicy(strings.ToUpper(p.RefundPolicy)); err != nil {
+			return nil, fmt.Errorf("%w: %v", models.ErrInvalidFeePlan, err)
+		}
+	}
+	overrides := make([]models.FeePlanOverride, 0, len(p.Overrides))
+	for t, r := range p.Overrides {
+		_type, err := models.NewTransactionType(strings.ToUpper(t))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", models.ErrInvalidFeePlan, err)
+		}
+		overrideRate, err := r.toModel(currencyCode)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, models.FeePlanOverride{Type: _type, FeeRate: overrideRate})
+	}
+	return models.NewFeePlan(merchantID, currencyCode, rate, refundPolicy, overrides)
+}
+
+func (p *FeePlan) fromModel(model *models.FeePlan, merchantEmail string) {
+	p.CreatedAt = model.CreatedAt
+	p.UpdatedAt = model.UpdatedAt
+	p.MerchantEmail = merchantEmail
+	p.Currency = string(model.CurrencyCode)
+	p.FeeRate.fromModel(model.FeeRate, model.CurrencyCode)
+	p.RefundPolicy = string(model.RefundPolicy)
+	p.Overrides = make(map[string]FeeRate, len(model.Overrides))
+	for _, o := range model.Overrides {
+		r := FeeRate{}
+		r.fromModel(o.FeeRate, model.CurrencyCode)
+		p.Overrides[string(o.Type)] = r
+	}
+}
+
+type FeePlanController struct {
+	store         *models.FeePlanStore
+	merchantStore *models.MerchantStore
+}
+
+func NewFeePlanController(store *models.FeePlanStore, merchantStore *models.MerchantStore) *FeePlanController {
+	return &FeePlanController{store: store, merchantStore: merchantStore}
+}
+
+// GetFeePlan returns the fee plan of the merchant with email. Only admins can get the fee plans of other merchants.
+func (c *FeePlanController) GetFeePlan(ctx context.Context, email string) (*FeePlan, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return c.getFeePlan(ctx, email)
+}
+
+// GetOwnFeePlan returns the fee plan of the calling merchant
+func (c *FeePlanController) GetOwnFeePlan(ctx context.Context) (*FeePlan, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.getFeePlan(ctx, p.Email)
+}
+
+func (c *FeePlanController) getFeePlan(ctx context.Context, email string) (*FeePlan, error) {
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.GetFeePlan(ctx, merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := &FeePlan{}
+	res.fromModel(model, merchant.Email)
+	return res, nil
+}
+
+// SetFeePlan replaces the fee plan of the merchant with email. Only admins can set fee plans.
+func (c *FeePlanController) SetFeePlan(ctx context.Context, email string, p *FeePlan) (*FeePlan, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	model, err := p.toModel(merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.store.SetFeePlan(ctx, model); err != nil {
+		return nil, err
+	}
+	res := &FeePlan{}
+	res.fromModel(model, merchant.Email)
+	return res, nil
+}
+
+// DeleteFeePlan removes the fee plan of the merchant with email, so that its future transactions are free.
+// Only admins can delete fee plans.
+func (c *FeePlanController) DeleteFeePlan(ctx context.Context, email string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	return c.store.DeleteFeePlan(ctx, merchant.UserID)
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// Limits caps the transactions of a merchant. Zero values mean that the respective limit is not set.
+// MaxAmount, DailyVolume and MonthlyVolume are in Currency and MaxRefundPercentage, e.g. 10, caps the
+// refunds of the last 30 days as a percentage of the charges in the same period.
+type Limits struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	MerchantEmail       string
+	Currency            string
+	MaxAmount           float64
+	DailyVolume         float64
+	MonthlyVolume       float64
+	DailyCount          uint
+	MaxRefundPercentage float64
+}
+
+func (l *Limits) toModel(merchantID uint) (*models.MerchantLimits, error) {
+	currencyCode := models.DefaultCurrencyCode
+	if l.Currency != "" {
+		var err error
+		if currencyCode, err = models.NewCurrencyCode(l.Currency); err != nil {
+			return nil, fmt.Errorf("%w: %v", models.ErrInvalidLimits, err)
+		}
+	}
+	if l.MaxAmount < 0 || l.DailyVolume < 0 || l.MonthlyVolume < 0 || l.MaxRefundPercentage < 0 {
+		return nil, fmt.Errorf("%w: limits cannot be negative", models.ErrInvalidLimits)
+	}
+	return models.NewMerchantLimits(merchantID, currencyCode,
+		currencyCode.ToCurrency(l.MaxAmount),
+		currencyCode.ToCurrency(l.DailyVolume),
+		currencyCode.ToCurrency(l.MonthlyVolume),
+		l.DailyCount,
+		uint(math.Round(l.MaxRefundPercentage*100)))
+}
+
+func (l *Limits) fromModel(model *models.MerchantLimits, merchantEmail string) {
+	l.CreatedAt = model.CreatedAt
+	l.UpdatedAt = model.UpdatedAt
+	l.MerchantEmail = merchantEmail
+	l.Currency = string(model.CurrencyCode)
+	l.MaxAmount = model.CurrencyCode.Float64(model.MaxAmount)
+	l.DailyVolume = model.CurrencyCode.Float64(model.DailyVolume)
+	l.MonthlyVolume = model.CurrencyCode.Float64(model.MonthlyVolume)
+	l.DailyCount = model.DailyCount
+	l.MaxRefundPercentage = float64(model.MaxRefundBasisPoints) / 100
+}
+
+type LimitsController struct {
+	store         *models.LimitsStore
+	merchantStore *models.MerchantStore
+}
+
+func NewLimitsController(store *models.LimitsStore, merchantStore *models.MerchantStore) *LimitsController {
+	return &LimitsController{store: store, merchantStore: merchantStore}
+}
+
+// GetLimits returns the limits of the merchant with email. Only admins can get limits.
+func (c *LimitsController) GetLimits(ctx context.Context, email string) (*Limits, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.GetLimits(ctx, merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Limits{}
+	res.fromModel(model, merchant.Email)
+	return res, nil
+}
+
+// SetLimits replaces the limits of the merchant with email. Only admins can set limits.
+func (c *LimitsController) SetLimits(ctx context.Context, email string, l *Limits) (*Limits, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	model, err := l.toModel(merchant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.store.SetLimits(ctx, model); err != nil {
+		return nil, err
+	}
+	res := &Limits{}
+	res.fromModel(model, merchant.Email)
+	return res, nil
+}
+
+// DeleteLimits removes the limits of the merchant with email. Only admins can delete limits.
+func (c *LimitsController) DeleteLimits(ctx context.Context, email string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	return c.store.DeleteLimits(ctx, merchant.UserID)
+}
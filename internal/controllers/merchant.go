@@ -17,11 +17,17 @@ type Merchant struct {
 	Description         string
 	Email               string
 	Status              string
-	TotalTransactionSum float64
+	TotalTransactionSum map[string]float64
+	// TotalFeeSum and NetTransactionSum are the fees charged to the merchant and its total after them
+	TotalFeeSum       map[string]float64
+	NetTransactionSum map[string]float64
+
+	// password is only set by CSV imports and is never returned
+	password string
 }
 
 func (m *Merchant) CSVUnmarshal(record []string) error {
-	if len(record) != 4 {
+	if len(record) != 4 && len(record) != 5 {
 		return fmt.Errorf("wrong number of records in merchant CSV record: %v", record)
 	} else if m == nil {
 		return errors.New("cannot unmarshal CSV to a nil merchant")
@@ -30,6 +36,9 @@ func (m *Merchant) CSVUnmarshal(record []string) error {
 	m.Description = record[1]
 	m.Email = record[2]
 	m.Status = record[3]
+	if len(record) == 5 {
+		m.password = record[4]
+	}
 	return nil
 }
 
@@ -38,7 +47,22 @@ func (m *Merchant) toModel() (*models.Merchant, error) {
 	if err != nil {
 		return nil, err
 	}
-	return models.NewMerchant(m.Name, m.Description, m.Email, status)
+	model, err := models.NewMerchant(m.Name, m.Description, m.Email, status)
+	if err != nil {
+		return nil, err
+	}
+	if m.password != "" {
+		if model.User.PasswordHash, err = models.HashPassword(m.password); err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
+
+// toUpdateModel converts m to the model of a merchant updating itself. Status is ignored,
+// since only admins can change it with UpdateMerchantStatus.
+func (m *Merchant) toUpdateModel() (*models.Merchant, error) {
+	return models.NewMerchant(m.Name, m.Description, m.Email, "")
 }
 
 func (m *Merchant) fromModel(model *models.Merchant) {
@@ -49,6 +73,8 @@ func (m *Merchant) fromModel(model *models.Merchant) {
 	m.Email = model.Email
 	m.Status = string(model.User.Status)
 	m.TotalTransactionSum = model.TotalTransactionSum.Float64()
+	m.TotalFeeSum = model.TotalFeeSum.Float64()
+	m.NetTransactionSum = model.NetTransactionSum().Float64()
 }
 
 type MerchantController struct {
@@ -81,7 +107,25 @@ func (c *MerchantController) GetMerchantByMail(ctx context.Context, email string
 	return m, nil
 }
 
+// GetMerchants returns the merchants visible to the principal in ctx.
+// Merchants only see themselves, while admins see all merchants.
 func (c *MerchantController) GetMerchants(ctx context.Context) ([]*Merchant, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if principal.IsAdmin() {
+		return c.getAllMerchants(ctx)
+	}
+	m, err := c.GetMerchantByMail(ctx, principal.Email)
+	if err != nil {
+		return nil, err
+	}
+	return []*Merchant{m}, nil
+}
+
+// getAllMerchants returns all merchants regardless of the caller
+func (c *MerchantController) getAllMerchants(ctx context.Context) ([]*Merchant, error) {
 	merchants, err := c.store.GetAllMerchants(ctx)
 	if err != nil {
 		return nil, err
@@ -95,9 +139,9 @@ func (c *MerchantController) GetMerchants(ctx context.Context) ([]*Merchant, err
 }
 
 func (c *MerchantController) UpdateMerchant(ctx context.Context, merchant *Merchant) error {
-	model, err := merchant.toModel()
+	model, err := merchant.toUpdateModel()
 	if err != nil {
-		return fmt.Errorf("while converting merchant to model in update merchant")
+		return fmt.Errorf("while converting merchant to model in update merchant: %w", err)
 	}
 	if err = c.store.UpdateMerchant(ctx, model); err != nil {
 		return err
@@ -105,9 +149,50 @@ func (c *MerchantController) UpdateMerchant(ctx context.Context, merchant *Merch
 	return nil
 }
 
+// UpdateMerchantStatus activates or deactivates a merchant. Only admins are allowed to change the status of merchants.
+func (c *MerchantController) UpdateMerchantStatus(ctx context.Context, email, status string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	modelStatus, err := models.NewUserStatus(status)
+	if err != nil {
+		return err
+	}
+	return c.store.UpdateMerchantStatus(ctx, email, modelStatus)
+}
+
 func (c *MerchantController) DeleteMerchant(ctx context.Context, merchantEmail string) error {
 	if err := c.store.DeleteMerchant(ctx, merchantEmail); err != nil {
 		return err
 	}
 	return nil
 }
+
+// RotateSigningSecret creates a new signing secret for the calling merchant and returns it.
+// Once a merchant has a signing secret all of its signed requests have to be signed with it.
+func (c *MerchantController) RotateSigningSecret(ctx context.Context) (string, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.store.RotateSigningSecret(ctx, p.Email)
+}
+
+// DeleteSigningSecret deletes the signing secret of the calling merchant
+func (c *MerchantController) DeleteSigningSecret(ctx context.Context) error {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return err
+	}
+	return c.store.DeleteSigningSecret(ctx, p.Email)
+}
+
+// GetSigningSecret returns the signing secret of the calling merchant or
+// models.ErrSigningSecretNotFound if its requests do not have to be signed
+func (c *MerchantController) GetSigningSecret(ctx context.Context) (string, error) {
+	p, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.store.GetSigningSecret(ctx, p.Email)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type principalKeyType string
+
+const principalCtxKey = principalKeyType("context-principal")
+
+var (
+	// ErrNoPrincipal is returned when a controller method requiring a caller identity is called without one
+	ErrNoPrincipal = errors.New("caller identity is missing")
+	// ErrForbidden is returned when the caller is not allowed to access the requested data
+	ErrForbidden = errors.New("caller is not allowed to access this data")
+)
+
+// Principal is the identity of the caller of a controller method
+type Principal struct {
+	Email string
+	Role  models.UserRole
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.Role == models.RoleAdmin
+}
+
+// CanAccessMerchant reports whether the principal is allowed to access data of the merchant with merchantEmail
+func (p *Principal) CanAccessMerchant(merchantEmail string) bool {
+	return p.IsAdmin() || strings.EqualFold(p.Email, merchantEmail)
+}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey, p)
+}
+
+// PrincipalFromContext returns the principal put in ctx by WithPrincipal
+func PrincipalFromContext(ctx context.Context) (*Principal, error) {
+	p, ok := ctx.Value(principalCtxKey).(*Principal)
+	if !ok || p == nil {
+		return nil, ErrNoPrincipal
+	}
+	return p, nil
+}
+
+// requireAdmin returns an error unless the principal in ctx is an admin
+func requireAdmin(ctx context.Context) error {
+	p, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireMerchant returns the principal in ctx or an error unless it is a merchant
+func requireMerchant(ctx context.Context) (*Principal, error) {
+	p, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Role != models.RoleMerchant {
+		return nil, ErrForbidden
+	}
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// GetReviewQueue returns the transactions held for manual review ordered from the oldest
+func (c *TransactionController) GetReviewQueue(ctx context.Context) ([]*Transaction, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	ts, err := c.transactionStore.GetTransactionsPendingReview(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Transaction, len(ts))
+	for i := range ts {
+		res[i] = &Transaction{}
+		res[i].fromModel(ts[i])
+	}
+	return res, nil
+}
+
+// ApproveTransaction approves the transaction with uuid held for manual review on behalf of the admin in ctx
+func (c *TransactionController) ApproveTransaction(ctx context.Context, uuid string) (*Transaction, error) {
+	return c.review(ctx, uuid, c.transactionStore.ApproveTransaction)
+}
+
+// DeclineTransaction declines the transaction with uuid held for manual review on behalf of the admin in ctx
+func (c *TransactionController) DeclineTransaction(ctx context.Context, uuid string) (*Transaction, error) {
+	return c.review(ctx, uuid, c.transactionStore.DeclineTransaction)
+}
+
+func (c *TransactionController) review(ctx context.Context, uuid string, review func(ctx context.Context, extID, reviewer string) (*models.Transaction, error)) (*Transaction, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model, err := review(ctx, uuid, principal.Email)
+	if err != nil {
+		return nil, err
+	}
+	res := &Transaction{}
+	res.fromModel(model)
+	return res, nil
+}
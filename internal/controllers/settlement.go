@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// SettlementReportHeader is the header of the CSV records returned by SettledTransaction.CSVMarshal
+var SettlementReportHeader = []string{"uuid", "belongs_to_uuid", "type", "status", "created_at", "customer_email", "amount", "currency"}
+
+// SettledTransaction is a transaction included in a payout batch. Amount is negative for money taken back from the merchant.
+type SettledTransaction struct {
+	CreatedAt     time.Time
+	UUID          string
+	BelongsToUUID *string
+	Type          string
+	Status        string
+	Amount        float64
+	Currency      string
+	CustomerEmail string
+}
+
+func (t *SettledTransaction) fromModel(model *models.Transaction) {
+	t.CreatedAt = model.CreatedAt
+	t.UUID = model.ExternalID
+	if model.BelongsTo != nil {
+		t.BelongsToUUID = &model.BelongsTo.ExternalID
+	}
+	t.Type = string(model.Type)
+	t.Status = string(model.Status)
+	t.Amount = model.CurrencyCode.SignedFloat64(model.SettledAmount())
+	t.Currency = string(model.CurrencyCode)
+	t.CustomerEmail = model.CustomerEmail
+}
+
+// CSVMarshal returns t as a record of a settlement report with the columns in SettlementReportHeader
+func (t *SettledTransaction) CSVMarshal() []string {
+	var belongsToUUID string
+	if t.BelongsToUUID != nil {
+		belongsToUUID = *t.BelongsToUUID
+	}
+	currencyCode := models.CurrencyCode(t.Currency)
+	return []string{
+		t.UUID,
+		belongsToUUID,
+		t.Type,
+		t.Status,
+		t.CreatedAt.UTC().Format(time.RFC3339),
+		t.CustomerEmail,
+		strconv.FormatFloat(t.Amount, 'f', currencyCode.MinorUnits(), 64),
+		t.Currency,
+	}
+}
+
+// PayoutBatch is the payout of the settled transactions of a merchant in a currency.
+// Transactions are only returned when getting a single batch.
+type PayoutBatch struct {
+	CreatedAt time.Time
+
+	UUID          string
+	MerchantEmail string
+	Currency      string
+
+	GrossAmount      float64
+	FeeAmount        float64
+	NetAmount        float64
+	TransactionCount int
+
+	Transactions []*SettledTransaction
+}
+
+func (b *PayoutBatch) fromModel(model *models.PayoutBatch) {
+	b.CreatedAt = model.CreatedAt
+	b.UUID = model.ExternalID
+	b.MerchantEmail = model.Merchant.Email
+	b.Currency = string(model.CurrencyCode)
+	b.GrossAmount = model.CurrencyCode.SignedFloat64(model.GrossAmount)
+	b.FeeAmount = model.CurrencyCode.SignedFloat64(model.FeeAmount)
+	b.NetAmount = model.CurrencyCode.SignedFloat64(model.NetAmount)
+	b.TransactionCount = model.TransactionCount
+}
+
+type SettlementController struct {
+	store         *models.SettlementStore
+	merchantStore *models.MerchantStore
+}
+
+func NewSettlementController(store *models.SettlementStore, merchantStore *models.MerchantStore) *SettlementController {
+	return &SettlementController{store: store, merchantStore: merchantStore}
+}
+
+// merchantScope returns the ID of the merchant whose payout batches the principal in ctx can access or nil for admins
+func (c *SettlementController) merchantScope(ctx context.Context) (*uint, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if principal.IsAdmin() {
+		return nil, nil
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, principal.Email)
+	if err != nil {
+		return nil, fmt.Errorf("while getting merchant of payout batches: %w", err)
+	}
+	return &merchant.UserID, nil
+}
+
+// GetPayoutBatches returns the payout batches visible to the principal in ctx.
+// Merchants only see their own batches, while admins see the batches of all merchants.
+func (c *SettlementController) GetPayoutBatches(ctx context.Context) ([]*PayoutBatch, error) {
+	merchantID, err := c.merchantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := c.store.GetPayoutBatches(ctx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*PayoutBatch, len(batches))
+	for i := range batches {
+		res[i] = &PayoutBatch{}
+		res[i].fromModel(batches[i])
+	}
+	return res, nil
+}
+
+// GetPayoutBatch returns the payout batch with uuid together with its transactions if it is visible to the principal in ctx
+func (c *SettlementController) GetPayoutBatch(ctx context.Context, uuid string) (*PayoutBatch, error) {
+	merchantID, err := c.merchantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model, err := c.store.GetPayoutBatchByUUID(ctx, uuid, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := c.store.GetPayoutBatchTransactions(ctx, model.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &PayoutBatch{}
+	res.fromModel(model)
+	res.Transactions = make([]*SettledTransaction, len(transactions))
+	for i, t := range transactions {
+		res.Transactions[i] = &SettledTransaction{}
+		res.Transactions[i].fromModel(t)
+	}
+	return res, nil
+}
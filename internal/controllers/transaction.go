@@ -2,13 +2,24 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/krasish/payment-system/internal/models"
+	"github.com/krasish/payment-system/internal/risk"
 )
 
+// ErrDisputeTransactionType is returned when a merchant attempts to create a transaction which only disputes can create
+var ErrDisputeTransactionType = errors.New("chargebacks and their reversals can only be created by disputes")
+
+// ErrTransactionStatus is returned when a merchant attempts to create a transaction in a status other than APPROVED or ERROR,
+// since the other statuses are only set by the system, e.g. by transactions belonging to the transaction or by reviews
+var ErrTransactionStatus = errors.New("transactions can only be created in APPROVED or ERROR status")
+
 type Transaction struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -16,50 +27,81 @@ type Transaction struct {
 	UUID          string
 	BelongsToUUID *string
 
-	Type   string
-	Status string
-	Amount float64
+	Type     string
+	Status   string
+	Amount   float64
+	Currency string
+
+	CapturedAmount  float64
+	RefundedAmount  float64
+	DisputedAmount  float64
+	RemainingAmount float64
+	// FeeAmount is the fee charged for the transaction, negative when fees are returned
+	FeeAmount float64
 
 	MerchantEmail string
 	CustomerEmail string
 	CustomerPhone string
+
+	SystemGenerated bool
+	// Settled is true once the transaction has been included in a payout batch
+	Settled bool
+
+	// RiskDecision is APPROVE, REVIEW or DECLINE for assessed transactions and RiskRuleID is the rule which made it.
+	// RiskReasons are only returned for created transactions.
+	RiskDecision string
+	RiskRuleID   string
+	RiskReasons  []string
+	// ReviewedAt and ReviewedBy are set once an admin has approved or declined a transaction pending review
+	ReviewedAt *time.Time
+	ReviewedBy string
 }
 
 // Notice that since I decided to "reverse" the relation direction in my implementation
 // the logic has some differences with what is described in the task.
+// Transactions referencing a transaction in a status which does not allow them are stored with an ERROR status.
 func (t *Transaction) getModelStatus(_type models.TransactionType, belongsToModel *models.Transaction) (models.TransactionStatus, error) {
-	if belongsToModel != nil {
-		if belongsToModel.Status != models.StatusApproved {
-			return models.StatusError, nil
-		}
+	status, err := models.NewTransactionStatus(t.Status)
+	if err != nil {
+		return "", err
+	}
+	if status != models.StatusApproved && status != models.StatusError {
+		return "", fmt.Errorf("%s: %w", status, ErrTransactionStatus)
+	}
+	_, err = models.TransactionStateMachine.Transition(_type, belongsToModel)
+	if errors.Is(err, models.ErrIllegalParentStatus) {
+		return models.StatusError, nil
+	} else if err != nil {
+		return "", err
+	}
+	return status, nil
+}
 
-		switch _type {
-		case models.TypeAuthorize:
-			if belongsToModel != nil {
-				return "", errors.New("authorize transactions cannot have belongs to relations")
-			}
-		case models.TypeReversal:
-			fallthrough
-		case models.TypeCharge:
-			if belongsToModel != nil && belongsToModel.Type != models.TypeAuthorize {
-				return "", errors.New("transaction can only be related to authorize transaction")
-			}
-		case models.TypeRefund:
-			if belongsToModel != nil && belongsToModel.Type != models.TypeCharge {
-				return "", errors.New("refund transactions can only be reacted to charge transaction ")
-			}
+// getModelCurrencyCode returns the currency of the transaction. Transactions without
+// a currency inherit the one of the referenced transaction or use the default currency.
+func (t *Transaction) getModelCurrencyCode(belongsToModel *models.Transaction) (models.CurrencyCode, error) {
+	if t.Currency == "" {
+		if belongsToModel != nil {
+			return belongsToModel.CurrencyCode, nil
 		}
-
+		return models.DefaultCurrencyCode, nil
+	}
+	currencyCode, err := models.NewCurrencyCode(t.Currency)
+	if err != nil {
+		return "", err
+	}
+	if belongsToModel != nil && belongsToModel.CurrencyCode != currencyCode {
+		return "", fmt.Errorf("while creating transaction in %s for transaction in %s: %w", currencyCode, belongsToModel.CurrencyCode, models.ErrCurrencyMismatch)
 	}
-	return models.NewTransactionStatus(t.Status)
+	return currencyCode, nil
 }
 
 func (t *Transaction) toModel(merchantID uint, belongsToModel *models.Transaction) (*models.Transaction, error) {
 	var (
 		_type         models.TransactionType
 		status        models.TransactionStatus
+		currencyCode  models.CurrencyCode
 		belongsToID   *uint
-		amount        = models.ToCurrency(t.Amount)
 		customerEmail = t.CustomerEmail
 		customerPhone = t.CustomerPhone
 		err           error
@@ -69,18 +111,38 @@ func (t *Transaction) toModel(merchantID uint, belongsToModel *models.Transactio
 	if err != nil {
 		return nil, err
 	}
+	if _type == models.TypeChargeback || _type == models.TypeChargebackReversal {
+		return nil, fmt.Errorf("%s: %w", _type, ErrDisputeTransactionType)
+	}
+	if t.Amount < 0 {
+		return nil, fmt.Errorf("%v: %w", t.Amount, models.ErrInvalidAmount)
+	}
+	currencyCode, err = t.getModelCurrencyCode(belongsToModel)
+	if err != nil {
+		return nil, err
+	}
+	amount := currencyCode.ToCurrency(t.Amount)
 	status, err = t.getModelStatus(_type, belongsToModel)
 	if err != nil {
 		return nil, err
 	}
 	if belongsToModel != nil {
 		belongsToID = &belongsToModel.ID
-		amount = belongsToModel.Amount
+		switch {
+		case _type == models.TypeReversal:
+			// reversals release whatever has not been captured from the referenced authorization
+			amount = belongsToModel.RemainingAmount()
+		case _type != models.TypeCharge && _type != models.TypeRefund:
+			amount = belongsToModel.Amount
+		case amount == 0:
+			// charges and refunds without an amount consume whatever is left from the referenced transaction
+			amount = belongsToModel.RemainingAmount()
+		}
 		customerEmail = belongsToModel.CustomerEmail
 		customerPhone = belongsToModel.CustomerPhone
 	}
 
-	return models.NewTransaction(t.UUID, amount, _type, status, customerEmail, customerPhone, merchantID, belongsToID)
+	return models.NewTransaction(t.UUID, amount, currencyCode, _type, status, customerEmail, customerPhone, merchantID, belongsToID)
 }
 
 func (t *Transaction) fromModel(model *models.Transaction) {
@@ -97,51 +159,312 @@ func (t *Transaction) fromModel(model *models.Transaction) {
 	t.BelongsToUUID = belongsToUUID
 	t.Type = string(model.Type)
 	t.Status = string(model.Status)
-	t.Amount = model.Amount.Float64()
+	t.Amount = model.CurrencyCode.Float64(model.Amount)
+	t.Currency = string(model.CurrencyCode)
+	if model.Type == models.TypeAuthorize {
+		t.CapturedAmount = model.CurrencyCode.Float64(model.CapturedAmount)
+		t.RemainingAmount = model.CurrencyCode.Float64(model.RemainingAuthorizedAmount())
+	} else if model.Type == models.TypeCharge {
+		t.RefundedAmount = model.CurrencyCode.Float64(model.RefundedAmount)
+		t.DisputedAmount = model.CurrencyCode.Float64(model.DisputedAmount)
+		t.RemainingAmount = model.CurrencyCode.Float64(model.RemainingRefundableAmount())
+	}
 	t.MerchantEmail = model.Merchant.Email
 	t.CustomerEmail = model.CustomerEmail
 	t.CustomerPhone = model.CustomerPhone
+	t.FeeAmount = model.CurrencyCode.SignedFloat64(model.FeeAmount)
+	t.SystemGenerated = model.SystemGenerated
+	t.Settled = model.PayoutBatchID != nil
+	t.RiskDecision = string(model.RiskDecision)
+	t.RiskRuleID = model.RiskRuleID
+	t.ReviewedAt = model.ReviewedAt
+	t.ReviewedBy = model.ReviewedBy
+	t.RiskReasons = make([]string, len(model.RiskReasons))
+	for i, r := range model.RiskReasons {
+		t.RiskReasons[i] = fmt.Sprintf("%s (%s): %s", r.RuleID, r.Decision, r.Reason)
+	}
+}
+
+// IdempotentResponse is the response stored for an idempotency key.
+// Replayed is true when the response was returned for a retried request.
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+	Replayed   bool
 }
 
 type TransactionController struct {
 	transactionStore *models.TransactionStore
 	merchantStore    *models.MerchantStore
+	idempotencyStore *models.IdempotencyStore
+	riskEngine       *risk.Engine
 }
 
-func NewTransactionController(transactionStore *models.TransactionStore, merchantStore *models.MerchantStore) *TransactionController {
-	return &TransactionController{transactionStore: transactionStore, merchantStore: merchantStore}
+func NewTransactionController(transactionStore *models.TransactionStore, merchantStore *models.MerchantStore, idempotencyStore *models.IdempotencyStore, riskEngine *risk.Engine) *TransactionController {
+	return &TransactionController{transactionStore: transactionStore, merchantStore: merchantStore, idempotencyStore: idempotencyStore, riskEngine: riskEngine}
 }
 
 func (c *TransactionController) CreateTransaction(ctx context.Context, t *Transaction) error {
-	var (
-		belongsToModel *models.Transaction
-		merchant, err  = c.merchantStore.GetMerchantByEmail(ctx, t.MerchantEmail)
-	)
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, t.MerchantEmail)
 	if err != nil {
 		return fmt.Errorf("while getting merchant during transaciton creation: %w", err)
 	}
+	model, err := c.buildModel(ctx, t, merchant)
+	if err != nil {
+		return err
+	}
+	return c.transactionStore.CreateTransaction(ctx, model)
+}
+
+// CreateTransactionIdempotently creates a transaction at most once per idempotency key.
+// If no key is passed the UUID of the transaction is used instead. Retries of the
+// same request get the original response replayed, while reusing a key for a
+// different request results in models.ErrIdempotencyKeyReused.
+func (c *TransactionController) CreateTransactionIdempotently(ctx context.Context, idempotencyKey string, t *Transaction) (*IdempotentResponse, error) {
+	if idempotencyKey == "" {
+		idempotencyKey = t.UUID
+	}
+	merchant, err := c.merchantStore.GetMerchantByEmail(ctx, t.MerchantEmail)
+	if err != nil {
+		return nil, fmt.Errorf("while getting merchant during transaciton creation: %w", err)
+	}
+	request, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("while fingerprinting transaction request: %w", err)
+	}
+	key, err := models.NewIdempotencyKey(merchant.UserID, idempotencyKey, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp, err := c.replay(ctx, key); resp != nil || err != nil {
+		return resp, err
+	}
+
+	model, err := c.buildModel(ctx, t, merchant)
+	if err != nil {
+		return nil, err
+	}
+	err = c.transactionStore.CreateTransactionIdempotently(ctx, model, key, func(created *models.Transaction) (int, []byte, error) {
+		dto := new(Transaction)
+		dto.fromModel(created)
+		dto.MerchantEmail = merchant.Email
+		body, err := json.Marshal(dto)
+		return http.StatusCreated, body, err
+	})
+	if errors.Is(err, models.ErrIdempotencyKeyConflict) || errors.Is(err, models.ErrDuplicateTransaction) {
+		if resp, replayErr := c.replay(ctx, key); resp != nil || replayErr != nil {
+			return resp, replayErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &IdempotentResponse{StatusCode: key.ResponseStatus, Body: key.ResponseBody}, nil
+}
+
+// replay returns the stored response for key or nil if the key has not been used yet.
+func (c *TransactionController) replay(ctx context.Context, key *models.IdempotencyKey) (*IdempotentResponse, error) {
+	stored, err := c.idempotencyStore.GetIdempotencyKey(ctx, key.MerchantID, key.Key)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	if !stored.Matches(key) {
+		return nil, models.ErrIdempotencyKeyReused
+	}
+	return &IdempotentResponse{StatusCode: stored.ResponseStatus, Body: stored.ResponseBody, Replayed: true}, nil
+}
+
+func (c *TransactionController) buildModel(ctx context.Context, t *Transaction, merchant *models.Merchant) (*models.Transaction, error) {
+	var (
+		belongsToModel *models.Transaction
+		err            error
+	)
 	if t.BelongsToUUID != nil {
 		belongsToModel, err = c.transactionStore.GetTransactionByUUID(ctx, *t.BelongsToUUID)
 		if err != nil {
-			return fmt.Errorf("while getting referenced transaction during transaciton creation: %w", err)
+			return nil, fmt.Errorf("while getting referenced transaction during transaciton creation: %w", err)
+		}
+		// transactions of other merchants are reported as missing, so that their UUIDs cannot be probed
+		if belongsToModel.MerchantID != merchant.UserID {
+			return nil, fmt.Errorf("while getting referenced transaction during transaciton creation: %w", models.ErrTransactionNotFound)
 		}
 	}
 	model, err := t.toModel(merchant.UserID, belongsToModel)
+	if err != nil || model.Status == models.StatusError {
+		return model, err
+	}
+	// declined transactions are stored in ERROR status together with the rule which declined them,
+	// while the ones to be reviewed are held in PENDING_REVIEW status until an admin reviews them
+	assessment, err := c.riskEngine.Assess(ctx, model)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return c.transactionStore.CreateTransaction(ctx, model)
+	model.ApplyRiskAssessment(assessment)
+	return model, nil
+}
+
+// TransactionQuery holds the filters, the sort order and the pagination of a transactions listing.
+// Zero values mean that transactions are not filtered by the respective field.
+// MinAmount and MaxAmount are in Currency, which is required when any of them is set.
+type TransactionQuery struct {
+	MerchantEmail string
+	CustomerEmail string
+	Types         []string
+	Statuses      []string
+	Currency      string
+
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	MinAmount   *float64
+	MaxAmount   *float64
+
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// ErrInvalidTransactionQuery is returned when a TransactionQuery cannot be converted to a models.TransactionQuery
+var ErrInvalidTransactionQuery = errors.New("invalid transaction query")
+
+func (q *TransactionQuery) toModel() (*models.TransactionQuery, error) {
+	var (
+		mq  = &models.TransactionQuery{CreatedFrom: q.CreatedFrom, CreatedTo: q.CreatedTo, Cursor: q.Cursor, Limit: q.Limit}
+		err error
+	)
+	mq.MerchantEmail = strings.ToLower(q.MerchantEmail)
+	mq.CustomerEmail = strings.ToLower(q.CustomerEmail)
+	for _, t := range q.Types {
+		_type, err := models.NewTransactionType(strings.ToUpper(t))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTransactionQuery, err)
+		}
+		mq.Types = append(mq.Types, _type)
+	}
+	for _, s := range q.Statuses {
+		status, err := models.NewTransactionStatus(strings.ToUpper(s))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTransactionQuery, err)
+		}
+		mq.Statuses = append(mq.Statuses, status)
+	}
+	if q.Currency != "" {
+		if mq.CurrencyCode, err = models.NewCurrencyCode(q.Currency); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTransactionQuery, err)
+		}
+	}
+	if (q.MinAmount != nil || q.MaxAmount != nil) && mq.CurrencyCode == "" {
+		return nil, fmt.Errorf("%w: amount range requires a currency", ErrInvalidTransactionQuery)
+	}
+	for _, amount := range []*float64{q.MinAmount, q.MaxAmount} {
+		if amount != nil && *amount < 0 {
+			return nil, fmt.Errorf("%w: amounts cannot be negative", ErrInvalidTransactionQuery)
+		}
+	}
+	if q.MinAmount != nil {
+		minAmount := mq.CurrencyCode.ToCurrency(*q.MinAmount)
+		mq.MinAmount = &minAmount
+	}
+	if q.MaxAmount != nil {
+		maxAmount := mq.CurrencyCode.ToCurrency(*q.MaxAmount)
+		mq.MaxAmount = &maxAmount
+	}
+	if mq.Sort, err = models.NewTransactionSort(q.Sort); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransactionQuery, err)
+	}
+	return mq, nil
+}
+
+// TransactionPage is a page of transactions. NextCursor is passed as TransactionQuery.Cursor
+// to get the next page and is empty for the last page.
+type TransactionPage struct {
+	Transactions []*Transaction
+	NextCursor   string
 }
 
-func (c *TransactionController) GetTransactions(ctx context.Context) ([]*Transaction, error) {
-	transactions, err := c.transactionStore.GetAllTransactions(ctx)
+// QueryTransactions returns the page of transactions matching q, which are visible to the principal in ctx.
+// Merchants only see their own transactions, while admins see the transactions of all merchants.
+// Errors caused by an invalid q match ErrInvalidTransactionQuery or models.ErrInvalidCursor.
+func (c *TransactionController) QueryTransactions(ctx context.Context, q *TransactionQuery) (*TransactionPage, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scoped := *q
+	if !principal.IsAdmin() {
+		if q.MerchantEmail != "" && !principal.CanAccessMerchant(q.MerchantEmail) {
+			return nil, ErrForbidden
+		}
+		scoped.MerchantEmail = principal.Email
+	}
+	mq, err := scoped.toModel()
+	if err != nil {
+		return nil, err
+	}
+	page, err := c.transactionStore.QueryTransactions(ctx, mq)
 	if err != nil {
 		return nil, err
 	}
-	res := make([]*Transaction, len(transactions))
-	for i := range transactions {
-		res[i] = &Transaction{}
-		res[i].fromModel(transactions[i])
+	res := &TransactionPage{Transactions: make([]*Transaction, len(page.Transactions)), NextCursor: page.NextCursor}
+	for i := range page.Transactions {
+		res.Transactions[i] = &Transaction{}
+		res.Transactions[i].fromModel(page.Transactions[i])
 	}
 	return res, nil
 }
+
+// TransactionNode is a transaction together with the transactions belonging to it
+type TransactionNode struct {
+	Transaction
+	Children []*TransactionNode
+}
+
+// TransactionChain is a transaction together with the whole tree of transactions it is part of,
+// starting from the transaction without a parent (e.g. the AUTHORIZE of a CHARGE).
+type TransactionChain struct {
+	Transaction *Transaction
+	Root        *TransactionNode
+}
+
+// GetTransactionChain returns the transaction with uuid and its chain.
+// Merchants only see their own transactions, while admins see the transactions of all merchants.
+func (c *TransactionController) GetTransactionChain(ctx context.Context, uuid string) (*TransactionChain, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var merchantID *uint
+	if !principal.IsAdmin() {
+		merchant, err := c.merchantStore.GetMerchantByEmail(ctx, principal.Email)
+		if err != nil {
+			return nil, fmt.Errorf("while getting merchant during transaction chain lookup: %w", err)
+		}
+		merchantID = &merchant.UserID
+	}
+	ts, err := c.transactionStore.GetTransactionChainByUUID(ctx, uuid, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return buildTransactionChain(ts, uuid), nil
+}
+
+func buildTransactionChain(ts []*models.Transaction, uuid string) *TransactionChain {
+	var (
+		chain = &TransactionChain{}
+		nodes = make(map[uint]*TransactionNode, len(ts))
+	)
+	// transactions are ordered by ID, so parents always come before their children
+	for _, t := range ts {
+		node := &TransactionNode{Children: make([]*TransactionNode, 0)}
+		node.fromModel(t)
+		nodes[t.ID] = node
+		if t.ExternalID == uuid {
+			chain.Transaction = &node.Transaction
+		}
+		if t.BelongsToID == nil {
+			chain.Root = node
+		} else if parent, ok := nodes[*t.BelongsToID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return chain
+}
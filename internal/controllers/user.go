@@ -12,21 +12,58 @@ import (
 type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Email     string
 	Role      string
 	Status    string
 }
 
-func (m *User) CSVUnmarshal(record []string) error {
-	if len(record) != 1 {
-		return fmt.Errorf("wrong number of records in user CSV record: %v", record)
-	} else if m == nil {
-		return errors.New("cannot unmarshal CSV to a nil user")
+func (u *User) fromModel(model *models.UserIdentity) {
+	u.CreatedAt = model.CreatedAt
+	u.UpdatedAt = model.UpdatedAt
+	u.Email = model.Email
+	u.Role = string(model.Role)
+	u.Status = string(model.Status)
+}
+
+type Admin struct {
+	Email  string
+	Status string
+
+	// password is only set by CSV imports and is never returned
+	password string
+}
+
+func (a *Admin) CSVUnmarshal(record []string) error {
+	if len(record) != 2 && len(record) != 3 {
+		return fmt.Errorf("wrong number of records in admin CSV record: %v", record)
+	} else if a == nil {
+		return errors.New("cannot unmarshal CSV to a nil admin")
+	}
+	a.Email = record[0]
+	a.Status = record[1]
+	if len(record) == 3 {
+		a.password = record[2]
 	}
-	m.Status = record[0]
-	m.Role = string(models.RoleAdmin)
 	return nil
 }
 
+func (a *Admin) toModel() (*models.Admin, error) {
+	status, err := models.NewUserStatus(a.Status)
+	if err != nil {
+		return nil, err
+	}
+	model, err := models.NewAdmin(a.Email, status)
+	if err != nil {
+		return nil, err
+	}
+	if a.password != "" {
+		if model.User.PasswordHash, err = models.HashPassword(a.password); err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
+
 func (u *User) toModel() (*models.User, error) {
 	role, err := models.NewUserRole(u.Role)
 	if err != nil {
@@ -59,3 +96,43 @@ func (c *UserController) CreateUsers(ctx context.Context, us []*User) error {
 
 	return c.store.CreateUsers(ctx, modelUsers)
 }
+
+func (c *UserController) CreateAdmins(ctx context.Context, as []*Admin) error {
+	modelAdmins := make([]*models.Admin, 0, len(as))
+	for _, a := range as {
+		model, err := a.toModel()
+		if err != nil {
+			return fmt.Errorf("while converting admins to model DTO: %w", err)
+		}
+		modelAdmins = append(modelAdmins, model)
+	}
+	return c.store.CreateAdmins(ctx, modelAdmins)
+}
+
+// IsActiveAdmin reports whether email belongs to an admin in ACTIVE status
+func (c *UserController) IsActiveAdmin(ctx context.Context, email string) (bool, error) {
+	admin, err := c.store.GetAdminByEmail(ctx, email)
+	if errors.Is(err, models.ErrAdminNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return admin.User.Status == models.StatusActive, nil
+}
+
+// GetUsers returns all users. Only admins are allowed to list users.
+func (c *UserController) GetUsers(ctx context.Context) ([]*User, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	users, err := c.store.GetAllUserIdentities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*User, len(users))
+	for i := range users {
+		res[i] = &User{}
+		res[i].fromModel(users[i])
+	}
+	return res, nil
+}
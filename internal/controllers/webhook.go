@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+	"github.com/krasish/payment-system/internal/webhooks"
+)
+
+// maxListedDeliveries is the number of the latest deliveries returned by GetDeliveries
+const maxListedDeliveries = 100
+
+// ErrInvalidWebhookURL is returned when a webhook endpoint URL is not an absolute http(s) URL of a public host
+var ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute http or https URL")
+
+type WebhookEndpoint struct {
+	ID        uint
+	CreatedAt time.Time
+	URL       string
+}
+
+func (e *WebhookEndpoint) fromModel(model *models.WebhookEndpoint) {
+	e.ID = model.ID
+	e.CreatedAt = model.CreatedAt
+	e.URL = model.URL
+}
+
+// CreatedWebhookEndpoint is a webhook endpoint together with the secret its events are signed with,
+// which is only returned on creation
+type CreatedWebhookEndpoint struct {
+	WebhookEndpoint
+	Secret string
+}
+
+type WebhookDeliveryAttempt struct {
+	CreatedAt      time.Time
+	ResponseStatus int
+	Error          string
+}
+
+type WebhookDelivery struct {
+	ID            uint
+	CreatedAt     time.Time
+	EventID       string
+	EventType     string
+	EndpointID    uint
+	URL           string
+	Status        string
+	NextAttemptAt *time.Time
+	DeliveredAt   *time.Time
+	Log           []WebhookDeliveryAttempt
+}
+
+func (d *WebhookDelivery) fromModel(model *models.WebhookDelivery) {
+	d.ID = model.ID
+	d.CreatedAt = model.CreatedAt
+	d.EventID = model.Event.ExternalID
+	d.EventType = string(model.Event.Type)
+	d.EndpointID = model.EndpointID
+	d.URL = model.Endpoint.URL
+	d.Status = string(model.Status)
+	if model.Status == models.DeliveryPending {
+		d.NextAttemptAt = &model.NextAttemptAt
+	}
+	d.DeliveredAt = model.DeliveredAt
+	d.Log = make([]WebhookDeliveryAttempt, len(model.Log))
+	for i, a := range model.Log {
+		d.Log[i] = WebhookDeliveryAttempt{CreatedAt: a.CreatedAt, ResponseStatus: a.ResponseStatus, Error: a.Error}
+	}
+}
+
+type WebhookController struct {
+	store *models.WebhookStore
+}
+
+func NewWebhookController(store *models.WebhookStore) *WebhookController {
+	return &WebhookController{store: store}
+}
+
+// CreateEndpoint registers rawURL as a webhook endpoint of the calling merchant
+func (c *WebhookController) CreateEndpoint(ctx context.Context, rawURL string) (*CreatedWebhookEndpoint, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q: %w", rawURL, ErrInvalidWebhookURL)
+	}
+	if err := webhooks.CheckEndpointHost(ctx, u.Hostname()); err != nil {
+		return nil, fmt.Errorf("%q: %w: %v", rawURL, ErrInvalidWebhookURL, err)
+	}
+	model, err := c.store.CreateEndpoint(ctx, p.Email, u.String())
+	if err != nil {
+		return nil, err
+	}
+	res := &CreatedWebhookEndpoint{Secret: model.Secret}
+	res.fromModel(model)
+	return res, nil
+}
+
+// GetEndpoints returns the webhook endpoints of the calling merchant
+func (c *WebhookController) GetEndpoints(ctx context.Context) ([]*WebhookEndpoint, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := c.store.GetEndpoints(ctx, p.Email)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*WebhookEndpoint, len(endpoints))
+	for i := range endpoints {
+		res[i] = &WebhookEndpoint{}
+		res[i].fromModel(endpoints[i])
+	}
+	return res, nil
+}
+
+// DeleteEndpoint deletes the webhook endpoint with id of the calling merchant
+func (c *WebhookController) DeleteEndpoint(ctx context.Context, id uint) error {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return err
+	}
+	return c.store.DeleteEndpoint(ctx, p.Email, id)
+}
+
+// GetDeliveries returns the latest deliveries of events to the webhook endpoints of the calling merchant
+func (c *WebhookController) GetDeliveries(ctx context.Context) ([]*WebhookDelivery, error) {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := c.store.GetDeliveries(ctx, p.Email, maxListedDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*WebhookDelivery, len(deliveries))
+	for i := range deliveries {
+		res[i] = &WebhookDelivery{}
+		res[i].fromModel(deliveries[i])
+	}
+	return res, nil
+}
+
+// Redeliver schedules the delivery with id of the calling merchant to be attempted again
+func (c *WebhookController) Redeliver(ctx context.Context, id uint) error {
+	p, err := requireMerchant(ctx)
+	if err != nil {
+		return err
+	}
+	return c.store.Redeliver(ctx, p.Email, id)
+}
@@ -30,6 +30,8 @@ func (i *MerchantImporter) Import(pathToCSVFile string) error {
 	defer common.CloseWithLogOnError(file)
 
 	r := enc_csv.NewReader(file)
+	// the password column is optional
+	r.FieldsPerRecord = -1
 	dtos := make([]*controllers.Merchant, 0)
 	for {
 		record, err := r.Read()
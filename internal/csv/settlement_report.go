@@ -0,0 +1,27 @@
+package csv
+
+import (
+	enc_csv "encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/krasish/payment-system/internal/controllers"
+)
+
+// WriteSettlementReport writes the transactions of batch to w as CSV with a header row
+func WriteSettlementReport(w io.Writer, batch *controllers.PayoutBatch) error {
+	cw := enc_csv.NewWriter(w)
+	if err := cw.Write(controllers.SettlementReportHeader); err != nil {
+		return fmt.Errorf("while writing settlement report header: %w", err)
+	}
+	for _, t := range batch.Transactions {
+		if err := cw.Write(t.CSVMarshal()); err != nil {
+			return fmt.Errorf("while writing settlement report record of transaction %s: %w", t.UUID, err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("while writing settlement report: %w", err)
+	}
+	return nil
+}
@@ -30,20 +30,22 @@ func (i *AdminImporter) Import(pathToCSVFile string) error {
 	defer common.CloseWithLogOnError(file)
 
 	r := enc_csv.NewReader(file)
-	dtos := make([]*controllers.User, 0)
+	// the password column is optional
+	r.FieldsPerRecord = -1
+	dtos := make([]*controllers.Admin, 0)
 	for {
 		record, err := r.Read()
 
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return fmt.Errorf("while importing merchants: %w", err)
+			return fmt.Errorf("while importing admins: %w", err)
 		}
-		dto := new(controllers.User)
+		dto := new(controllers.Admin)
 		if err := dto.CSVUnmarshal(record); err != nil {
 			return err
 		}
 		dtos = append(dtos, dto)
 	}
-	return i.c.CreateUsers(context.Background(), dtos)
+	return i.c.CreateAdmins(context.Background(), dtos)
 }
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+const (
+	PublisherInProcess = "inprocess"
+	PublisherFile      = "file"
+)
+
+// Message is an outbox event as handed to publishers. Event holds the JSON payload of the event.
+type Message struct {
+	ID         string
+	Type       models.EventType
+	MerchantID uint
+	CreatedAt  time.Time
+	Event      json.RawMessage
+}
+
+func newMessage(e *models.OutboxEvent) Message {
+	return Message{
+		ID:         e.ExternalID,
+		Type:       e.Type,
+		MerchantID: e.MerchantID,
+		CreatedAt:  e.CreatedAt,
+		Event:      json.RawMessage(e.Payload),
+	}
+}
+
+// Publisher publishes messages to an event stream. Publish is called with the messages of a merchant
+// in the order their events were written and is not called concurrently.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// Handler handles messages published by an InProcessPublisher
+type Handler func(ctx context.Context, m Message) error
+
+// InProcessPublisher publishes messages to the handlers subscribed to it within the process
+type InProcessPublisher struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+// Subscribe adds h to the handlers of all further messages
+func (p *InProcessPublisher) Subscribe(h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers = append(p.handlers, h)
+}
+
+// Publish calls every handler with m. A message is considered published only when all handlers succeed,
+// so handlers should be idempotent as they are called again when publishing is retried.
+func (p *InProcessPublisher) Publish(ctx context.Context, m Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, h := range p.handlers {
+		if err := h(ctx, m); err != nil {
+			return fmt.Errorf("while handling event %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// LogHandler logs the messages it handles
+func LogHandler(_ context.Context, m Message) error {
+	logrus.Debugf("published event %s of type %s of merchant %d", m.ID, m.Type, m.MerchantID)
+	return nil
+}
+
+// FilePublisher appends messages to a file in JSON Lines format, one message per line
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher opens the file at path for appending, creating it if it does not exist
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("while opening events file: %w", err)
+	}
+	return &FilePublisher{file: f}, nil
+}
+
+// Publish writes m as a line to the file and syncs it to disk
+func (p *FilePublisher) Publish(_ context.Context, m Message) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("while marshalling event %s: %w", m.ID, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("while writing event %s: %w", m.ID, err)
+	}
+	return p.file.Sync()
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
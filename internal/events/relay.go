@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// batchSize is the maximum number of events published by a single run of the relay
+const batchSize = 100
+
+// Relay publishes the events in the outbox to a Publisher. Events are published at least once
+// and the events of a merchant are published in the order they were written.
+type Relay struct {
+	store     *models.OutboxStore
+	publisher Publisher
+}
+
+func NewRelay(store *models.OutboxStore, publisher Publisher) *Relay {
+	return &Relay{store: store, publisher: publisher}
+}
+
+// GetPeriodicJobRelay returns a job which publishes new events every jobExecutionInterval
+func (r *Relay) GetPeriodicJobRelay(jobExecutionInterval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Relay(ctx); err != nil {
+					logrus.Warnf("periodic event relay job failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Relay publishes the events which have not been published yet, batch by batch, until none are left
+// except for the ones held back after a failure, or another relay is publishing. Batches are published
+// entirely unless no other events can be published, so a smaller batch means that the relay is done.
+func (r *Relay) Relay(ctx context.Context) error {
+	for {
+		published, err := r.store.PublishEvents(ctx, batchSize, func(ctx context.Context, e *models.OutboxEvent) error {
+			return r.publisher.Publish(ctx, newMessage(e))
+		})
+		if err != nil {
+			return err
+		}
+		if published < batchSize {
+			return nil
+		}
+	}
+}
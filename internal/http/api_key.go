@@ -0,0 +1,86 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type APIKeyHandlerFactory struct {
+	akc *controllers.APIKeyController
+}
+
+func NewAPIKeyHandlerFactory(akc *controllers.APIKeyController) *APIKeyHandlerFactory {
+	return &APIKeyHandlerFactory{akc: akc}
+}
+
+func (f *APIKeyHandlerFactory) BuildCreateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Name      string
+			ExpiresAt *time.Time
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logrus.WithError(err).Error("Failed to read API key from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+		if body.Name == "" {
+			respondWithMessage(w, "Name of API key is required", http.StatusBadRequest)
+			return
+		}
+		if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+			respondWithMessage(w, "ExpiresAt of API key must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		key, err := f.akc.CreateAPIKey(r.Context(), body.Name, body.ExpiresAt)
+		if err != nil {
+			respondWithControllerError(w, "failed to create API key", err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		respondWithJSON(w, key)
+	}
+}
+
+func (f *APIKeyHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := f.akc.GetAPIKeys(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "failed to get API keys", err)
+			return
+		}
+		respondWithJSON(w, keys)
+	}
+}
+
+func (f *APIKeyHandlerFactory) BuildRevokeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)[APIKeyIDPathVar], 10, 64)
+		if err != nil {
+			respondWithMessage(w, "API key ID must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		err = f.akc.RevokeAPIKey(r.Context(), uint(id))
+		switch {
+		case errors.Is(err, models.ErrAPIKeyNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to revoke API key", err)
+			return
+		}
+		respondWithMessage(w, "API key revoked", http.StatusOK)
+	}
+}
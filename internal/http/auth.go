@@ -0,0 +1,88 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+const (
+	GrantTypePassword     = "password"
+	GrantTypeRefreshToken = "refresh_token"
+)
+
+// TokenRequest is the body of token requests. Email and Password are used by the password
+// grant and RefreshToken by the refresh_token grant.
+type TokenRequest struct {
+	GrantType    string
+	Email        string
+	Password     string
+	RefreshToken string
+}
+
+type TokenResponse struct {
+	AccessToken  string
+	TokenType    string
+	ExpiresIn    int64
+	RefreshToken string
+}
+
+type AuthHandlerFactory struct {
+	ac *controllers.AuthController
+	ts tokenSettings
+}
+
+func NewAuthHandlerFactory(ac *controllers.AuthController, ts tokenSettings) *AuthHandlerFactory {
+	return &AuthHandlerFactory{ac: ac, ts: ts}
+}
+
+func (f *AuthHandlerFactory) BuildTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := TokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logrus.WithError(err).Error("Failed to read token request from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		var (
+			session *controllers.Session
+			err     error
+		)
+		switch req.GrantType {
+		case GrantTypePassword:
+			session, err = f.ac.Login(r.Context(), req.Email, req.Password)
+		case GrantTypeRefreshToken:
+			session, err = f.ac.Refresh(r.Context(), req.RefreshToken)
+		default:
+			respondWithMessage(w, "GrantType must be one of password or refresh_token", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials), errors.Is(err, models.ErrInvalidRefreshToken):
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to issue token", err)
+			return
+		}
+
+		accessToken, err := f.ts.issue(session.Principal)
+		if err != nil {
+			respondWithControllerError(w, "failed to issue token", err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, TokenResponse{
+			AccessToken:  accessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(f.ts.ttl.Seconds()),
+			RefreshToken: session.RefreshToken,
+		})
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -10,6 +11,9 @@ import (
 	"github.com/dgrijalva/jwt-go/request"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
 )
 
 type ClaimsKeyType string
@@ -17,9 +21,44 @@ type ClaimsKeyType string
 const (
 	ClaimsCtxKey       = ClaimsKeyType("context-claims")
 	ContentTypeAppJSON = "application/json"
+	ContentTypeTextCSV = "text/csv"
+
+	APIKeyHeader             = "X-API-Key"
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	TransactionUUIDPathVar   = "uuid"
+	UserEmailPathVar         = "email"
+	APIKeyIDPathVar          = "id"
+	WebhookIDPathVar         = "id"
+	WebhookDeliveryIDPathVar = "id"
+	DisputeUUIDPathVar       = "uuid"
+	PayoutBatchUUIDPathVar   = "uuid"
+	ReviewUUIDPathVar        = "uuid"
+	CustomerUUIDPathVar      = "uuid"
 )
 
-func securedHandler(jwtKey []byte, next http.HandlerFunc) http.HandlerFunc {
+// Claims are the claims of the JWT tokens accepted by securedHandler.
+// Role is one of the models.UserRole values and defaults to models.RoleMerchant.
+type Claims struct {
+	jwt.StandardClaims
+	Role string `json:"role,omitempty"`
+}
+
+func (c *Claims) principal() (*controllers.Principal, error) {
+	if c.Role == "" {
+		return &controllers.Principal{Email: c.Subject, Role: models.RoleMerchant}, nil
+	}
+	role, err := models.NewUserRole(c.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &controllers.Principal{Email: c.Subject, Role: role}, nil
+}
+
+// securedHandler puts the principal of the bearer JWT of the request in its context. The admin role claim
+// is only trusted if the subject is an active admin, so that principals of removed or deactivated admins are rejected.
+func securedHandler(ts tokenSettings, uc *controllers.UserController, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		headerExtractor := request.AuthorizationHeaderExtractor
 		bearerToken, err := headerExtractor.ExtractToken(r)
@@ -27,27 +66,84 @@ func securedHandler(jwtKey []byte, next http.HandlerFunc) http.HandlerFunc {
 			respondWithMessage(w, fmt.Sprintf("could not extract token from auth header: %s", err.Error()), http.StatusBadRequest)
 			return
 		}
-		//token claims validation is intentionally skipped for simplicity
-		claims := jwt.StandardClaims{}
-		token, err := jwt.ParseWithClaims(bearerToken, &claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("invalid signing method")
-			}
-			return jwtKey, nil
-		})
+		claims, err := ts.parse(bearerToken)
 		if err != nil {
 			logrus.Errorf("could not parse token: %s", err.Error())
-			respondWithMessage(w, "could not parse token", http.StatusUnauthorized)
+			respondWithMessage(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
-		if token.Valid {
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, ClaimsCtxKey, claims)
-			r = r.WithContext(ctx)
-			next.ServeHTTP(w, r)
-		} else {
-			respondWithMessage(w, "invalid token token", http.StatusUnauthorized)
+		principal, err := claims.principal()
+		if err != nil {
+			respondWithMessage(w, fmt.Sprintf("invalid role claim: %v", err), http.StatusUnauthorized)
+			return
+		}
+		if principal.IsAdmin() {
+			active, err := uc.IsActiveAdmin(r.Context(), principal.Email)
+			if err != nil {
+				respondWithControllerError(w, "failed to check admin", err)
+				return
+			}
+			if !active {
+				respondWithMessage(w, "admin does not exist or is not active", http.StatusForbidden)
+				return
+			}
 		}
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, ClaimsCtxKey, *claims)
+		ctx = controllers.WithPrincipal(ctx, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// authenticatedHandler accepts either an API key in the X-API-Key header or a bearer JWT validated
+// by securedHandler. Both put the principal of the caller in the request context.
+func authenticatedHandler(ts tokenSettings, uc *controllers.UserController, akc *controllers.APIKeyController, next http.HandlerFunc) http.HandlerFunc {
+	jwtHandler := securedHandler(ts, uc, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(APIKeyHeader)
+		if key == "" {
+			jwtHandler.ServeHTTP(w, r)
+			return
+		}
+		principal, err := akc.Authenticate(r.Context(), key)
+		if errors.Is(err, models.ErrInvalidAPIKey) {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			respondWithControllerError(w, "failed to authenticate API key", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(controllers.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// adminOnly lets only requests of admins through. It has to be wrapped by securedHandler, which checks that they are active.
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := controllers.PrincipalFromContext(r.Context())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !principal.IsAdmin() {
+			respondWithMessage(w, "only admins are allowed to access this resource", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// respondWithControllerError responds with the status code matching the identity related errors
+// returned by controllers and with 500 for any other error
+func respondWithControllerError(writer http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, controllers.ErrNoPrincipal):
+		respondWithMessage(writer, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, controllers.ErrForbidden):
+		respondWithMessage(writer, err.Error(), http.StatusForbidden)
+	default:
+		logrus.WithError(err).Error(message)
+		respondWithMessage(writer, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
 	}
 }
 
@@ -63,9 +159,13 @@ func respondWithMessage(writer http.ResponseWriter, message string, statusCode i
 		http.Error(writer, fmt.Sprintf("Failed to construct message response: %v", err.Error()), http.StatusInternalServerError)
 		return
 	}
+	respondWithBody(writer, resp, statusCode)
+}
+
+func respondWithBody(writer http.ResponseWriter, body []byte, statusCode int) {
 	writer.Header().Set("Content-Type", ContentTypeAppJSON)
 	writer.WriteHeader(statusCode)
-	if _, err := writer.Write(resp); err != nil {
+	if _, err := writer.Write(body); err != nil {
 		logrus.Warnf("Failed to write response body: %v", err)
 	}
 }
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type CustomerHandlerFactory struct {
+	cc *controllers.CustomerController
+}
+
+func NewCustomerHandlerFactory(cc *controllers.CustomerController) *CustomerHandlerFactory {
+	return &CustomerHandlerFactory{cc: cc}
+}
+
+// respondWithCustomerError responds with the status code matching an error returned by the customer controller
+func respondWithCustomerError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrCustomerNotFound), errors.Is(err, models.ErrMerchantNotFound):
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+	default:
+		respondWithControllerError(w, message, err)
+	}
+}
+
+func (f *CustomerHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customers, err := f.cc.GetCustomers(r.Context(), mux.Vars(r)[UserEmailPathVar])
+		if err != nil {
+			respondWithCustomerError(w, "failed to get customers", err)
+			return
+		}
+		respondWithJSON(w, customers)
+	}
+}
+
+func (f *CustomerHandlerFactory) BuildGetOwnHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customers, err := f.cc.GetOwnCustomers(r.Context())
+		if err != nil {
+			respondWithCustomerError(w, "failed to get customers", err)
+			return
+		}
+		respondWithJSON(w, customers)
+	}
+}
+
+func (f *CustomerHandlerFactory) BuildGetOwnOneHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customer, err := f.cc.GetOwnCustomer(r.Context(), mux.Vars(r)[CustomerUUIDPathVar])
+		if err != nil {
+			respondWithCustomerError(w, "failed to get customer", err)
+			return
+		}
+		respondWithJSON(w, customer)
+	}
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type DisputeHandlerFactory struct {
+	dc *controllers.DisputeController
+}
+
+func NewDisputeHandlerFactory(dc *controllers.DisputeController) *DisputeHandlerFactory {
+	return &DisputeHandlerFactory{dc: dc}
+}
+
+// respondWithDisputeError responds with the status code matching an error returned by the dispute controller
+func respondWithDisputeError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrDisputeNotFound), errors.Is(err, models.ErrTransactionNotFound):
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, controllers.ErrInvalidDispute), errors.Is(err, controllers.ErrInvalidEvidence),
+		errors.Is(err, models.ErrInvalidDisputeOutcome):
+		respondWithMessage(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrDisputeNotOpen), errors.Is(err, models.ErrDisputeResolved),
+		errors.Is(err, models.ErrEvidenceDeadlinePassed), errors.Is(err, models.ErrNoEvidence),
+		errors.Is(err, models.ErrIllegalTransition), errors.Is(err, models.ErrChargebackExceedsCharge),
+		errors.Is(err, models.ErrInvalidAmount), errors.Is(err, models.ErrCurrencyMismatch):
+		respondWithMessage(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		respondWithControllerError(w, message, err)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildOpenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := &controllers.Dispute{}
+		if err := json.NewDecoder(r.Body).Decode(d); err != nil {
+			logrus.WithError(err).Error("Failed to read dispute from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		dispute, err := f.dc.OpenDispute(r.Context(), d)
+		if err != nil {
+			respondWithDisputeError(w, "failed to open dispute", err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		respondWithJSON(w, dispute)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		disputes, err := f.dc.GetDisputes(r.Context())
+		if err != nil {
+			respondWithDisputeError(w, "failed to get disputes", err)
+			return
+		}
+		respondWithJSON(w, disputes)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildGetOneHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute, err := f.dc.GetDispute(r.Context(), mux.Vars(r)[DisputeUUIDPathVar])
+		if err != nil {
+			respondWithDisputeError(w, "failed to get dispute", err)
+			return
+		}
+		respondWithJSON(w, dispute)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildAddEvidenceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e := &controllers.DisputeEvidence{}
+		if err := json.NewDecoder(r.Body).Decode(e); err != nil {
+			logrus.WithError(err).Error("Failed to read dispute evidence from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		dispute, err := f.dc.AddEvidence(r.Context(), mux.Vars(r)[DisputeUUIDPathVar], e)
+		if err != nil {
+			respondWithDisputeError(w, "failed to add dispute evidence", err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		respondWithJSON(w, dispute)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildSubmitEvidenceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute, err := f.dc.SubmitEvidence(r.Context(), mux.Vars(r)[DisputeUUIDPathVar])
+		if err != nil {
+			respondWithDisputeError(w, "failed to submit dispute evidence", err)
+			return
+		}
+		respondWithJSON(w, dispute)
+	}
+}
+
+func (f *DisputeHandlerFactory) BuildResolveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Outcome string
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logrus.WithError(err).Error("Failed to read dispute outcome from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		dispute, err := f.dc.ResolveDispute(r.Context(), mux.Vars(r)[DisputeUUIDPathVar], body.Outcome)
+		if err != nil {
+			respondWithDisputeError(w, "failed to resolve dispute", err)
+			return
+		}
+		respondWithJSON(w, dispute)
+	}
+}
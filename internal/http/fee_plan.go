@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type FeePlanHandlerFactory struct {
+	fc *controllers.FeePlanController
+}
+
+func NewFeePlanHandlerFactory(fc *controllers.FeePlanController) *FeePlanHandlerFactory {
+	return &FeePlanHandlerFactory{fc: fc}
+}
+
+// respondWithFeePlanError responds with the status code matching an error returned by the fee plan controller
+func respondWithFeePlanError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrFeePlanNotFound), errors.Is(err, models.ErrMerchantNotFound):
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidFeePlan):
+		respondWithMessage(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondWithControllerError(w, message, err)
+	}
+}
+
+func (f *FeePlanHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plan, err := f.fc.GetFeePlan(r.Context(), mux.Vars(r)[UserEmailPathVar])
+		if err != nil {
+			respondWithFeePlanError(w, "failed to get fee plan", err)
+			return
+		}
+		respondWithJSON(w, plan)
+	}
+}
+
+func (f *FeePlanHandlerFactory) BuildGetOwnHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plan, err := f.fc.GetOwnFeePlan(r.Context())
+		if err != nil {
+			respondWithFeePlanError(w, "failed to get fee plan", err)
+			return
+		}
+		respondWithJSON(w, plan)
+	}
+}
+
+func (f *FeePlanHandlerFactory) BuildSetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := &controllers.FeePlan{}
+		if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+			logrus.WithError(err).Error("Failed to read fee plan from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		plan, err := f.fc.SetFeePlan(r.Context(), mux.Vars(r)[UserEmailPathVar], p)
+		if err != nil {
+			respondWithFeePlanError(w, "failed to set fee plan", err)
+			return
+		}
+		respondWithJSON(w, plan)
+	}
+}
+
+func (f *FeePlanHandlerFactory) BuildDeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f.fc.DeleteFeePlan(r.Context(), mux.Vars(r)[UserEmailPathVar]); err != nil {
+			respondWithFeePlanError(w, "failed to delete fee plan", err)
+			return
+		}
+		respondWithMessage(w, "fee plan deleted", http.StatusOK)
+	}
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type LimitsHandlerFactory struct {
+	lc *controllers.LimitsController
+}
+
+func NewLimitsHandlerFactory(lc *controllers.LimitsController) *LimitsHandlerFactory {
+	return &LimitsHandlerFactory{lc: lc}
+}
+
+// respondWithLimitsError responds with the status code matching an error returned by the limits controller
+func respondWithLimitsError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrLimitsNotFound), errors.Is(err, models.ErrMerchantNotFound):
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidLimits):
+		respondWithMessage(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondWithControllerError(w, message, err)
+	}
+}
+
+func (f *LimitsHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits, err := f.lc.GetLimits(r.Context(), mux.Vars(r)[UserEmailPathVar])
+		if err != nil {
+			respondWithLimitsError(w, "failed to get limits", err)
+			return
+		}
+		respondWithJSON(w, limits)
+	}
+}
+
+func (f *LimitsHandlerFactory) BuildSetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := &controllers.Limits{}
+		if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+			logrus.WithError(err).Error("Failed to read limits from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		limits, err := f.lc.SetLimits(r.Context(), mux.Vars(r)[UserEmailPathVar], l)
+		if err != nil {
+			respondWithLimitsError(w, "failed to set limits", err)
+			return
+		}
+		respondWithJSON(w, limits)
+	}
+}
+
+func (f *LimitsHandlerFactory) BuildDeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f.lc.DeleteLimits(r.Context(), mux.Vars(r)[UserEmailPathVar]); err != nil {
+			respondWithLimitsError(w, "failed to delete limits", err)
+			return
+		}
+		respondWithMessage(w, "limits deleted", http.StatusOK)
+	}
+}
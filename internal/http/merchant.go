@@ -1,35 +1,38 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/krasish/payment-system/internal/views"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/sirupsen/logrus"
 
 	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
 )
 
 type MerchantHandlerFactory struct {
 	mc *controllers.MerchantController
 	tc *controllers.TransactionController
+	dc *controllers.DisputeController
 
 	v *views.View
 }
 
-func NewMerchantHandlerFactory(mc *controllers.MerchantController, tc *controllers.TransactionController, v *views.View) *MerchantHandlerFactory {
-	return &MerchantHandlerFactory{mc: mc, tc: tc, v: v}
+func NewMerchantHandlerFactory(mc *controllers.MerchantController, tc *controllers.TransactionController, dc *controllers.DisputeController, v *views.View) *MerchantHandlerFactory {
+	return &MerchantHandlerFactory{mc: mc, tc: tc, dc: dc, v: v}
 }
 
 func (f *MerchantHandlerFactory) BuildGetHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		merchants, err := f.mc.GetMerchants(r.Context())
 		if err != nil {
-			respondWithMessage(w, fmt.Sprintf("failed to get merchants: %v", err), http.StatusInternalServerError)
+			respondWithControllerError(w, "failed to get merchants", err)
 			return
 		}
 		respondWithJSON(w, merchants)
@@ -44,22 +47,17 @@ func (f *MerchantHandlerFactory) BuildUpdateHandler() http.HandlerFunc {
 			respondWithMessage(w, "could not read request body", http.StatusInternalServerError)
 			return
 		}
-		value := r.Context().Value(ClaimsCtxKey)
-		if value == nil {
-			respondWithMessage(w, "could not get token claims", http.StatusUnauthorized)
-			return
-		}
-		claims, ok := value.(jwt.StandardClaims)
-		if !ok {
-			respondWithMessage(w, "invalid token claims format", http.StatusUnauthorized)
+		principal, err := controllers.PrincipalFromContext(r.Context())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if !strings.EqualFold(claims.Subject, m.Email) {
+		if !strings.EqualFold(principal.Email, m.Email) {
 			respondWithMessage(w, "cannot update other merchants", http.StatusBadRequest)
 			return
 		}
 
-		err := f.mc.UpdateMerchant(r.Context(), m)
+		err = f.mc.UpdateMerchant(r.Context(), m)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed to update merchant: %v", err)
 			logrus.WithError(err).Error(errMsg)
@@ -72,22 +70,17 @@ func (f *MerchantHandlerFactory) BuildUpdateHandler() http.HandlerFunc {
 func (f *MerchantHandlerFactory) BuildDeleteHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		email := r.URL.Query().Get("email")
-		value := r.Context().Value(ClaimsCtxKey)
-		if value == nil {
-			respondWithMessage(w, "could not get token claims", http.StatusUnauthorized)
-			return
-		}
-		claims, ok := value.(jwt.StandardClaims)
-		if !ok {
-			respondWithMessage(w, "invalid token claims format", http.StatusUnauthorized)
+		principal, err := controllers.PrincipalFromContext(r.Context())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if !strings.EqualFold(claims.Subject, email) {
+		if !strings.EqualFold(principal.Email, email) {
 			respondWithMessage(w, "cannot delete other merchants", http.StatusBadRequest)
 			return
 		}
 
-		err := f.mc.DeleteMerchant(r.Context(), email)
+		err = f.mc.DeleteMerchant(r.Context(), email)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed to delete merchant: %v", err)
 			logrus.WithError(err).Error(errMsg)
@@ -101,16 +94,71 @@ func (f *MerchantHandlerFactory) BuildHTMLTemplateHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		merchants, err := f.mc.GetMerchants(r.Context())
 		if err != nil {
-			respondWithMessage(w, "cannot get merchants", http.StatusInternalServerError)
+			respondWithControllerError(w, "cannot get merchants", err)
+			return
+		}
+		transactions, err := f.queryAllTransactions(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "cannot get transactions", err)
+			return
 		}
-		transactions, err := f.tc.GetTransactions(r.Context())
+		disputes, err := f.dc.GetDisputes(r.Context())
 		if err != nil {
-			respondWithMessage(w, "cannot get merchants", http.StatusInternalServerError)
+			respondWithControllerError(w, "cannot get disputes", err)
+			return
 		}
-		viewData := views.NewMerchantsData(merchants, transactions)
+		viewData := views.NewMerchantsData(merchants, transactions, disputes)
 
 		if err := f.v.Render(w, viewData); err != nil {
 			respondWithMessage(w, "cannot parse HTML template", http.StatusInternalServerError)
 		}
 	}
 }
+
+// queryAllTransactions returns all transactions visible to the principal in ctx page by page
+func (f *MerchantHandlerFactory) queryAllTransactions(ctx context.Context) ([]*controllers.Transaction, error) {
+	var (
+		transactions []*controllers.Transaction
+		q            = &controllers.TransactionQuery{Limit: models.MaxTransactionQueryLimit}
+	)
+	for {
+		page, err := f.tc.QueryTransactions(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, page.Transactions...)
+		if page.NextCursor == "" {
+			return transactions, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (f *MerchantHandlerFactory) BuildRotateSigningSecretHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, err := f.mc.RotateSigningSecret(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "failed to rotate signing secret", err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, struct {
+			Secret string
+		}{Secret: secret})
+	}
+}
+
+func (f *MerchantHandlerFactory) BuildDeleteSigningSecretHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f.mc.DeleteSigningSecret(r.Context())
+		switch {
+		case errors.Is(err, models.ErrSigningSecretNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to delete signing secret", err)
+			return
+		}
+		respondWithMessage(w, "signing secret deleted", http.StatusOK)
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// respondWithReviewError responds with the status code matching an error returned while reviewing a transaction
+func respondWithReviewError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrTransactionNotFound):
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrTransactionNotPendingReview), errors.Is(err, models.ErrIllegalTransition),
+		errors.Is(err, models.ErrCaptureExceedsAuthorization), errors.Is(err, models.ErrRefundExceedsCharge),
+		errors.Is(err, models.ErrInvalidAmount), errors.Is(err, models.ErrCurrencyMismatch):
+		respondWithMessage(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		respondWithControllerError(w, message, err)
+	}
+}
+
+func (f *TransactionHandlerFactory) BuildGetReviewQueueHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ts, err := f.tc.GetReviewQueue(r.Context())
+		if err != nil {
+			respondWithReviewError(w, "failed to get review queue", err)
+			return
+		}
+		respondWithJSON(w, ts)
+	}
+}
+
+func (f *TransactionHandlerFactory) BuildApproveHandler() http.HandlerFunc {
+	return f.buildReviewHandler(f.tc.ApproveTransaction, "failed to approve transaction")
+}
+
+func (f *TransactionHandlerFactory) BuildDeclineHandler() http.HandlerFunc {
+	return f.buildReviewHandler(f.tc.DeclineTransaction, "failed to decline transaction")
+}
+
+func (f *TransactionHandlerFactory) buildReviewHandler(review func(ctx context.Context, uuid string) (*controllers.Transaction, error), message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := review(r.Context(), mux.Vars(r)[ReviewUUIDPathVar])
+		if err != nil {
+			respondWithReviewError(w, message, err)
+			return
+		}
+		respondWithJSON(w, t)
+	}
+}
@@ -11,34 +11,170 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/krasish/payment-system/internal/config"
 	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/jwks"
 )
 
-func CreateHTTPServer(cfg config.HttpConfig, tc *controllers.TransactionController, mc *controllers.MerchantController, v *views.View) (*http.Server, error) {
-	var (
-		mainRouter = mux.NewRouter()
-		jwtKey     = []byte(cfg.JwtKey)
-	)
+func CreateHTTPServer(cfg config.HttpConfig, tc *controllers.TransactionController, mc *controllers.MerchantController, uc *controllers.UserController, ac *controllers.AuthController, akc *controllers.APIKeyController, wc *controllers.WebhookController, dc *controllers.DisputeController, sc *controllers.SettlementController, fc *controllers.FeePlanController, lc *controllers.LimitsController, cc *controllers.CustomerController, keys *jwks.KeySet, v *views.View) (*http.Server, error) {
+	mainRouter := mux.NewRouter()
+	tokens, err := newTokenSettings(cfg, keys)
+	if err != nil {
+		return nil, err
+	}
+	authenticated := func(next http.HandlerFunc) http.HandlerFunc {
+		return authenticatedHandler(tokens, uc, akc, next)
+	}
+	signatures := newSignatureVerifier(mc, cfg.SignatureClockSkew)
+
+	//Auth handlers
+	authHandlerFactory := NewAuthHandlerFactory(ac, tokens)
+	tokenHandler := handlers.ContentTypeHandler(authHandlerFactory.BuildTokenHandler(), ContentTypeAppJSON).ServeHTTP
+
+	mainRouter.HandleFunc(cfg.AuthPath+"/token", tokenHandler).Methods(http.MethodPost)
 
 	//Transaction handlers
 	transactionHandlerFactory := NewTransactionHandlerFactory(tc)
 
-	getTransactionHandler := transactionHandlerFactory.BuildGetHandler()
-	createTransactionHandler := securedHandler(jwtKey, handlers.ContentTypeHandler(transactionHandlerFactory.BuildCreateHandler(), ContentTypeAppJSON).ServeHTTP)
+	getTransactionHandler := authenticated(transactionHandlerFactory.BuildGetHandler())
+	createTransactionHandler := authenticated(signatures.signedHandler(handlers.ContentTypeHandler(transactionHandlerFactory.BuildCreateHandler(), ContentTypeAppJSON).ServeHTTP))
+	getTransactionChainHandler := authenticated(transactionHandlerFactory.BuildGetChainHandler())
 
 	mainRouter.HandleFunc(cfg.TransactionPath, getTransactionHandler).Methods(http.MethodGet)
 	mainRouter.HandleFunc(cfg.TransactionPath, createTransactionHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(cfg.TransactionPath+"/{"+TransactionUUIDPathVar+"}", getTransactionChainHandler).Methods(http.MethodGet)
 
 	//Merchant handlers
-	merchantHandlerFactory := NewMerchantHandlerFactory(mc, tc, v)
+	merchantHandlerFactory := NewMerchantHandlerFactory(mc, tc, dc, v)
 
-	getMerchantHandler := merchantHandlerFactory.BuildGetHandler()
-	updateMerchantHandler := securedHandler(jwtKey, handlers.ContentTypeHandler(merchantHandlerFactory.BuildUpdateHandler(), ContentTypeAppJSON).ServeHTTP)
-	deleteMerchantHandler := securedHandler(jwtKey, merchantHandlerFactory.BuildDeleteHandler())
-	htmlTemplateHandler := merchantHandlerFactory.BuildHTMLTemplateHandler()
+	getMerchantHandler := authenticated(merchantHandlerFactory.BuildGetHandler())
+	updateMerchantHandler := authenticated(handlers.ContentTypeHandler(merchantHandlerFactory.BuildUpdateHandler(), ContentTypeAppJSON).ServeHTTP)
+	deleteMerchantHandler := authenticated(merchantHandlerFactory.BuildDeleteHandler())
+	rotateSigningSecretHandler := securedHandler(tokens, uc, signatures.signedHandler(merchantHandlerFactory.BuildRotateSigningSecretHandler()))
+	deleteSigningSecretHandler := securedHandler(tokens, uc, signatures.signedHandler(merchantHandlerFactory.BuildDeleteSigningSecretHandler()))
+	htmlTemplateHandler := authenticated(merchantHandlerFactory.BuildHTMLTemplateHandler())
 
 	mainRouter.HandleFunc(cfg.MerchantPath, getMerchantHandler).Methods(http.MethodGet)
 	mainRouter.HandleFunc(cfg.MerchantPath, updateMerchantHandler).Methods(http.MethodPut)
 	mainRouter.HandleFunc(cfg.MerchantPath, deleteMerchantHandler).Methods(http.MethodDelete)
+	mainRouter.HandleFunc(cfg.MerchantPath+cfg.SigningSecretPath, rotateSigningSecretHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(cfg.MerchantPath+cfg.SigningSecretPath, deleteSigningSecretHandler).Methods(http.MethodDelete)
+
+	//API key handlers
+	apiKeyHandlerFactory := NewAPIKeyHandlerFactory(akc)
+
+	getAPIKeysHandler := securedHandler(tokens, uc, apiKeyHandlerFactory.BuildGetHandler())
+	createAPIKeyHandler := securedHandler(tokens, uc, handlers.ContentTypeHandler(apiKeyHandlerFactory.BuildCreateHandler(), ContentTypeAppJSON).ServeHTTP)
+	revokeAPIKeyHandler := securedHandler(tokens, uc, apiKeyHandlerFactory.BuildRevokeHandler())
+
+	apiKeyPath := cfg.MerchantPath + cfg.APIKeyPath
+	mainRouter.HandleFunc(apiKeyPath, getAPIKeysHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(apiKeyPath, createAPIKeyHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(apiKeyPath+"/{"+APIKeyIDPathVar+"}", revokeAPIKeyHandler).Methods(http.MethodDelete)
+
+	//Webhook handlers
+	webhookHandlerFactory := NewWebhookHandlerFactory(wc)
+
+	getWebhooksHandler := authenticated(webhookHandlerFactory.BuildGetHandler())
+	createWebhookHandler := authenticated(handlers.ContentTypeHandler(webhookHandlerFactory.BuildCreateHandler(), ContentTypeAppJSON).ServeHTTP)
+	deleteWebhookHandler := authenticated(webhookHandlerFactory.BuildDeleteHandler())
+	getWebhookDeliveriesHandler := authenticated(webhookHandlerFactory.BuildGetDeliveriesHandler())
+	redeliverWebhookHandler := authenticated(webhookHandlerFactory.BuildRedeliverHandler())
+
+	webhookPath := cfg.MerchantPath + cfg.WebhookPath
+	mainRouter.HandleFunc(webhookPath, getWebhooksHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(webhookPath, createWebhookHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(webhookPath+"/delivery", getWebhookDeliveriesHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(webhookPath+"/delivery/{"+WebhookDeliveryIDPathVar+"}/redeliver", redeliverWebhookHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(webhookPath+"/{"+WebhookIDPathVar+"}", deleteWebhookHandler).Methods(http.MethodDelete)
+
+	//Admin handlers
+	userHandlerFactory := NewUserHandlerFactory(uc, mc, tc)
+	secureAdminHandler := func(next http.HandlerFunc) http.HandlerFunc {
+		return securedHandler(tokens, uc, adminOnly(next))
+	}
+
+	getUsersHandler := secureAdminHandler(userHandlerFactory.BuildGetHandler())
+	updateUserStatusHandler := secureAdminHandler(handlers.ContentTypeHandler(userHandlerFactory.BuildUpdateStatusHandler(), ContentTypeAppJSON).ServeHTTP)
+	getUserTransactionsHandler := secureAdminHandler(userHandlerFactory.BuildGetTransactionsHandler())
+
+	userEmailPath := cfg.UserPath + "/{" + UserEmailPathVar + "}"
+	mainRouter.HandleFunc(cfg.UserPath, getUsersHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(userEmailPath+"/status", updateUserStatusHandler).Methods(http.MethodPut)
+	mainRouter.HandleFunc(userEmailPath+cfg.TransactionPath, getUserTransactionsHandler).Methods(http.MethodGet)
+
+	//Fee plan handlers
+	feePlanHandlerFactory := NewFeePlanHandlerFactory(fc)
+
+	getOwnFeePlanHandler := authenticated(feePlanHandlerFactory.BuildGetOwnHandler())
+	getFeePlanHandler := secureAdminHandler(feePlanHandlerFactory.BuildGetHandler())
+	setFeePlanHandler := secureAdminHandler(handlers.ContentTypeHandler(feePlanHandlerFactory.BuildSetHandler(), ContentTypeAppJSON).ServeHTTP)
+	deleteFeePlanHandler := secureAdminHandler(feePlanHandlerFactory.BuildDeleteHandler())
+
+	mainRouter.HandleFunc(cfg.MerchantPath+cfg.FeePlanPath, getOwnFeePlanHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(userEmailPath+cfg.FeePlanPath, getFeePlanHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(userEmailPath+cfg.FeePlanPath, setFeePlanHandler).Methods(http.MethodPut)
+	mainRouter.HandleFunc(userEmailPath+cfg.FeePlanPath, deleteFeePlanHandler).Methods(http.MethodDelete)
+
+	//Limits handlers
+	limitsHandlerFactory := NewLimitsHandlerFactory(lc)
+
+	getLimitsHandler := secureAdminHandler(limitsHandlerFactory.BuildGetHandler())
+	setLimitsHandler := secureAdminHandler(handlers.ContentTypeHandler(limitsHandlerFactory.BuildSetHandler(), ContentTypeAppJSON).ServeHTTP)
+	deleteLimitsHandler := secureAdminHandler(limitsHandlerFactory.BuildDeleteHandler())
+
+	mainRouter.HandleFunc(userEmailPath+cfg.LimitsPath, getLimitsHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(userEmailPath+cfg.LimitsPath, setLimitsHandler).Methods(http.MethodPut)
+	mainRouter.HandleFunc(userEmailPath+cfg.LimitsPath, deleteLimitsHandler).Methods(http.MethodDelete)
+
+	//Customer handlers
+	customerHandlerFactory := NewCustomerHandlerFactory(cc)
+
+	getOwnCustomersHandler := authenticated(customerHandlerFactory.BuildGetOwnHandler())
+	getOwnCustomerHandler := authenticated(customerHandlerFactory.BuildGetOwnOneHandler())
+	getCustomersHandler := secureAdminHandler(customerHandlerFactory.BuildGetHandler())
+
+	mainRouter.HandleFunc(cfg.MerchantPath+cfg.CustomerPath, getOwnCustomersHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(cfg.MerchantPath+cfg.CustomerPath+"/{"+CustomerUUIDPathVar+"}", getOwnCustomerHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(userEmailPath+cfg.CustomerPath, getCustomersHandler).Methods(http.MethodGet)
+
+	//Dispute handlers
+	disputeHandlerFactory := NewDisputeHandlerFactory(dc)
+
+	getDisputesHandler := authenticated(disputeHandlerFactory.BuildGetHandler())
+	openDisputeHandler := secureAdminHandler(handlers.ContentTypeHandler(disputeHandlerFactory.BuildOpenHandler(), ContentTypeAppJSON).ServeHTTP)
+	getDisputeHandler := authenticated(disputeHandlerFactory.BuildGetOneHandler())
+	addDisputeEvidenceHandler := authenticated(handlers.ContentTypeHandler(disputeHandlerFactory.BuildAddEvidenceHandler(), ContentTypeAppJSON).ServeHTTP)
+	submitDisputeEvidenceHandler := authenticated(disputeHandlerFactory.BuildSubmitEvidenceHandler())
+	resolveDisputeHandler := secureAdminHandler(handlers.ContentTypeHandler(disputeHandlerFactory.BuildResolveHandler(), ContentTypeAppJSON).ServeHTTP)
+
+	disputeUUIDPath := cfg.DisputePath + "/{" + DisputeUUIDPathVar + "}"
+	mainRouter.HandleFunc(cfg.DisputePath, getDisputesHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(cfg.DisputePath, openDisputeHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(disputeUUIDPath, getDisputeHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(disputeUUIDPath+"/evidence", addDisputeEvidenceHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(disputeUUIDPath+"/submit", submitDisputeEvidenceHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(disputeUUIDPath+"/resolve", resolveDisputeHandler).Methods(http.MethodPost)
+
+	//Settlement handlers
+	settlementHandlerFactory := NewSettlementHandlerFactory(sc)
+
+	getPayoutBatchesHandler := authenticated(settlementHandlerFactory.BuildGetHandler())
+	getPayoutBatchHandler := authenticated(settlementHandlerFactory.BuildGetOneHandler())
+	getSettlementReportHandler := authenticated(settlementHandlerFactory.BuildReportHandler())
+
+	payoutBatchUUIDPath := cfg.SettlementPath + "/{" + PayoutBatchUUIDPathVar + "}"
+	mainRouter.HandleFunc(cfg.SettlementPath, getPayoutBatchesHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(payoutBatchUUIDPath, getPayoutBatchHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(payoutBatchUUIDPath+"/report", getSettlementReportHandler).Methods(http.MethodGet)
+
+	//Review handlers
+	getReviewQueueHandler := secureAdminHandler(transactionHandlerFactory.BuildGetReviewQueueHandler())
+	approveTransactionHandler := secureAdminHandler(transactionHandlerFactory.BuildApproveHandler())
+	declineTransactionHandler := secureAdminHandler(transactionHandlerFactory.BuildDeclineHandler())
+
+	reviewUUIDPath := cfg.ReviewPath + "/{" + ReviewUUIDPathVar + "}"
+	mainRouter.HandleFunc(cfg.ReviewPath, getReviewQueueHandler).Methods(http.MethodGet)
+	mainRouter.HandleFunc(reviewUUIDPath+"/approve", approveTransactionHandler).Methods(http.MethodPost)
+	mainRouter.HandleFunc(reviewUUIDPath+"/decline", declineTransactionHandler).Methods(http.MethodPost)
 
 	viewsRouter := mainRouter.PathPrefix(cfg.ViewsPath).Subrouter()
 	viewsRouter.HandleFunc(cfg.MerchantPath, htmlTemplateHandler)
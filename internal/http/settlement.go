@@ -0,0 +1,75 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/csv"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type SettlementHandlerFactory struct {
+	sc *controllers.SettlementController
+}
+
+func NewSettlementHandlerFactory(sc *controllers.SettlementController) *SettlementHandlerFactory {
+	return &SettlementHandlerFactory{sc: sc}
+}
+
+// respondWithSettlementError responds with the status code matching an error returned by the settlement controller
+func respondWithSettlementError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, models.ErrPayoutBatchNotFound) {
+		respondWithMessage(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respondWithControllerError(w, message, err)
+}
+
+func (f *SettlementHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batches, err := f.sc.GetPayoutBatches(r.Context())
+		if err != nil {
+			respondWithSettlementError(w, "failed to get payout batches", err)
+			return
+		}
+		respondWithJSON(w, batches)
+	}
+}
+
+func (f *SettlementHandlerFactory) BuildGetOneHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, err := f.sc.GetPayoutBatch(r.Context(), mux.Vars(r)[PayoutBatchUUIDPathVar])
+		if err != nil {
+			respondWithSettlementError(w, "failed to get payout batch", err)
+			return
+		}
+		respondWithJSON(w, batch)
+	}
+}
+
+// BuildReportHandler builds a handler which responds with the settlement report of a payout batch as a CSV attachment
+func (f *SettlementHandlerFactory) BuildReportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		batch, err := f.sc.GetPayoutBatch(r.Context(), mux.Vars(r)[PayoutBatchUUIDPathVar])
+		if err != nil {
+			respondWithSettlementError(w, "failed to get payout batch", err)
+			return
+		}
+		report := &bytes.Buffer{}
+		if err := csv.WriteSettlementReport(report, batch); err != nil {
+			respondWithControllerError(w, "failed to write settlement report", err)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeTextCSV)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "settlement-"+batch.UUID+".csv"))
+		if _, err := w.Write(report.Bytes()); err != nil {
+			logrus.Warnf("Failed to write settlement report: %v", err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krasish/payment-system/internal/common"
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+const (
+	// SignatureHeader carries the signature of a request in the t=<unix timestamp>,v1=<hex HMAC-SHA256> format
+	SignatureHeader = "X-Signature"
+	// maxSignedBodySize is the maximum size of the body of signed requests
+	maxSignedBodySize = 1 << 20
+)
+
+// parseSignatureHeader returns the timestamp and the signatures in a SignatureHeader value
+func parseSignatureHeader(header string) (int64, []string, error) {
+	var (
+		timestamp  int64
+		signatures []string
+		err        error
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			if timestamp, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, nil, fmt.Errorf("invalid signature timestamp %q", value)
+			}
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return 0, nil, fmt.Errorf("%s header must be in t=<timestamp>,v1=<signature> format", SignatureHeader)
+	}
+	return timestamp, signatures, nil
+}
+
+// nonceCache remembers the signatures seen within the clock skew window, so that replayed requests can be rejected
+type nonceCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	lastPurge time.Time
+}
+
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+// add records nonce and reports whether it has not been seen before
+func (c *nonceCache) add(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPurge) > c.ttl {
+		for n, expiresAt := range c.seen {
+			if now.After(expiresAt) {
+				delete(c.seen, n)
+			}
+		}
+		c.lastPurge = now
+	}
+	if expiresAt, ok := c.seen[nonce]; ok && !now.After(expiresAt) {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	return true
+}
+
+// signatureVerifier verifies the signatures of requests of merchants which have a signing secret
+type signatureVerifier struct {
+	mc     *controllers.MerchantController
+	skew   time.Duration
+	nonces *nonceCache
+}
+
+func newSignatureVerifier(mc *controllers.MerchantController, skew time.Duration) *signatureVerifier {
+	// a signature is accepted while its timestamp is within skew of now, i.e. for at most 2*skew
+	return &signatureVerifier{mc: mc, skew: skew, nonces: newNonceCache(2 * skew)}
+}
+
+// signedHandler requires requests of merchants with a signing secret to carry a valid SignatureHeader.
+// Requests of merchants without a signing secret are let through. It has to be wrapped by
+// securedHandler or authenticatedHandler.
+func (v *signatureVerifier) signedHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := controllers.PrincipalFromContext(r.Context())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		secret, err := v.mc.GetSigningSecret(r.Context())
+		if errors.Is(err, models.ErrSigningSecretNotFound) {
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			respondWithControllerError(w, "failed to get signing secret", err)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize+1))
+		if err != nil {
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxSignedBodySize {
+			respondWithMessage(w, "request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		signature, err := v.verify(secret, r.Header.Get(SignatureHeader), body, time.Now())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !v.nonces.add(principal.Email+":"+signature, time.Now()) {
+			respondWithMessage(w, "request has already been received", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// verify checks that header holds a signature of body with secret and a timestamp within
+// the clock skew window. It returns the matching signature.
+func (v *signatureVerifier) verify(secret, header string, body []byte, now time.Time) (string, error) {
+	if header == "" {
+		return "", fmt.Errorf("request must be signed in the %s header", SignatureHeader)
+	}
+	timestamp, signatures, err := parseSignatureHeader(header)
+	if err != nil {
+		return "", err
+	}
+	if diff := now.Sub(time.Unix(timestamp, 0)); diff > v.skew || diff < -v.skew {
+		return "", errors.New("signature timestamp is outside of the allowed clock skew")
+	}
+	expected := common.ComputeSignature(secret, timestamp, body)
+	for _, s := range signatures {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			return expected, nil
+		}
+	}
+	return "", errors.New("signature does not match request body")
+}
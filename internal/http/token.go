@@ -0,0 +1,175 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/krasish/payment-system/internal/config"
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/jwks"
+)
+
+// tokenSettings holds everything needed to issue and validate access tokens
+type tokenSettings struct {
+	// hmacKey is used for HS256 tokens or nil if HMAC tokens are not accepted
+	hmacKey []byte
+	// keys holds the public keys of RS256 and ES256 tokens, selected by kid
+	keys *jwks.KeySet
+
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	signingKeyID  string
+
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// newTokenSettings creates the token settings described by cfg. When a signing key is configured,
+// its public key is added to keys so that issued tokens are always accepted.
+func newTokenSettings(cfg config.HttpConfig, keys *jwks.KeySet) (tokenSettings, error) {
+	s := tokenSettings{
+		keys:          keys,
+		signingMethod: jwt.SigningMethodHS256,
+		signingKey:    []byte(cfg.JwtKey),
+		issuer:        cfg.JwtIssuer,
+		audience:      cfg.JwtAudience,
+		ttl:           cfg.AccessTokenTTL,
+	}
+	if cfg.JwtHMACEnabled {
+		if cfg.JwtKey == "" {
+			return tokenSettings{}, errors.New("a JWT key has to be configured when HMAC tokens are enabled")
+		}
+		s.hmacKey = []byte(cfg.JwtKey)
+	}
+	if cfg.JwtSigningKeyPath == "" {
+		if s.hmacKey == nil {
+			return tokenSettings{}, errors.New("either HMAC tokens have to be enabled or a JWT signing key has to be configured")
+		}
+		return s, nil
+	}
+
+	content, err := os.ReadFile(filepath.Clean(cfg.JwtSigningKeyPath))
+	if err != nil {
+		return tokenSettings{}, fmt.Errorf("while reading JWT signing key: %w", err)
+	}
+	signer, err := jwks.ParsePrivateKeyFromPEM(content)
+	if err != nil {
+		return tokenSettings{}, fmt.Errorf("while parsing JWT signing key: %w", err)
+	}
+	if cfg.JwtSigningKeyID == "" {
+		return tokenSettings{}, errors.New("JWT signing key ID is required together with a JWT signing key")
+	}
+	if s.signingMethod, err = signingMethodOf(signer); err != nil {
+		return tokenSettings{}, err
+	}
+	s.signingKey = signer
+	s.signingKeyID = cfg.JwtSigningKeyID
+	keys.AddStaticKey(cfg.JwtSigningKeyID, signer.Public())
+	return s, nil
+}
+
+func signingMethodOf(signer crypto.Signer) (jwt.SigningMethod, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return jwt.SigningMethodES256, nil
+		case 384:
+			return jwt.SigningMethodES384, nil
+		case 521:
+			return jwt.SigningMethodES512, nil
+		}
+	}
+	return nil, errors.New("unsupported JWT signing key")
+}
+
+// issue returns a signed access token for p
+func (s tokenSettings) issue(p *controllers.Principal) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   p.Email,
+			Issuer:    s.issuer,
+			Audience:  s.audience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.ttl).Unix(),
+		},
+		Role: string(p.Role),
+	}
+	token := jwt.NewWithClaims(s.signingMethod, claims)
+	if s.signingKeyID != "" {
+		token.Header["kid"] = s.signingKeyID
+	}
+	signed, err := token.SignedString(s.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("while signing access token: %w", err)
+	}
+	return signed, nil
+}
+
+// parse parses and validates bearerToken. Tokens must carry exp, iss and aud claims matching the settings.
+func (s tokenSettings) parse(bearerToken string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(bearerToken, claims, s.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiration time")
+	}
+	if !claims.VerifyIssuer(s.issuer, true) {
+		return nil, errors.New("token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(s.audience, true) {
+		return nil, errors.New("token has an unexpected audience")
+	}
+	return claims, nil
+}
+
+// verificationKey returns the key token has to be verified with. HMAC tokens are verified with
+// the HMAC key, while RSA and ECDSA tokens are verified with the key matching their kid header.
+func (s tokenSettings) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if s.hmacKey == nil {
+			return nil, errors.New("HMAC signed tokens are not accepted")
+		}
+		return s.hmacKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, alg, err := s.keys.Key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if alg != "" && alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q cannot be used with %s", kid, token.Method.Alg())
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q cannot be used with %s", kid, token.Method.Alg())
+}
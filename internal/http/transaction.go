@@ -2,15 +2,20 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
 )
 
 type TransactionHandlerFactory struct {
@@ -29,38 +34,127 @@ func (f *TransactionHandlerFactory) BuildCreateHandler() http.HandlerFunc {
 			respondWithMessage(w, "could not read request body", http.StatusInternalServerError)
 			return
 		}
-		value := r.Context().Value(ClaimsCtxKey)
-		if value == nil {
-			respondWithMessage(w, "could not get token claims", http.StatusUnauthorized)
-			return
-		}
-		claims, ok := value.(jwt.StandardClaims)
-		if !ok {
-			respondWithMessage(w, "invalid token claims format", http.StatusUnauthorized)
+		principal, err := controllers.PrincipalFromContext(r.Context())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if !strings.EqualFold(claims.Subject, t.MerchantEmail) {
+		if !strings.EqualFold(principal.Email, t.MerchantEmail) {
 			respondWithMessage(w, "cannot create transactions on behalf of other merchants", http.StatusBadRequest)
 			return
 		}
 
-		err := f.tc.CreateTransaction(r.Context(), t)
-		if err != nil {
+		resp, err := f.tc.CreateTransactionIdempotently(r.Context(), r.Header.Get(IdempotencyKeyHeader), t)
+		switch {
+		case errors.Is(err, models.ErrIdempotencyKeyReused), errors.Is(err, models.ErrDuplicateTransaction):
+			respondWithMessage(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, models.ErrTransactionNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, models.ErrInvalidAmount), errors.Is(err, models.ErrCaptureExceedsAuthorization),
+			errors.Is(err, models.ErrRefundExceedsCharge), errors.Is(err, models.ErrIllegalTransition),
+			errors.Is(err, models.ErrCurrencyMismatch), errors.Is(err, controllers.ErrDisputeTransactionType),
+			errors.Is(err, controllers.ErrTransactionStatus),
+			errors.Is(err, models.ErrLimitExceeded), errors.Is(err, models.ErrInvalidPhone):
+			respondWithMessage(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case err != nil:
 			errMsg := fmt.Sprintf("Failed to create transaction: %v", err)
 			logrus.WithError(err).Error(errMsg)
 			respondWithMessage(w, errMsg, http.StatusInternalServerError)
 			return
 		}
+
+		if resp.Replayed {
+			w.Header().Set(IdempotentReplayedHeader, "true")
+		}
+		respondWithBody(w, resp.Body, resp.StatusCode)
 	}
 }
 
 func (f *TransactionHandlerFactory) BuildGetHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		transactions, err := f.tc.GetTransactions(r.Context())
+		q, err := parseTransactionQuery(r.URL.Query())
 		if err != nil {
-			respondWithMessage(w, fmt.Sprintf("failed to get transactions: %v", err), http.StatusInternalServerError)
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := f.tc.QueryTransactions(r.Context(), q)
+		switch {
+		case errors.Is(err, controllers.ErrInvalidTransactionQuery), errors.Is(err, models.ErrInvalidCursor):
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to get transactions", err)
+			return
+		}
+		respondWithJSON(w, page)
+	}
+}
+
+func (f *TransactionHandlerFactory) BuildGetChainHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chain, err := f.tc.GetTransactionChain(r.Context(), mux.Vars(r)[TransactionUUIDPathVar])
+		switch {
+		case errors.Is(err, models.ErrTransactionNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
 			return
+		case err != nil:
+			respondWithControllerError(w, "failed to get transaction", err)
+			return
+		}
+		respondWithJSON(w, chain)
+	}
+}
+
+// parseTransactionQuery reads the transaction filters from query parameters.
+// Types and statuses can be passed either as repeated parameters or as comma separated lists.
+func parseTransactionQuery(values url.Values) (*controllers.TransactionQuery, error) {
+	var (
+		q = &controllers.TransactionQuery{
+			MerchantEmail: values.Get("merchant_email"),
+			CustomerEmail: values.Get("customer_email"),
+			Types:         splitQueryValues(values["type"]),
+			Statuses:      splitQueryValues(values["status"]),
+			Currency:      values.Get("currency"),
+			Sort:          values.Get("sort"),
+			Cursor:        values.Get("cursor"),
+		}
+		err error
+	)
+	for param, to := range map[string]*time.Time{"created_from": &q.CreatedFrom, "created_to": &q.CreatedTo} {
+		if v := values.Get(param); v != "" {
+			if *to, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+		}
+	}
+	for param, to := range map[string]**float64{"min_amount": &q.MinAmount, "max_amount": &q.MaxAmount} {
+		if v := values.Get(param); v != "" {
+			amount, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", param)
+			}
+			*to = &amount
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+	}
+	return q, nil
+}
+
+func splitQueryValues(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				res = append(res, part)
+			}
 		}
-		respondWithJSON(w, transactions)
 	}
+	return res
 }
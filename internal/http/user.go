@@ -0,0 +1,84 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// UserHandlerFactory builds the handlers of the admin API
+type UserHandlerFactory struct {
+	uc *controllers.UserController
+	mc *controllers.MerchantController
+	tc *controllers.TransactionController
+}
+
+func NewUserHandlerFactory(uc *controllers.UserController, mc *controllers.MerchantController, tc *controllers.TransactionController) *UserHandlerFactory {
+	return &UserHandlerFactory{uc: uc, mc: mc, tc: tc}
+}
+
+func (f *UserHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := f.uc.GetUsers(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "failed to get users", err)
+			return
+		}
+		respondWithJSON(w, users)
+	}
+}
+
+func (f *UserHandlerFactory) BuildUpdateStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Status string
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logrus.WithError(err).Error("Failed to read status from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		err := f.mc.UpdateMerchantStatus(r.Context(), mux.Vars(r)[UserEmailPathVar], body.Status)
+		switch {
+		case errors.Is(err, models.ErrMerchantNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, models.ErrInvalidEnumValue):
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to update merchant status", err)
+			return
+		}
+		respondWithMessage(w, "merchant status updated", http.StatusOK)
+	}
+}
+
+func (f *UserHandlerFactory) BuildGetTransactionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseTransactionQuery(r.URL.Query())
+		if err != nil {
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.MerchantEmail = mux.Vars(r)[UserEmailPathVar]
+
+		page, err := f.tc.QueryTransactions(r.Context(), q)
+		switch {
+		case errors.Is(err, controllers.ErrInvalidTransactionQuery), errors.Is(err, models.ErrInvalidCursor):
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to get transactions", err)
+			return
+		}
+		respondWithJSON(w, page)
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+type WebhookHandlerFactory struct {
+	wc *controllers.WebhookController
+}
+
+func NewWebhookHandlerFactory(wc *controllers.WebhookController) *WebhookHandlerFactory {
+	return &WebhookHandlerFactory{wc: wc}
+}
+
+func (f *WebhookHandlerFactory) BuildCreateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			URL string
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logrus.WithError(err).Error("Failed to read webhook endpoint from request body")
+			respondWithMessage(w, "could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		endpoint, err := f.wc.CreateEndpoint(r.Context(), body.URL)
+		switch {
+		case errors.Is(err, controllers.ErrInvalidWebhookURL):
+			respondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to create webhook endpoint", err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		respondWithJSON(w, endpoint)
+	}
+}
+
+func (f *WebhookHandlerFactory) BuildGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoints, err := f.wc.GetEndpoints(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "failed to get webhook endpoints", err)
+			return
+		}
+		respondWithJSON(w, endpoints)
+	}
+}
+
+func (f *WebhookHandlerFactory) BuildDeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)[WebhookIDPathVar], 10, 64)
+		if err != nil {
+			respondWithMessage(w, "webhook endpoint ID must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		err = f.wc.DeleteEndpoint(r.Context(), uint(id))
+		switch {
+		case errors.Is(err, models.ErrWebhookEndpointNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to delete webhook endpoint", err)
+			return
+		}
+		respondWithMessage(w, "webhook endpoint deleted", http.StatusOK)
+	}
+}
+
+func (f *WebhookHandlerFactory) BuildGetDeliveriesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deliveries, err := f.wc.GetDeliveries(r.Context())
+		if err != nil {
+			respondWithControllerError(w, "failed to get webhook deliveries", err)
+			return
+		}
+		respondWithJSON(w, deliveries)
+	}
+}
+
+func (f *WebhookHandlerFactory) BuildRedeliverHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)[WebhookDeliveryIDPathVar], 10, 64)
+		if err != nil {
+			respondWithMessage(w, "webhook delivery ID must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		err = f.wc.Redeliver(r.Context(), uint(id))
+		switch {
+		case errors.Is(err, models.ErrWebhookDeliveryNotFound):
+			respondWithMessage(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			respondWithControllerError(w, "failed to redeliver webhook", err)
+			return
+		}
+		respondWithMessage(w, "webhook delivery scheduled", http.StatusAccepted)
+	}
+}
@@ -0,0 +1,296 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+// PEMExtension is the extension of the public key files read from a PEM directory.
+// The name of a file without the extension is the ID of its key.
+const PEMExtension = ".pem"
+
+// ErrUnknownKeyID is returned when there is no valid key with the requested ID
+var ErrUnknownKeyID = errors.New("unknown key ID")
+
+type verificationKey struct {
+	key crypto.PublicKey
+	// alg is the algorithm the key is restricted to or empty if any algorithm matching the key type is allowed
+	alg string
+	// retiredAt is the time the key was first missing from its source or zero if the key is active
+	retiredAt time.Time
+}
+
+// KeySet holds the public keys used to verify JWT tokens, selected by their kid header.
+// Keys are read from a JWKS file and/or a directory of PEM files. When a key is removed from
+// its source it remains valid for the rotation overlap, so that tokens signed with it keep working.
+type KeySet struct {
+	jwksPath string
+	pemDir   string
+	overlap  time.Duration
+
+	mu     sync.RWMutex
+	keys   map[string]*verificationKey
+	static map[string]*verificationKey
+}
+
+// NewKeySet creates a KeySet and loads its keys. Empty jwksPath or pemDir disable the respective source.
+func NewKeySet(jwksPath, pemDir string, overlap time.Duration) (*KeySet, error) {
+	s := &KeySet{
+		jwksPath: jwksPath,
+		pemDir:   pemDir,
+		overlap:  overlap,
+		keys:     make(map[string]*verificationKey),
+		static:   make(map[string]*verificationKey),
+	}
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddStaticKey adds a key which is never removed by reloads, e.g. the public key of the application's own signing key
+func (s *KeySet) AddStaticKey(kid string, key crypto.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.static[kid] = &verificationKey{key: key}
+}
+
+// Key returns the key with kid together with the algorithm it is restricted to
+func (s *KeySet) Key(kid string) (crypto.PublicKey, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k, ok := s.static[kid]; ok {
+		return k.key, k.alg, nil
+	}
+	k, ok := s.keys[kid]
+	if !ok || s.expired(k, time.Now()) {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownKeyID, kid)
+	}
+	return k.key, k.alg, nil
+}
+
+func (s *KeySet) expired(k *verificationKey, now time.Time) bool {
+	return !k.retiredAt.IsZero() && now.Sub(k.retiredAt) >= s.overlap
+}
+
+// Load reads the keys from the sources. Keys missing from the sources are retired and
+// dropped once the rotation overlap has passed. On error the current keys are kept.
+func (s *KeySet) Load() error {
+	loaded := make(map[string]*verificationKey)
+	if s.jwksPath != "" {
+		if err := readJWKS(s.jwksPath, loaded); err != nil {
+			return err
+		}
+	}
+	if s.pemDir != "" {
+		if err := readPEMDir(s.pemDir, loaded); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for kid, old := range s.keys {
+		if _, ok := loaded[kid]; ok {
+			continue
+		}
+		if old.retiredAt.IsZero() {
+			logrus.Infof("JWT verification key %q was removed and remains valid for %s", kid, s.overlap)
+			old.retiredAt = now
+		}
+		if !s.expired(old, now) {
+			loaded[kid] = old
+		}
+	}
+	s.keys = loaded
+	return nil
+}
+
+// GetPeriodicJobReloader returns a job which reloads the keys every jobExecutionInterval
+func (s *KeySet) GetPeriodicJobReloader(jobExecutionInterval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Load(); err != nil {
+					logrus.Warnf("periodic JWT verification keys reload failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func readJWKS(path string, into map[string]*verificationKey) error {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("while reading JWKS from %q: %w", path, err)
+	}
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return fmt.Errorf("while parsing JWKS from %q: %w", path, err)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Kid == "" {
+			return fmt.Errorf("JWKS from %q contains a key without kid", path)
+		}
+		var key crypto.PublicKey
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaPublicKey()
+		case "EC":
+			key, err = jwk.ecPublicKey()
+		default:
+			logrus.Warnf("Skipping JWKS key %q of unsupported type %q", jwk.Kid, jwk.Kty)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("while parsing JWKS key %q: %w", jwk.Kid, err)
+		}
+		if err := addKey(into, jwk.Kid, &verificationKey{key: key, alg: jwk.Alg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent is too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("value is empty")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func readPEMDir(dir string, into map[string]*verificationKey) error {
+	paths, err := filepath.Glob(filepath.Join(filepath.Clean(dir), "*"+PEMExtension))
+	if err != nil {
+		return fmt.Errorf("while listing PEM files in %q: %w", dir, err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("while reading PEM file %q: %w", path, err)
+		}
+		key, err := ParsePublicKeyFromPEM(content)
+		if err != nil {
+			return fmt.Errorf("while parsing PEM file %q: %w", path, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), PEMExtension)
+		if err := addKey(into, kid, &verificationKey{key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addKey(into map[string]*verificationKey, kid string, k *verificationKey) error {
+	if _, ok := into[kid]; ok {
+		return fmt.Errorf("duplicate key ID %q", kid)
+	}
+	into[kid] = k
+	return nil
+}
+
+// ParsePublicKeyFromPEM parses an RSA or ECDSA public key or certificate
+func ParsePublicKeyFromPEM(content []byte) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("content is neither an RSA nor an ECDSA public key")
+}
+
+// ParsePrivateKeyFromPEM parses an RSA or ECDSA private key
+func ParsePrivateKeyFromPEM(content []byte) (crypto.Signer, error) {
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("content is neither an RSA nor an ECDSA private key")
+}
@@ -0,0 +1,233 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaJWK(t *testing.T, kid, alg string) (jsonWebKey, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonWebKey{Kty: "RSA", Kid: kid, Alg: alg, Use: "sig", N: encodeBigInt(key.N), E: encodeBigInt(big.NewInt(int64(key.E)))}, &key.PublicKey
+}
+
+func ecJWK(t *testing.T, kid string) (jsonWebKey, *ecdsa.PublicKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: encodeBigInt(key.X), Y: encodeBigInt(key.Y)}, &key.PublicKey
+}
+
+func writeJWKS(t *testing.T, path string, keys ...jsonWebKey) {
+	t.Helper()
+	content, err := json.Marshal(map[string][]jsonWebKey{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePEM(t *testing.T, path string) *ecdsa.PublicKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &key.PublicKey
+}
+
+func TestKeySetParsesJWKSAndPEMKeys(t *testing.T) {
+	dir := t.TempDir()
+	jwksPath := filepath.Join(dir, "jwks.json")
+	pemDir := filepath.Join(dir, "pem")
+	if err := os.Mkdir(pemDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, rsaPublic := rsaJWK(t, "rsa", "RS256")
+	ecKey, ecPublic := ecJWK(t, "ec")
+	encryption, _ := rsaJWK(t, "encryption", "")
+	encryption.Use = "enc"
+	writeJWKS(t, jwksPath, rsaKey, ecKey, encryption)
+	pemPublic := writePEM(t, filepath.Join(pemDir, "pem"+PEMExtension))
+
+	s, err := NewKeySet(jwksPath, pemDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kid, expected := range map[string]interface{ Equal(crypto.PublicKey) bool }{"rsa": rsaPublic, "ec": ecPublic, "pem": pemPublic} {
+		key, _, err := s.Key(kid)
+		if err != nil {
+			t.Fatalf("key %q: %v", kid, err)
+		}
+		if !expected.Equal(key) {
+			t.Errorf("key %q does not match the key in its source", kid)
+		}
+	}
+	if _, _, err := s.Key("encryption"); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("expected keys which are not used for signatures to be skipped, got %v", err)
+	}
+}
+
+func TestKeySetRestrictsKeysToTheirAlgorithm(t *testing.T) {
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	restricted, _ := rsaJWK(t, "restricted", "RS256")
+	unrestricted, _ := ecJWK(t, "unrestricted")
+	writeJWKS(t, jwksPath, restricted, unrestricted)
+
+	s, err := NewKeySet(jwksPath, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, alg, err := s.Key("restricted"); err != nil || alg != "RS256" {
+		t.Errorf("expected key restricted to RS256, got %q, %v", alg, err)
+	}
+	if _, alg, err := s.Key("unrestricted"); err != nil || alg != "" {
+		t.Errorf("expected unrestricted key, got %q, %v", alg, err)
+	}
+}
+
+func TestKeySetRejectsInvalidSources(t *testing.T) {
+	dir := t.TempDir()
+	jwksPath := filepath.Join(dir, "jwks.json")
+
+	withoutKid, _ := ecJWK(t, "")
+	writeJWKS(t, jwksPath, withoutKid)
+	if _, err := NewKeySet(jwksPath, "", time.Hour); err == nil {
+		t.Error("expected a key without kid to be rejected")
+	}
+
+	offCurve, _ := ecJWK(t, "off-curve")
+	offCurve.Y = encodeBigInt(big.NewInt(1))
+	writeJWKS(t, jwksPath, offCurve)
+	if _, err := NewKeySet(jwksPath, "", time.Hour); err == nil {
+		t.Error("expected a point which is not on the curve to be rejected")
+	}
+
+	duplicate, _ := ecJWK(t, "duplicate")
+	writeJWKS(t, jwksPath, duplicate, duplicate)
+	if _, err := NewKeySet(jwksPath, "", time.Hour); err == nil {
+		t.Error("expected duplicate key IDs to be rejected")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "invalid"+PEMExtension), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeySet("", dir, time.Hour); err == nil {
+		t.Error("expected an invalid PEM file to be rejected")
+	}
+}
+
+func TestKeySetRetiresRemovedKeysAfterTheOverlap(t *testing.T) {
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	old, _ := ecJWK(t, "old")
+	current, _ := ecJWK(t, "current")
+	writeJWKS(t, jwksPath, old, current)
+	s, err := NewKeySet(jwksPath, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeJWKS(t, jwksPath, current)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Key("old"); err != nil {
+		t.Errorf("expected removed key to remain valid during the overlap, got %v", err)
+	}
+
+	// the overlap passes
+	s.keys["old"].retiredAt = time.Now().Add(-time.Hour)
+	if _, _, err := s.Key("old"); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("expected removed key to be invalid after the overlap, got %v", err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.keys["old"]; ok {
+		t.Error("expected expired key to be dropped on reload")
+	}
+	if _, _, err := s.Key("current"); err != nil {
+		t.Errorf("expected current key to remain valid, got %v", err)
+	}
+}
+
+func TestKeySetReactivatesReAddedKeys(t *testing.T) {
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	key, _ := ecJWK(t, "key")
+	writeJWKS(t, jwksPath, key)
+	s, err := NewKeySet(jwksPath, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeJWKS(t, jwksPath)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if s.keys["key"].retiredAt.IsZero() {
+		t.Fatal("expected removed key to be retired")
+	}
+
+	writeJWKS(t, jwksPath, key)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.keys["key"].retiredAt.IsZero() {
+		t.Error("expected re-added key to be active again")
+	}
+
+	// a key removed again gets the whole overlap again
+	writeJWKS(t, jwksPath)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if retiredAt := s.keys["key"].retiredAt; time.Since(retiredAt) > time.Minute {
+		t.Errorf("expected key to be retired just now, got %s", retiredAt)
+	}
+}
+
+func TestKeySetPrefersStaticKeys(t *testing.T) {
+	s, err := NewKeySet("", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, public := ecJWK(t, "static")
+	s.AddStaticKey("static", public)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if key, _, err := s.Key("static"); err != nil || !public.Equal(key) {
+		t.Errorf("expected static key to survive reloads, got %v", err)
+	}
+}
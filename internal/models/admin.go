@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrAdminNotFound is returned when there is no admin with the requested email
+var ErrAdminNotFound = errors.New("admin not found")
+
+type Admin struct {
+	UserID uint `gorm:"primaryKey"`
+	User   User
+
+	Email string
+}
+
+func NewAdmin(email string, status UserStatus) (*Admin, error) {
+	_, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, fmt.Errorf("while creating admin: %q is not a valid email address: %w", email, err)
+	}
+	return &Admin{Email: strings.ToLower(email), User: User{
+		Role:   RoleAdmin,
+		Status: status,
+	}}, nil
+}
+
+// UserIdentity is a user together with the email of the merchant or admin it belongs to
+type UserIdentity struct {
+	User
+	Email string
+}
+
+func (s *UserStore) CreateAdmin(ctx context.Context, a *Admin) error {
+	return createSingleGorm(ctx, a, s.db)
+}
+
+func (s *UserStore) CreateAdmins(ctx context.Context, as []*Admin) error {
+	return createMultipleGorm(ctx, as, s.db)
+}
+
+func (s *UserStore) GetAdminByEmail(ctx context.Context, email string) (*Admin, error) {
+	var a Admin
+	err := s.db.WithContext(ctx).Model(&Admin{}).Where("email = ?", strings.ToLower(email)).Preload("User").First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAdminNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("while getting admin: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAllUserIdentities returns all users together with the email of the merchant or admin they belong to
+func (s *UserStore) GetAllUserIdentities(ctx context.Context) ([]*UserIdentity, error) {
+	var us []*UserIdentity
+	err := userIdentities(s.db.WithContext(ctx)).Order(UserTableName + ".id").Scan(&us).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting user identities: %w", err)
+	}
+	return us, nil
+}
@@ -0,0 +1,93 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const AdminTestSchemaName = "payment_system_admin_test"
+
+var _ = Describe("Using NewAdmin", func() {
+	It("creates admin without error for correct values", func() {
+		admin, err := models.NewAdmin("Admin@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(admin.Email).To(Equal("admin@abv.bg"))
+		Expect(admin.User.Role).To(Equal(models.RoleAdmin))
+	})
+	It("fails to create admin when email is wrong", func() {
+		_, err := models.NewAdmin("www.google.com", models.StatusActive)
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Using UserStore for admins", func() {
+	var (
+		userStore     *models.UserStore
+		merchantStore *models.MerchantStore
+		err           error
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, AdminTestSchemaName))
+		Expect(err).To(BeNil())
+
+		userStore = models.NewUserStore(gormDB)
+		merchantStore = models.NewMerchantStore(gormDB)
+	})
+
+	It("creates admins and gets them by email", func() {
+		active, err := models.NewAdmin(uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		inactive, err := models.NewAdmin(uuid.Generate().String()+"@abv.bg", models.StatusInactive)
+		Expect(err).To(BeNil())
+		err = userStore.CreateAdmins(context.Background(), []*models.Admin{active, inactive})
+		Expect(err).To(BeNil())
+
+		returned, err := userStore.GetAdminByEmail(context.Background(), active.Email)
+		Expect(err).To(BeNil())
+		Expect(returned.UserID).To(Equal(active.UserID))
+		Expect(returned.User.Status).To(Equal(models.StatusActive))
+
+		_, err = userStore.GetAdminByEmail(context.Background(), "missing@abv.bg")
+		Expect(err).To(MatchError(models.ErrAdminNotFound))
+	})
+
+	It("lists users together with their emails", func() {
+		admin, err := models.NewAdmin(uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(userStore.CreateAdmin(context.Background(), admin)).To(Succeed())
+		merchant, err := models.NewMerchant("Listed Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+
+		users, err := userStore.GetAllUserIdentities(context.Background())
+		Expect(err).To(BeNil())
+		emails := make(map[uint]string, len(users))
+		for _, u := range users {
+			emails[u.ID] = u.Email
+		}
+		Expect(emails).To(HaveKeyWithValue(admin.UserID, admin.Email))
+		Expect(emails).To(HaveKeyWithValue(merchant.UserID, merchant.Email))
+	})
+
+	It("activates and deactivates merchants", func() {
+		merchant, err := models.NewMerchant("Status Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+
+		err = merchantStore.UpdateMerchantStatus(context.Background(), merchant.Email, models.StatusInactive)
+		Expect(err).To(BeNil())
+		returned, err := merchantStore.GetMerchantByEmail(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(returned.User.Status).To(Equal(models.StatusInactive))
+
+		err = merchantStore.UpdateMerchantStatus(context.Background(), "missing@abv.bg", models.StatusActive)
+		Expect(err).To(MatchError(models.ErrMerchantNotFound))
+	})
+})
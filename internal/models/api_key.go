@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix starts every API key so that keys are easy to recognize
+	APIKeyPrefix = "psk_"
+	// apiKeyPrefixBytes is the number of random bytes in the identifying prefix of an API key
+	apiKeyPrefixBytes = 4
+	// apiKeySecretBytes is the number of random bytes in the secret part of an API key
+	apiKeySecretBytes = 32
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when a merchant has no API key with the requested ID
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKey is returned when an API key does not exist, has expired or has been revoked
+	ErrInvalidAPIKey = errors.New("API key is invalid, expired or revoked")
+)
+
+// APIKey is a long-lived credential of a merchant. Only the SHA-256 hash of the key is stored
+// together with its Prefix, which identifies the key without revealing it.
+type APIKey struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	MerchantID uint
+	Name       string
+	Prefix     string
+	KeyHash    string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// newAPIKey returns a new API key of the merchant with merchantID together with the key itself,
+// which has the form psk_<prefix>_<secret>
+func newAPIKey(merchantID uint, name string, expiresAt *time.Time) (*APIKey, string, error) {
+	prefixBytes := make([]byte, apiKeyPrefixBytes)
+	secretBytes := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return nil, "", fmt.Errorf("while generating API key: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", fmt.Errorf("while generating API key: %w", err)
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(prefixBytes)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return &APIKey{
+		MerchantID: merchantID,
+		Name:       name,
+		Prefix:     prefix,
+		KeyHash:    hashAPIKey(key),
+		ExpiresAt:  expiresAt,
+	}, key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+// CreateAPIKey creates an API key for the merchant with merchantEmail and returns it together with the key itself.
+// The key cannot be retrieved afterwards.
+func (s *APIKeyStore) CreateAPIKey(ctx context.Context, merchantEmail, name string, expiresAt *time.Time) (*APIKey, string, error) {
+	m := Merchant{}
+	res := s.db.WithContext(ctx).Model(&Merchant{}).Where("email = ?", strings.ToLower(merchantEmail)).First(&m)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, "", ErrMerchantNotFound
+	} else if err := res.Error; err != nil {
+		return nil, "", fmt.Errorf("while getting merchant of API key: %w", err)
+	}
+
+	apiKey, key, err := newAPIKey(m.UserID, name, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.db.WithContext(ctx).Create(apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("while creating API key: %w", err)
+	}
+	return apiKey, key, nil
+}
+
+// GetAPIKeys returns all API keys of the merchant with merchantEmail, including revoked and expired ones
+func (s *APIKeyStore) GetAPIKeys(ctx context.Context, merchantEmail string) ([]*APIKey, error) {
+	var keys []*APIKey
+	err := s.db.WithContext(ctx).
+		Where("merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", strings.ToLower(merchantEmail)).
+		Order("id").Find(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with id of the merchant with merchantEmail
+func (s *APIKeyStore) RevokeAPIKey(ctx context.Context, merchantEmail string, id uint) error {
+	res := s.db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", id, strings.ToLower(merchantEmail)).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now())
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while revoking API key: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the merchant user which key belongs to and records that the key has been used
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string) (*UserIdentity, error) {
+	var (
+		apiKey = APIKey{}
+		now    = time.Now()
+	)
+	res := s.db.WithContext(ctx).
+		Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", hashAPIKey(key), now).
+		Limit(1).Find(&apiKey)
+	if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting API key: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.db.WithContext(ctx).Model(&apiKey).Update("last_used_at", now).Error; err != nil {
+		return nil, fmt.Errorf("while updating last usage of API key: %w", err)
+	}
+	return getUserIdentity(s.db.WithContext(ctx), UserTableName+".id = ?", apiKey.MerchantID)
+}
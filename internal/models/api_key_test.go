@@ -0,0 +1,77 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const APIKeyTestSchemaName = "payment_system_api_key_test"
+
+var _ = Describe("Using APIKeyStore", func() {
+	var (
+		apiKeyStore *models.APIKeyStore
+		merchant    *models.Merchant
+		err         error
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, APIKeyTestSchemaName))
+		Expect(err).To(BeNil())
+
+		apiKeyStore = models.NewAPIKeyStore(gormDB)
+		merchant, err = models.NewMerchant("API Key Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(models.NewMerchantStore(gormDB).CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("creates API keys which authenticate their merchant", func() {
+		apiKey, key, err := apiKeyStore.CreateAPIKey(context.Background(), merchant.Email, "backend", nil)
+		Expect(err).To(BeNil())
+		Expect(strings.HasPrefix(key, apiKey.Prefix+"_")).To(BeTrue())
+		Expect(apiKey.KeyHash).NotTo(ContainSubstring(key))
+
+		user, err := apiKeyStore.Authenticate(context.Background(), key)
+		Expect(err).To(BeNil())
+		Expect(user.ID).To(Equal(merchant.UserID))
+		Expect(user.Email).To(Equal(merchant.Email))
+
+		keys, err := apiKeyStore.GetAPIKeys(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0].Prefix).To(Equal(apiKey.Prefix))
+		Expect(keys[0].LastUsedAt).NotTo(BeNil())
+	})
+
+	It("does not authenticate unknown, revoked or expired API keys", func() {
+		_, err = apiKeyStore.Authenticate(context.Background(), models.APIKeyPrefix+"unknown")
+		Expect(err).To(MatchError(models.ErrInvalidAPIKey))
+
+		apiKey, key, err := apiKeyStore.CreateAPIKey(context.Background(), merchant.Email, "revoked", nil)
+		Expect(err).To(BeNil())
+		Expect(apiKeyStore.RevokeAPIKey(context.Background(), merchant.Email, apiKey.ID)).To(Succeed())
+		_, err = apiKeyStore.Authenticate(context.Background(), key)
+		Expect(err).To(MatchError(models.ErrInvalidAPIKey))
+		Expect(apiKeyStore.RevokeAPIKey(context.Background(), merchant.Email, apiKey.ID)).To(MatchError(models.ErrAPIKeyNotFound))
+
+		expiresAt := time.Now().Add(-time.Minute)
+		_, key, err = apiKeyStore.CreateAPIKey(context.Background(), merchant.Email, "expired", &expiresAt)
+		Expect(err).To(BeNil())
+		_, err = apiKeyStore.Authenticate(context.Background(), key)
+		Expect(err).To(MatchError(models.ErrInvalidAPIKey))
+	})
+
+	It("does not revoke API keys of other merchants", func() {
+		apiKey, _, err := apiKeyStore.CreateAPIKey(context.Background(), merchant.Email, "backend", nil)
+		Expect(err).To(BeNil())
+		err = apiKeyStore.RevokeAPIKey(context.Background(), "other@abv.bg", apiKey.ID)
+		Expect(err).To(MatchError(models.ErrAPIKeyNotFound))
+	})
+})
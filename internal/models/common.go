@@ -2,12 +2,23 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+const (
+	pgUniqueViolationCode     = "23505"
+	pgForeignKeyViolationCode = "23503"
+)
+
+// ErrInvalidEnumValue is returned when a string is not one of the values of an enum
+var ErrInvalidEnumValue = errors.New("invalid enum value")
+
 type EnumsConstraint interface {
-	UserRole | UserStatus | TransactionType | TransactionStatus
+	UserRole | UserStatus | TransactionType | TransactionStatus | LedgerAccountType | DisputeStatus | RefundFeePolicy | RiskDecision
 }
 
 func enumFactory[T EnumsConstraint](s string, possibleValues ...T) (T, error) {
@@ -21,7 +32,7 @@ func enumFactory[T EnumsConstraint](s string, possibleValues ...T) (T, error) {
 			return value, nil
 		}
 	}
-	return T(""), fmt.Errorf("%q is not a possible value for type %T", s, possibleValues[0])
+	return T(""), fmt.Errorf("%q is not a possible value for type %T: %w", s, possibleValues[0], ErrInvalidEnumValue)
 }
 
 func scanEnumValue[T EnumsConstraint](to *T, value any) error {
@@ -36,8 +47,19 @@ func scanEnumValue[T EnumsConstraint](to *T, value any) error {
 	return nil
 }
 
+// pgConstraintViolation reports whether err was caused by a violation of the
+// passed postgres error code. If constraint is not empty, the name of the
+// violated constraint must match it as well.
+func pgConstraintViolation(err error, code, constraint string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != code {
+		return false
+	}
+	return constraint == "" || pgErr.ConstraintName == constraint
+}
+
 type TypesConstraint interface {
-	User | Transaction | Merchant
+	User | Transaction | Merchant | Admin
 }
 
 func createSingleGorm[T TypesConstraint](ctx context.Context, entity *T, db *gorm.DB) error {
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MinPasswordLength = 8
+	// refreshTokenBytes is the number of random bytes in a refresh token
+	refreshTokenBytes = 32
+)
+
+var (
+	// ErrInvalidCredentials is returned when an email and password pair does not match an active user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidRefreshToken is returned when a refresh token does not exist, has expired or has been revoked
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+	// ErrUserNotFound is returned when there is no user with the requested email
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// HashPassword returns the bcrypt hash of password, which is stored as User.PasswordHash
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("while hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the password of u. Users without a password never match.
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// RefreshToken is a long-lived token which can be exchanged for a new access token once.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	UserID    uint
+	TokenHash string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+func newRefreshToken(userID uint, ttl time.Duration) (*RefreshToken, string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("while generating refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return &RefreshToken{UserID: userID, TokenHash: hashRefreshToken(token), ExpiresAt: time.Now().Add(ttl)}, token, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func userIdentities(db *gorm.DB) *gorm.DB {
+	return db.Table(UserTableName).
+		Select(UserTableName + ".*, COALESCE(admin.email, merchant.email, '') AS email").
+		Joins("LEFT JOIN admin ON admin.user_id = " + UserTableName + ".id").
+		Joins("LEFT JOIN merchant ON merchant.user_id = " + UserTableName + ".id")
+}
+
+func getUserIdentity(db *gorm.DB, condition string, arg any) (*UserIdentity, error) {
+	var us []*UserIdentity
+	if err := userIdentities(db).Where(condition, arg).Limit(1).Scan(&us).Error; err != nil {
+		return nil, fmt.Errorf("while getting user identity: %w", err)
+	}
+	if len(us) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return us[0], nil
+}
+
+func (s *UserStore) GetUserIdentityByEmail(ctx context.Context, email string) (*UserIdentity, error) {
+	return getUserIdentity(s.db.WithContext(ctx), "COALESCE(admin.email, merchant.email) = ?", strings.ToLower(email))
+}
+
+// SetPassword stores the hash of password as the password of the user with email
+func (s *UserStore) SetPassword(ctx context.Context, email, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u, err := s.GetUserIdentityByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	res := s.db.WithContext(ctx).Model(&User{}).Where("id = ?", u.ID).Update("password_hash", hash)
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while setting password: %w", err)
+	}
+	return nil
+}
+
+// CreateRefreshToken creates a refresh token for the user with userID, valid for ttl
+func (s *UserStore) CreateRefreshToken(ctx context.Context, userID uint, ttl time.Duration) (string, error) {
+	rt, token, err := newRefreshToken(userID, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.WithContext(ctx).Create(rt).Error; err != nil {
+		return "", fmt.Errorf("while creating refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken revokes token and creates a new refresh token, valid for ttl, for the same user.
+// It returns the user the token belongs to together with the new token.
+func (s *UserStore) RotateRefreshToken(ctx context.Context, token string, ttl time.Duration) (*UserIdentity, string, error) {
+	var (
+		user     *UserIdentity
+		newToken string
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rt := &RefreshToken{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", hashRefreshToken(token), time.Now()).
+			Limit(1).Find(rt)
+		if err := res.Error; err != nil {
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidRefreshToken
+		}
+		if err := tx.Model(rt).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		created, t, err := newRefreshToken(rt.UserID, ttl)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(created).Error; err != nil {
+			return err
+		}
+		if user, err = getUserIdentity(tx, UserTableName+".id = ?", rt.UserID); err != nil {
+			return err
+		}
+		newToken = t
+		return nil
+	})
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil, "", err
+	} else if err != nil {
+		return nil, "", fmt.Errorf("while rotating refresh token: %w", err)
+	}
+	return user, newToken, nil
+}
@@ -0,0 +1,98 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const CredentialsTestSchemaName = "payment_system_credentials_test"
+
+var _ = Describe("Using HashPassword", func() {
+	It("hashes passwords which can be checked afterwards", func() {
+		hash, err := models.HashPassword("correct-password")
+		Expect(err).To(BeNil())
+		Expect(hash).NotTo(Equal("correct-password"))
+
+		user := models.User{PasswordHash: hash}
+		Expect(user.CheckPassword("correct-password")).To(BeTrue())
+		Expect(user.CheckPassword("wrong-password")).To(BeFalse())
+	})
+	It("fails for short passwords", func() {
+		_, err := models.HashPassword("short")
+		Expect(err).NotTo(BeNil())
+	})
+	It("never matches users without password", func() {
+		user := models.User{}
+		Expect(user.CheckPassword("")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Using UserStore for credentials", func() {
+	var (
+		userStore *models.UserStore
+		merchant  *models.Merchant
+		err       error
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, CredentialsTestSchemaName))
+		Expect(err).To(BeNil())
+
+		userStore = models.NewUserStore(gormDB)
+		merchantStore := models.NewMerchantStore(gormDB)
+		merchant, err = models.NewMerchant("Credentials Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		merchant.User.PasswordHash, err = models.HashPassword("merchant-password")
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("gets user identities with password hashes by email", func() {
+		identity, err := userStore.GetUserIdentityByEmail(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(identity.ID).To(Equal(merchant.UserID))
+		Expect(identity.Role).To(Equal(models.RoleMerchant))
+		Expect(identity.CheckPassword("merchant-password")).To(BeTrue())
+
+		_, err = userStore.GetUserIdentityByEmail(context.Background(), "missing@abv.bg")
+		Expect(err).To(MatchError(models.ErrUserNotFound))
+	})
+
+	It("sets passwords", func() {
+		Expect(userStore.SetPassword(context.Background(), merchant.Email, "another-password")).To(Succeed())
+		identity, err := userStore.GetUserIdentityByEmail(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(identity.CheckPassword("another-password")).To(BeTrue())
+		Expect(identity.CheckPassword("merchant-password")).To(BeFalse())
+	})
+
+	It("rotates refresh tokens only once", func() {
+		token, err := userStore.CreateRefreshToken(context.Background(), merchant.UserID, time.Hour)
+		Expect(err).To(BeNil())
+
+		identity, rotated, err := userStore.RotateRefreshToken(context.Background(), token, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(identity.Email).To(Equal(merchant.Email))
+		Expect(rotated).NotTo(Equal(token))
+
+		_, _, err = userStore.RotateRefreshToken(context.Background(), token, time.Hour)
+		Expect(err).To(MatchError(models.ErrInvalidRefreshToken))
+		_, _, err = userStore.RotateRefreshToken(context.Background(), rotated, time.Hour)
+		Expect(err).To(BeNil())
+	})
+
+	It("does not rotate expired refresh tokens", func() {
+		token, err := userStore.CreateRefreshToken(context.Background(), merchant.UserID, -time.Minute)
+		Expect(err).To(BeNil())
+
+		_, _, err = userStore.RotateRefreshToken(context.Background(), token, time.Hour)
+		Expect(err).To(MatchError(models.ErrInvalidRefreshToken))
+	})
+})
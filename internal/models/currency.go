@@ -1,5 +1,12 @@
 package models
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
 type Currency uint64
 
 // ToCurrency converts a float64 to Currency
@@ -14,3 +21,78 @@ func (m Currency) Float64() float64 {
 	x = x / 100
 	return x
 }
+
+// CurrencyCode is an ISO 4217 currency code
+type CurrencyCode string
+
+const DefaultCurrencyCode CurrencyCode = "USD"
+
+// minorUnits holds the number of decimal places of each supported currency
+var minorUnits = map[CurrencyCode]int{
+	"AUD": 2, "BGN": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "HUF": 2, "INR": 2, "NOK": 2, "PLN": 2, "RON": 2, "SEK": 2, "TRY": 2, "USD": 2,
+	"ISK": 0, "JPY": 0, "KRW": 0,
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+}
+
+func NewCurrencyCode(s string) (CurrencyCode, error) {
+	code := CurrencyCode(strings.ToUpper(s))
+	if !code.Valid() {
+		return "", fmt.Errorf("%q is not a supported ISO 4217 currency code", s)
+	}
+	return code, nil
+}
+
+// Valid reports whether c is a supported currency code
+func (c CurrencyCode) Valid() bool {
+	_, ok := minorUnits[c]
+	return ok
+}
+
+// MinorUnits returns the number of decimal places used by c
+func (c CurrencyCode) MinorUnits() int {
+	return minorUnits[c]
+}
+
+// ToCurrency converts a float64 amount in c to Currency in the minor units of c
+// e.g. 1.23 USD to 123, 123 JPY to 123 and 1.234 KWD to 1234
+func (c CurrencyCode) ToCurrency(f float64) Currency {
+	return Currency(math.Round(f * math.Pow10(c.MinorUnits())))
+}
+
+// Float64 converts m in the minor units of c to a float64 amount in c
+func (c CurrencyCode) Float64(m Currency) float64 {
+	return float64(m) / math.Pow10(c.MinorUnits())
+}
+
+// SignedFloat64 converts the signed amount m in the minor units of c to a float64 amount in c
+func (c CurrencyCode) SignedFloat64(m int64) float64 {
+	return float64(m) / math.Pow10(c.MinorUnits())
+}
+
+// Format returns m as a string with the decimal places of c followed by c
+// e.g. "1.23 USD", "123 JPY" and "1.234 KWD"
+func (c CurrencyCode) Format(m Currency) string {
+	return strconv.FormatFloat(c.Float64(m), 'f', c.MinorUnits(), 64) + " " + string(c)
+}
+
+// CurrencyTotals holds amounts in minor units summed per currency. Totals are signed,
+// since balances can go negative when more is taken from them than they hold.
+type CurrencyTotals map[CurrencyCode]int64
+
+// Add adds amount to the total of code, allocating the map if needed
+func (t *CurrencyTotals) Add(code CurrencyCode, amount int64) {
+	if *t == nil {
+		*t = make(CurrencyTotals)
+	}
+	(*t)[code] += amount
+}
+
+// Float64 converts every total to a float64 amount keyed by the currency code
+func (t CurrencyTotals) Float64() map[string]float64 {
+	res := make(map[string]float64, len(t))
+	for code, amount := range t {
+		res[string(code)] = float64(amount) / math.Pow10(code.MinorUnits())
+	}
+	return res
+}
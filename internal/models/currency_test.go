@@ -43,6 +43,39 @@ var _ = Describe("Using Currency values", func() {
 		})
 	})
 
+	Context("with currency codes", func() {
+		It("accepts supported ISO 4217 codes in any case", func() {
+			code, err := models.NewCurrencyCode("eur")
+			Expect(err).To(BeNil())
+			Expect(code).To(BeEquivalentTo("EUR"))
+		})
+		It("rejects unsupported codes", func() {
+			_, err := models.NewCurrencyCode("")
+			Expect(err).NotTo(BeNil())
+			_, err = models.NewCurrencyCode("XYZ")
+			Expect(err).NotTo(BeNil())
+		})
+		It("converts amounts using the minor units of the currency", func() {
+			Expect(models.CurrencyCode("USD").ToCurrency(1.23)).To(BeEquivalentTo(123))
+			Expect(models.CurrencyCode("JPY").ToCurrency(123)).To(BeEquivalentTo(123))
+			Expect(models.CurrencyCode("KWD").ToCurrency(1.234)).To(BeEquivalentTo(1234))
+			Expect(models.CurrencyCode("KWD").Float64(1234)).To(Equal(1.234))
+			Expect(models.CurrencyCode("JPY").Float64(1234)).To(Equal(1234.0))
+		})
+		It("formats amounts using the minor units of the currency", func() {
+			Expect(models.CurrencyCode("USD").Format(120)).To(Equal("1.20 USD"))
+			Expect(models.CurrencyCode("JPY").Format(120)).To(Equal("120 JPY"))
+			Expect(models.CurrencyCode("KWD").Format(1200)).To(Equal("1.200 KWD"))
+		})
+		It("sums totals per currency", func() {
+			var totals models.CurrencyTotals
+			totals.Add("USD", 100)
+			totals.Add("JPY", 100)
+			totals.Add("USD", 50)
+			Expect(totals.Float64()).To(Equal(map[string]float64{"USD": 1.5, "JPY": 100}))
+		})
+	})
+
 	Context("in a round trip between types", func() {
 		It("survives", func() {
 			floats := []float64{0.0, 0.1, 0.12, 5.0, 5.1, 5.12, 5.10, 5.01, 10.2, 10.1, 10.23}
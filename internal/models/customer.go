@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultPhoneCountryCode is the country calling code of phone numbers in national format, i.e. starting with a single 0
+const DefaultPhoneCountryCode = "359"
+
+// ErrInvalidPhone is returned when a phone number cannot be normalized to E.164
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone returns phone in E.164 format, e.g. "+359889787878" for "0889 787 878", "00359889787878" or "+359-889-787-878".
+// Numbers in national format are assumed to be in DefaultPhoneCountryCode. Empty phones are returned as they are.
+func NormalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -()./", r) {
+			return -1
+		}
+		return r
+	}, phone)
+	switch {
+	case digits == "":
+		return "", nil
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		digits = DefaultPhoneCountryCode + digits[1:]
+	}
+	if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPhone, phone)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPhone, phone)
+		}
+	}
+	return "+" + digits, nil
+}
+
+// ErrCustomerNotFound is returned when a customer does not exist or is not visible to the caller
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// Customer is the profile of a customer of a merchant, which is identified by its email. Customers are created
+// with the first transaction of their email and Phone is the latest phone the customer used.
+type Customer struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	ExternalID string `gorm:"column:ext_uuid;type:uuid"`
+	MerchantID uint
+	Merchant   Merchant
+	Email      string
+	Phone      string
+
+	// LifetimeSpend is the sum of the charges and chargeback reversals of the customer less its refunds and chargebacks
+	LifetimeSpend CurrencyTotals `gorm:"-"`
+	// TransactionCount is the number of transactions of the customer which are not in ERROR status
+	TransactionCount int64 `gorm:"-"`
+	// LastSeenAt is the time of the latest transaction of the customer
+	LastSeenAt *time.Time `gorm:"-"`
+}
+
+// linkCustomer sets the customer of t to the customer of its merchant with its email, which is created if it does not exist yet
+func linkCustomer(tx *gorm.DB, t *Transaction) error {
+	c := &Customer{ExternalID: uuid.Generate().String(), MerchantID: t.MerchantID, Email: t.CustomerEmail, Phone: t.CustomerPhone}
+	res := tx.Omit("Merchant").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "merchant_id"}, {Name: "email"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"phone":      gorm.Expr("CASE WHEN EXCLUDED.phone = '' THEN customer.phone ELSE EXCLUDED.phone END"),
+			"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(c)
+	if res.Error != nil {
+		return fmt.Errorf("while linking customer: %w", res.Error)
+	}
+	t.CustomerID = &c.ID
+	return nil
+}
+
+type CustomerStore struct {
+	db *gorm.DB
+}
+
+func NewCustomerStore(db *gorm.DB) *CustomerStore {
+	return &CustomerStore{db: db}
+}
+
+// GetCustomers returns the customers of the merchant with merchantID with their lifetime statistics, most recently seen first
+func (s *CustomerStore) GetCustomers(ctx context.Context, merchantID uint) ([]*Customer, error) {
+	var cs []*Customer
+	if err := s.db.WithContext(ctx).Where("merchant_id = ?", merchantID).Order("id").Find(&cs).Error; err != nil {
+		return nil, fmt.Errorf("while getting customers: %w", err)
+	}
+	if err := s.loadStatistics(ctx, cs...); err != nil {
+		return nil, err
+	}
+	sortByLastSeen(cs)
+	return cs, nil
+}
+
+// GetCustomerByUUID returns the customer with extID of the merchant with merchantID with its lifetime statistics
+func (s *CustomerStore) GetCustomerByUUID(ctx context.Context, extID string, merchantID uint) (*Customer, error) {
+	if _, err := uuid.Parse(extID); err != nil {
+		return nil, ErrCustomerNotFound
+	}
+	c := &Customer{}
+	res := s.db.WithContext(ctx).Where("ext_uuid = ? AND merchant_id = ?", extID, merchantID).First(c)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrCustomerNotFound
+	} else if res.Error != nil {
+		return nil, fmt.Errorf("while getting customer: %w", res.Error)
+	}
+	if err := s.loadStatistics(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadStatistics sets the lifetime spend, the transaction count and the last seen time of each customer.
+// Archived transactions are included, so that the statistics do not change when transactions are archived.
+func (s *CustomerStore) loadStatistics(ctx context.Context, cs ...*Customer) error {
+	if len(cs) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(cs))
+	for i, c := range cs {
+		ids[i] = c.ID
+	}
+	var rows []struct {
+		CustomerID       uint
+		CurrencyCode     CurrencyCode
+		Spend            int64
+		TransactionCount int64
+		LastSeenAt       time.Time
+	}
+	err := s.db.WithContext(ctx).Raw(`SELECT customer_id, currency_code,
+			COALESCE(SUM(CASE WHEN status IN ? THEN 0 WHEN _type IN ? THEN amount WHEN _type IN ? THEN -amount ELSE 0 END), 0) AS spend,
+			COUNT(*) FILTER (WHERE status <> ?) AS transaction_count,
+			MAX(created_at) AS last_seen_at
+		FROM (
+			SELECT customer_id, currency_code, status, _type, amount, created_at FROM transaction WHERE customer_id IN ?
+			UNION ALL
+			SELECT customer_id, currency_code, status, _type, amount, created_at FROM transaction_archive WHERE customer_id IN ?
+		) t GROUP BY customer_id, currency_code`,
+		[]TransactionStatus{StatusError, StatusPendingReview},
+		[]TransactionType{TypeCharge, TypeChargebackReversal},
+		[]TransactionType{TypeRefund, TypeChargeback},
+		StatusError, ids, ids).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("while getting customer statistics: %w", err)
+	}
+	byID := make(map[uint]*Customer, len(cs))
+	for _, c := range cs {
+		byID[c.ID] = c
+	}
+	for _, r := range rows {
+		c := byID[r.CustomerID]
+		c.LifetimeSpend.Add(r.CurrencyCode, r.Spend)
+		c.TransactionCount += r.TransactionCount
+		if c.LastSeenAt == nil || r.LastSeenAt.After(*c.LastSeenAt) {
+			lastSeenAt := r.LastSeenAt
+			c.LastSeenAt = &lastSeenAt
+		}
+	}
+	return nil
+}
+
+// sortByLastSeen orders cs from the most recently seen customer, keeping customers without transactions last
+func sortByLastSeen(cs []*Customer) {
+	seenAt := func(c *Customer) time.Time {
+		if c.LastSeenAt == nil {
+			return time.Time{}
+		}
+		return *c.LastSeenAt
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return seenAt(cs[i]).After(seenAt(cs[j])) })
+}
@@ -0,0 +1,161 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	CustomerTestSchemaName          = "payment_system_customer_test"
+	CustomerMigrationTestSchemaName = "payment_system_customer_migration_test"
+	customerMigration               = "000022_create_customer"
+)
+
+var _ = Describe("Using NormalizePhone", func() {
+	It("normalizes phones to E.164", func() {
+		for _, phone := range []string{"0889 787 878", "0889-787-878", "+359 (889) 787 878", "00359889787878", "359889787878"} {
+			normalized, err := models.NormalizePhone(phone)
+			Expect(err).To(BeNil())
+			Expect(normalized).To(Equal("+359889787878"))
+		}
+		normalized, err := models.NormalizePhone("")
+		Expect(err).To(BeNil())
+		Expect(normalized).To(BeEmpty())
+
+		for _, phone := range []string{"12345", "+359 888 abc", "+1234567890123456"} {
+			_, err = models.NormalizePhone(phone)
+			Expect(errors.Is(err, models.ErrInvalidPhone)).To(BeTrue())
+		}
+	})
+})
+
+var _ = Describe("Migrating to customers", func() {
+	It("normalizes the contacts of existing transactions and restores them when migrating down", func() {
+		workDir, err := os.Getwd()
+		Expect(err).To(BeNil())
+		before, err := readMigrations(workDir+pathToMigrations, func(name string) bool { return name < customerMigration })
+		Expect(err).To(BeNil())
+		migration, err := os.ReadFile(workDir + "/../../sql/" + customerMigration + ".up.sql")
+		Expect(err).To(BeNil())
+		downMigration, err := os.ReadFile(workDir + "/../../sql/" + customerMigration + ".down.sql")
+		Expect(err).To(BeNil())
+		setSearchPath := fmt.Sprintf(SetSearchPathStatementFormat, CustomerMigrationTestSchemaName)
+
+		_, err = sqlDB.Exec(addSchemaToMigration(before, CustomerMigrationTestSchemaName))
+		Expect(err).To(BeNil())
+		// transactions stored before customers were introduced, with contacts as they were sent
+		_, err = sqlDB.Exec(setSearchPath + `
+			INSERT INTO payment_system_user(created_at, _role, status) VALUES (NOW(), 'MERCHANT', 'ACTIVE');
+			INSERT INTO merchant(user_id, email, name) SELECT id, 'migration@abv.bg', 'Migration Merchant' FROM payment_system_user;
+			INSERT INTO transaction(created_at, ext_uuid, merchant_id, customer_email, customer_phone, amount, status, _type)
+			SELECT NOW() - INTERVAL '1 day', gen_random_uuid(), user_id, 'Buyer@Mail.bg', '0889 787 878', 1000, 'APPROVED', 'CHARGE' FROM merchant;
+			INSERT INTO transaction(created_at, ext_uuid, merchant_id, customer_email, customer_phone, amount, status, _type)
+			SELECT NOW(), gen_random_uuid(), user_id, 'buyer@mail.bg', '+359 888 555 885', 1000, 'APPROVED', 'CHARGE' FROM merchant;
+			INSERT INTO transaction(created_at, ext_uuid, merchant_id, customer_email, customer_phone, amount, status, _type)
+			SELECT NOW(), gen_random_uuid(), user_id, 'other@mail.bg', '12345', 1000, 'APPROVED', 'CHARGE' FROM merchant;`)
+		Expect(err).To(BeNil())
+
+		_, err = sqlDB.Exec(setSearchPath + string(migration))
+		Expect(err).To(BeNil())
+
+		type contact struct{ Email, Phone string }
+		// query refers to the tables of the schema as %[1]s.table
+		contacts := func(query string) []contact {
+			rows, err := sqlDB.Query(fmt.Sprintf(query, CustomerMigrationTestSchemaName))
+			Expect(err).To(BeNil())
+			defer rows.Close()
+			var cs []contact
+			for rows.Next() {
+				var c contact
+				Expect(rows.Scan(&c.Email, &c.Phone)).To(Succeed())
+				cs = append(cs, c)
+			}
+			Expect(rows.Err()).To(BeNil())
+			return cs
+		}
+		first, err := models.NormalizePhone("0889 787 878")
+		Expect(err).To(BeNil())
+		latest, err := models.NormalizePhone("+359 888 555 885")
+		Expect(err).To(BeNil())
+		// the contacts match the ones new transactions of the same customers are stored with
+		Expect(contacts("SELECT customer_email, customer_phone FROM %[1]s.transaction ORDER BY id")).To(Equal([]contact{
+			{"buyer@mail.bg", first}, {"buyer@mail.bg", latest}, {"other@mail.bg", ""},
+		}))
+		Expect(contacts("SELECT email, phone FROM %[1]s.customer ORDER BY email")).To(Equal([]contact{
+			{"buyer@mail.bg", latest}, {"other@mail.bg", ""},
+		}))
+		Expect(contacts("SELECT c.email, c.phone FROM %[1]s.transaction t JOIN %[1]s.customer c ON c.id = t.customer_id ORDER BY t.id")).To(HaveLen(3))
+
+		_, err = sqlDB.Exec(setSearchPath + string(downMigration))
+		Expect(err).To(BeNil())
+		Expect(contacts("SELECT customer_email, customer_phone FROM %[1]s.transaction ORDER BY id")).To(Equal([]contact{
+			{"Buyer@Mail.bg", "0889 787 878"}, {"buyer@mail.bg", "+359 888 555 885"}, {"other@mail.bg", "12345"},
+		}))
+	})
+})
+
+var _ = Describe("Using CustomerStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		customerStore    *models.CustomerStore
+		merchant, other  *models.Merchant
+		err              error
+		create           = func(m *models.Merchant, _type models.TransactionType, status models.TransactionStatus, amount float64, email, phone string, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, m, _type, status, amount, email, phone, belongsTo)
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, CustomerTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		customerStore = models.NewCustomerStore(gormDB)
+		merchant, err = models.NewMerchant("Customer Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+		other, err = models.NewMerchant("Other Customer Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), other)).To(Succeed())
+	})
+
+	It("links the transactions of a customer to a single profile per merchant", func() {
+		charge := create(merchant, models.TypeCharge, models.StatusApproved, 100, "Buyer@mail.bg", "0889 787 878", nil)
+		refund := create(merchant, models.TypeRefund, models.StatusApproved, 30, "buyer@mail.bg", "0889787878", charge)
+		failed := create(merchant, models.TypeCharge, models.StatusError, 50, "buyer@mail.bg", "+359 888 555 885", nil)
+		otherCharge := create(other, models.TypeCharge, models.StatusApproved, 10, "buyer@mail.bg", "0889787878", nil)
+		Expect(charge.CustomerPhone).To(Equal("+359889787878"))
+		Expect(charge.CustomerID).NotTo(BeNil())
+		Expect(*refund.CustomerID).To(Equal(*charge.CustomerID))
+		Expect(*failed.CustomerID).To(Equal(*charge.CustomerID))
+		Expect(*otherCharge.CustomerID).NotTo(Equal(*charge.CustomerID))
+
+		customers, err := customerStore.GetCustomers(context.Background(), merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(customers).To(HaveLen(1))
+		customer := customers[0]
+		Expect(customer.Email).To(Equal("buyer@mail.bg"))
+		Expect(customer.Phone).To(Equal("+359888555885"))
+		Expect(customer.LifetimeSpend[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(70)))
+		Expect(customer.TransactionCount).To(BeEquivalentTo(2))
+		Expect(customer.LastSeenAt).NotTo(BeNil())
+		Expect(*customer.LastSeenAt).To(BeTemporally("~", failed.CreatedAt, time.Millisecond))
+
+		found, err := customerStore.GetCustomerByUUID(context.Background(), customer.ExternalID, merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(found.TransactionCount).To(BeEquivalentTo(2))
+		_, err = customerStore.GetCustomerByUUID(context.Background(), customer.ExternalID, other.UserID)
+		Expect(err).To(MatchError(models.ErrCustomerNotFound))
+	})
+})
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DisputeStatus string
+
+const (
+	DisputeOpened            DisputeStatus = "OPENED"
+	DisputeEvidenceSubmitted DisputeStatus = "EVIDENCE_SUBMITTED"
+	DisputeWon               DisputeStatus = "WON"
+	DisputeLost              DisputeStatus = "LOST"
+)
+
+func NewDisputeStatus(s string) (DisputeStatus, error) {
+	return enumFactory(s, DisputeOpened, DisputeEvidenceSubmitted, DisputeWon, DisputeLost)
+}
+
+// Resolved reports whether s is a final status
+func (s DisputeStatus) Resolved() bool {
+	return s == DisputeWon || s == DisputeLost
+}
+
+var (
+	// ErrDisputeNotFound is returned when a dispute does not exist or is not visible to the caller
+	ErrDisputeNotFound = errors.New("dispute not found")
+	// ErrDisputeNotOpen is returned when evidence is added to or submitted for a dispute which is not in OPENED status
+	ErrDisputeNotOpen = errors.New("dispute does not accept evidence in its current status")
+	// ErrDisputeResolved is returned when a dispute which has already been won or lost is resolved again
+	ErrDisputeResolved = errors.New("dispute has already been resolved")
+	// ErrEvidenceDeadlinePassed is returned when evidence is added or submitted after the deadline of a dispute
+	ErrEvidenceDeadlinePassed = errors.New("evidence deadline of the dispute has passed")
+	// ErrNoEvidence is returned when the evidence of a dispute without any attachments is submitted
+	ErrNoEvidence = errors.New("dispute has no evidence to submit")
+	// ErrInvalidDisputeOutcome is returned when a dispute is resolved with a status other than WON or LOST
+	ErrInvalidDisputeOutcome = errors.New("dispute outcome must be either WON or LOST")
+)
+
+// Dispute is a dispute of a CHARGE by the cardholder. Opening a dispute takes its amount from the merchant
+// with a CHARGEBACK, which is reversed by a CHARGEBACK_REVERSAL when the merchant wins the dispute.
+type Dispute struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	ExternalID string `gorm:"column:ext_uuid;type:uuid"`
+	MerchantID uint
+	Merchant   Merchant
+
+	TransactionID        uint
+	Transaction          Transaction
+	ChargebackID         *uint
+	Chargeback           *Transaction
+	ChargebackReversalID *uint
+	ChargebackReversal   *Transaction
+
+	Status       DisputeStatus
+	Reason       string
+	Amount       Currency     `gorm:"type:bigint"`
+	CurrencyCode CurrencyCode `gorm:"type:char(3)"`
+	// EvidenceDueBy is the deadline for submitting evidence, after which an OPENED dispute is lost
+	EvidenceDueBy       time.Time
+	EvidenceSubmittedAt *time.Time
+	ResolvedAt          *time.Time
+
+	Evidence []DisputeEvidence
+}
+
+// DisputeEvidence is the metadata of a document attached by the merchant as evidence to a dispute
+type DisputeEvidence struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	DisputeID   uint
+	FileName    string
+	ContentType string
+	Size        int64
+	Description string
+}
+
+func newDisputeTransaction(_type TransactionType, amount Currency, parent *Transaction) *Transaction {
+	return &Transaction{
+		ExternalID:      uuid.Generate().String(),
+		Type:            _type,
+		Amount:          amount,
+		CurrencyCode:    parent.CurrencyCode,
+		Status:          StatusApproved,
+		CustomerEmail:   parent.CustomerEmail,
+		CustomerPhone:   parent.CustomerPhone,
+		SystemGenerated: true,
+		MerchantID:      parent.MerchantID,
+		BelongsToID:     &parent.ID,
+	}
+}
+
+type DisputeStore struct {
+	db *gorm.DB
+}
+
+func NewDisputeStore(db *gorm.DB) *DisputeStore {
+	return &DisputeStore{db: db}
+}
+
+// OpenDispute opens a dispute of amount against the CHARGE with chargeUUID and takes the amount from
+// the merchant with a CHARGEBACK. A zero amount disputes the whole remaining amount of the charge.
+func (s *DisputeStore) OpenDispute(ctx context.Context, chargeUUID string, amount Currency, reason string, evidenceDueBy time.Time) (*Dispute, error) {
+	var d *Dispute
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		charge := &Transaction{}
+		res := tx.Where("ext_uuid = ?", chargeUUID).First(charge)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrTransactionNotFound
+		} else if err := res.Error; err != nil {
+			return err
+		}
+		if amount == 0 {
+			amount = charge.RemainingRefundableAmount()
+		}
+		chargeback := newDisputeTransaction(TypeChargeback, amount, charge)
+		if err := tx.Create(chargeback).Error; err != nil {
+			return err
+		}
+		d = &Dispute{
+			ExternalID:    uuid.Generate().String(),
+			MerchantID:    charge.MerchantID,
+			TransactionID: charge.ID,
+			Transaction:   *charge,
+			ChargebackID:  &chargeback.ID,
+			Chargeback:    chargeback,
+			Status:        DisputeOpened,
+			Reason:        reason,
+			Amount:        amount,
+			CurrencyCode:  charge.CurrencyCode,
+			EvidenceDueBy: evidenceDueBy,
+		}
+		if err := tx.Omit(clause.Associations).Create(d).Error; err != nil {
+			return err
+		}
+		return writeDisputeEvent(tx, d, EventDisputeOpened)
+	})
+	if err != nil {
+		return nil, wrapDisputeError("while opening dispute", err)
+	}
+	return d, nil
+}
+
+// disputeErrors are the errors of dispute operations which are returned as they are
+var disputeErrors = []error{
+	ErrDisputeNotFound, ErrDisputeNotOpen, ErrDisputeResolved, ErrEvidenceDeadlinePassed, ErrNoEvidence,
+	ErrTransactionNotFound, ErrIllegalTransition, ErrChargebackExceedsCharge, ErrInvalidAmount,
+}
+
+func wrapDisputeError(while string, err error) error {
+	for _, target := range disputeErrors {
+		if errors.Is(err, target) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %w", while, err)
+}
+
+func (s *DisputeStore) disputes(db *gorm.DB, merchantID *uint) *gorm.DB {
+	query := db.Preload("Merchant").Preload("Transaction").Preload("Chargeback").Preload("ChargebackReversal").
+		Preload("Evidence", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	if merchantID != nil {
+		query = query.Where("merchant_id = ?", *merchantID)
+	}
+	return query
+}
+
+// GetDisputes returns the disputes ordered from the newest. If merchantID is not nil, only disputes of that merchant are returned.
+func (s *DisputeStore) GetDisputes(ctx context.Context, merchantID *uint) ([]*Dispute, error) {
+	var ds []*Dispute
+	if err := s.disputes(s.db.WithContext(ctx), merchantID).Order("id DESC").Find(&ds).Error; err != nil {
+		return nil, fmt.Errorf("while getting disputes: %w", err)
+	}
+	if err := loadArchivedTransactions(s.db.WithContext(ctx), ds...); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// loadArchivedTransactions sets the transactions of ds which have been archived together with their chain,
+// since these are not found by the preloads of the disputes
+func loadArchivedTransactions(db *gorm.DB, ds ...*Dispute) error {
+	var ids []uint
+	for _, d := range ds {
+		if d.Transaction.ID == 0 {
+			ids = append(ids, d.TransactionID)
+		}
+		if d.ChargebackID != nil && d.Chargeback == nil {
+			ids = append(ids, *d.ChargebackID)
+		}
+		if d.ChargebackReversalID != nil && d.ChargebackReversal == nil {
+			ids = append(ids, *d.ChargebackReversalID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var archive []*ArchivedTransaction
+	if err := db.Where("id IN ?", ids).Find(&archive).Error; err != nil {
+		return fmt.Errorf("while getting archived transactions of disputes: %w", err)
+	}
+	archived := make(map[uint]*Transaction, len(archive))
+	for _, a := range archive {
+		archived[a.ID] = a.transaction()
+	}
+	for _, d := range ds {
+		if t, ok := archived[d.TransactionID]; ok && d.Transaction.ID == 0 {
+			d.Transaction = *t
+		}
+		if d.ChargebackID != nil && d.Chargeback == nil {
+			d.Chargeback = archived[*d.ChargebackID]
+		}
+		if d.ChargebackReversalID != nil && d.ChargebackReversal == nil {
+			d.ChargebackReversal = archived[*d.ChargebackReversalID]
+		}
+	}
+	return nil
+}
+
+// GetDisputeByUUID returns the dispute with extID. If merchantID is not nil, only a dispute of that merchant is returned.
+func (s *DisputeStore) GetDisputeByUUID(ctx context.Context, extID string, merchantID *uint) (*Dispute, error) {
+	return s.getDispute(s.db.WithContext(ctx), extID, merchantID, false)
+}
+
+func (s *DisputeStore) getDispute(db *gorm.DB, extID string, merchantID *uint, lock bool) (*Dispute, error) {
+	if _, err := uuid.Parse(extID); err != nil {
+		return nil, ErrDisputeNotFound
+	}
+	query := s.disputes(db, merchantID)
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: clause.CurrentTable}})
+	}
+	d := &Dispute{}
+	res := query.Where("dispute.ext_uuid = ?", extID).First(d)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrDisputeNotFound
+	} else if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting dispute: %w", err)
+	}
+	if err := loadArchivedTransactions(db, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// updateDispute locks the dispute with extID of the merchant with merchantID (any merchant if nil),
+// calls update with it and saves its status and timestamps
+func (s *DisputeStore) updateDispute(ctx context.Context, extID string, merchantID *uint, update func(tx *gorm.DB, d *Dispute) error) (*Dispute, error) {
+	var d *Dispute
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) (err error) {
+		if d, err = s.getDispute(tx, extID, merchantID, true); err != nil {
+			return err
+		}
+		if err = update(tx, d); err != nil {
+			return err
+		}
+		return tx.Model(d).Omit(clause.Associations).Updates(map[string]interface{}{
+			"status":                 d.Status,
+			"evidence_submitted_at":  d.EvidenceSubmittedAt,
+			"resolved_at":            d.ResolvedAt,
+			"chargeback_reversal_id": d.ChargebackReversalID,
+		}).Error
+	})
+	if err != nil {
+		return nil, wrapDisputeError("while updating dispute", err)
+	}
+	return d, nil
+}
+
+// checkAcceptsEvidence returns an error unless evidence can be added to or submitted for d at now
+func (d *Dispute) checkAcceptsEvidence(now time.Time) error {
+	if d.Status != DisputeOpened {
+		return fmt.Errorf("dispute is %s: %w", d.Status, ErrDisputeNotOpen)
+	}
+	if now.After(d.EvidenceDueBy) {
+		return ErrEvidenceDeadlinePassed
+	}
+	return nil
+}
+
+// AddEvidence attaches e to the OPENED dispute with extID of the merchant with merchantID
+func (s *DisputeStore) AddEvidence(ctx context.Context, extID string, merchantID uint, e *DisputeEvidence) (*Dispute, error) {
+	return s.updateDispute(ctx, extID, &merchantID, func(tx *gorm.DB, d *Dispute) error {
+		if err := d.checkAcceptsEvidence(time.Now()); err != nil {
+			return err
+		}
+		e.DisputeID = d.ID
+		if err := tx.Create(e).Error; err != nil {
+			return fmt.Errorf("while adding dispute evidence: %w", err)
+		}
+		d.Evidence = append(d.Evidence, *e)
+		return nil
+	})
+}
+
+// SubmitEvidence submits the evidence attached to the OPENED dispute with extID of the merchant with merchantID
+func (s *DisputeStore) SubmitEvidence(ctx context.Context, extID string, merchantID uint) (*Dispute, error) {
+	return s.updateDispute(ctx, extID, &merchantID, func(tx *gorm.DB, d *Dispute) error {
+		now := time.Now()
+		if err := d.checkAcceptsEvidence(now); err != nil {
+			return err
+		}
+		if len(d.Evidence) == 0 {
+			return ErrNoEvidence
+		}
+		d.Status, d.EvidenceSubmittedAt = DisputeEvidenceSubmitted, &now
+		return writeDisputeEvent(tx, d, EventDisputeUpdated)
+	})
+}
+
+// ResolveDispute closes the dispute with extID with outcome, which is either WON or LOST.
+// The chargeback of a won dispute is reversed with a CHARGEBACK_REVERSAL.
+func (s *DisputeStore) ResolveDispute(ctx context.Context, extID string, outcome DisputeStatus) (*Dispute, error) {
+	if !outcome.Resolved() {
+		return nil, ErrInvalidDisputeOutcome
+	}
+	return s.updateDispute(ctx, extID, nil, func(tx *gorm.DB, d *Dispute) error {
+		return resolveDispute(tx, d, outcome, time.Now())
+	})
+}
+
+func resolveDispute(tx *gorm.DB, d *Dispute, outcome DisputeStatus, now time.Time) error {
+	if d.Status.Resolved() {
+		return fmt.Errorf("dispute is %s: %w", d.Status, ErrDisputeResolved)
+	}
+	if outcome == DisputeWon && d.Chargeback != nil {
+		reversal := newDisputeTransaction(TypeChargebackReversal, d.Amount, d.Chargeback)
+		if err := tx.Create(reversal).Error; err != nil {
+			return fmt.Errorf("while reversing chargeback: %w", err)
+		}
+		// the reversed amount can be refunded or disputed again
+		res := tx.Model(&Transaction{}).Where("id = ?", d.TransactionID).
+			Update("disputed_amount", gorm.Expr("disputed_amount - ?", d.Amount))
+		if err := res.Error; err != nil {
+			return fmt.Errorf("while releasing disputed amount: %w", err)
+		}
+		d.ChargebackReversalID, d.ChargebackReversal = &reversal.ID, reversal
+	}
+	d.Status, d.ResolvedAt = outcome, &now
+	return writeDisputeEvent(tx, d, EventDisputeUpdated)
+}
+
+// GetPeriodicJobDisputeExpirer returns a job which closes the disputes whose evidence deadline has passed
+func (s *DisputeStore) GetPeriodicJobDisputeExpirer(jobExecutionInterval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.ExpireDisputes(ctx, time.Now()); err != nil {
+					logrus.Warnf("periodic dispute expiry job failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ExpireDisputes resolves the OPENED disputes whose evidence deadline passed before now as LOST,
+// since the merchant did not submit evidence in time. It returns the number of expired disputes.
+func (s *DisputeStore) ExpireDisputes(ctx context.Context, now time.Time) (int, error) {
+	var ids []string
+	err := s.db.WithContext(ctx).Model(&Dispute{}).
+		Where("status = ? AND evidence_due_by < ?", DisputeOpened, now).
+		Order("id").Pluck("ext_uuid", &ids).Error
+	if err != nil {
+		return 0, fmt.Errorf("while getting expired disputes: %w", err)
+	}
+	expired := 0
+	for _, id := range ids {
+		lost := false
+		_, err := s.updateDispute(ctx, id, nil, func(tx *gorm.DB, d *Dispute) error {
+			if d.Status != DisputeOpened {
+				// evidence was submitted in the meantime
+				return nil
+			}
+			lost = true
+			return resolveDispute(tx, d, DisputeLost, now)
+		})
+		if err != nil {
+			logrus.Warnf("could not expire dispute %s: %v", id, err)
+			continue
+		}
+		if lost {
+			expired++
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,121 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const DisputeTestSchemaName = "payment_system_dispute_test"
+
+var _ = Describe("Using DisputeStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		disputeStore     *models.DisputeStore
+		merchant         *models.Merchant
+		charge           *models.Transaction
+		err              error
+		total            = func() int64 {
+			m, err := merchantStore.GetMerchantByEmail(context.Background(), merchant.Email)
+			Expect(err).To(BeNil())
+			return m.TotalTransactionSum[models.DefaultCurrencyCode]
+		}
+		reload = func(t *models.Transaction) *models.Transaction {
+			reloaded, err := transactionStore.GetTransactionByUUID(context.Background(), t.ExternalID)
+			Expect(err).To(BeNil())
+			return reloaded
+		}
+		evidence = func() *models.DisputeEvidence {
+			return &models.DisputeEvidence{FileName: "receipt.pdf", ContentType: "application/pdf", Size: 1024}
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, DisputeTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		disputeStore = models.NewDisputeStore(gormDB)
+		merchant, err = models.NewMerchant("Dispute Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+		charge, err = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(100), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, "cardholder@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		Expect(transactionStore.CreateTransaction(context.Background(), charge)).To(Succeed())
+	})
+
+	It("charges back the disputed amount and reverses the chargeback of won disputes", func() {
+		d, err := disputeStore.OpenDispute(context.Background(), charge.ExternalID, models.ToCurrency(40), "fraudulent", time.Now().Add(time.Hour))
+		Expect(err).To(BeNil())
+		Expect(d.Status).To(Equal(models.DisputeOpened))
+		Expect(d.Chargeback.Type).To(Equal(models.TypeChargeback))
+		Expect(total()).To(BeEquivalentTo(models.ToCurrency(60)))
+		Expect(reload(charge).RemainingRefundableAmount()).To(Equal(models.ToCurrency(60)))
+
+		_, err = disputeStore.SubmitEvidence(context.Background(), d.ExternalID, merchant.UserID)
+		Expect(err).To(MatchError(models.ErrNoEvidence))
+		_, err = disputeStore.AddEvidence(context.Background(), d.ExternalID, merchant.UserID, evidence())
+		Expect(err).To(BeNil())
+		d, err = disputeStore.SubmitEvidence(context.Background(), d.ExternalID, merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(d.Status).To(Equal(models.DisputeEvidenceSubmitted))
+		Expect(d.Evidence).To(HaveLen(1))
+
+		_, err = disputeStore.ResolveDispute(context.Background(), d.ExternalID, models.DisputeEvidenceSubmitted)
+		Expect(err).To(MatchError(models.ErrInvalidDisputeOutcome))
+		d, err = disputeStore.ResolveDispute(context.Background(), d.ExternalID, models.DisputeWon)
+		Expect(err).To(BeNil())
+		Expect(d.ChargebackReversal).NotTo(BeNil())
+		Expect(total()).To(BeEquivalentTo(models.ToCurrency(100)))
+		Expect(reload(charge).RemainingRefundableAmount()).To(Equal(models.ToCurrency(100)))
+		Expect(reload(d.Chargeback).Status).To(Equal(models.StatusReversed))
+
+		_, err = disputeStore.ResolveDispute(context.Background(), d.ExternalID, models.DisputeLost)
+		Expect(err).To(MatchError(ContainSubstring(models.ErrDisputeResolved.Error())))
+	})
+
+	It("disputes only the amount which has not been refunded", func() {
+		refund, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(30), models.DefaultCurrencyCode, models.TypeRefund, models.StatusApproved, "cardholder@mail.bg", "0889787878", merchant.UserID, &charge.ID)
+		Expect(err).To(BeNil())
+		Expect(transactionStore.CreateTransaction(context.Background(), refund)).To(Succeed())
+
+		_, err = disputeStore.OpenDispute(context.Background(), charge.ExternalID, models.ToCurrency(80), "fraudulent", time.Now().Add(time.Hour))
+		Expect(err).To(MatchError(ContainSubstring(models.ErrChargebackExceedsCharge.Error())))
+		d, err := disputeStore.OpenDispute(context.Background(), charge.ExternalID, 0, "fraudulent", time.Now().Add(time.Hour))
+		Expect(err).To(BeNil())
+		Expect(d.Amount).To(Equal(models.ToCurrency(70)))
+		Expect(total()).To(BeZero())
+
+		_, err = disputeStore.OpenDispute(context.Background(), refund.ExternalID, 0, "fraudulent", time.Now().Add(time.Hour))
+		Expect(err).To(MatchError(models.ErrIllegalTransition))
+	})
+
+	It("loses opened disputes after their evidence deadline", func() {
+		d, err := disputeStore.OpenDispute(context.Background(), charge.ExternalID, 0, "not received", time.Now().Add(time.Minute))
+		Expect(err).To(BeNil())
+		Expect(d.Amount).To(Equal(models.ToCurrency(100)))
+
+		expired, err := disputeStore.ExpireDisputes(context.Background(), time.Now().Add(2*time.Minute))
+		Expect(err).To(BeNil())
+		Expect(expired).To(BeNumerically(">=", 1))
+		d, err = disputeStore.GetDisputeByUUID(context.Background(), d.ExternalID, &merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(d.Status).To(Equal(models.DisputeLost))
+		Expect(d.ResolvedAt).NotTo(BeNil())
+		Expect(total()).To(BeZero())
+
+		_, err = disputeStore.AddEvidence(context.Background(), d.ExternalID, merchant.UserID, evidence())
+		Expect(err).To(MatchError(ContainSubstring(models.ErrDisputeNotOpen.Error())))
+		other := uint(0)
+		_, err = disputeStore.GetDisputeByUUID(context.Background(), d.ExternalID, &other)
+		Expect(err).To(MatchError(models.ErrDisputeNotFound))
+	})
+})
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefundFeePolicy controls the fee of refunds
+type RefundFeePolicy string
+
+const (
+	// RefundFeeNone keeps the fee of the refunded charge and does not charge a fee for the refund
+	RefundFeeNone RefundFeePolicy = "NONE"
+	// RefundFeeReturnProportional returns the refunded share of the fee of the refunded charge to the merchant
+	RefundFeeReturnProportional RefundFeePolicy = "RETURN_PROPORTIONAL"
+	// RefundFeeCharge charges refunds with the fee rate of REFUND transactions like charges
+	RefundFeeCharge RefundFeePolicy = "CHARGE"
+)
+
+func NewRefundFeePolicy(s string) (RefundFeePolicy, error) {
+	return enumFactory(s, RefundFeeNone, RefundFeeReturnProportional, RefundFeeCharge)
+}
+
+var (
+	// ErrFeePlanNotFound is returned when a merchant has no fee plan
+	ErrFeePlanNotFound = errors.New("fee plan not found")
+	// ErrInvalidFeePlan is returned when a fee plan has invalid rates or overrides
+	ErrInvalidFeePlan = errors.New("invalid fee plan")
+)
+
+// FeeRate is a percentage of the transaction amount in basis points (hundredths of a percent) plus a fixed amount.
+// Fees lower than MinimumAmount are raised to it. FixedAmount and MinimumAmount are in the minor units of the currency
+// of the fee plan and only apply to transactions in that currency.
+type FeeRate struct {
+	BasisPoints   uint
+	FixedAmount   Currency `gorm:"type:bigint"`
+	MinimumAmount Currency `gorm:"type:bigint"`
+}
+
+// fee returns the fee of amount in currencyCode
+func (r FeeRate) fee(amount Currency, currencyCode, planCurrencyCode CurrencyCode) int64 {
+	fee := (int64(amount)*int64(r.BasisPoints) + 5_000) / 10_000
+	if currencyCode != planCurrencyCode {
+		return fee
+	}
+	fee += int64(r.FixedAmount)
+	if fee < int64(r.MinimumAmount) {
+		fee = int64(r.MinimumAmount)
+	}
+	return fee
+}
+
+// FeePlan holds the pricing of a merchant. Fees are computed when CHARGE and REFUND transactions are created.
+type FeePlan struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	MerchantID   uint
+	Merchant     Merchant
+	CurrencyCode CurrencyCode `gorm:"type:char(3)"`
+	FeeRate      `gorm:"embedded"`
+	RefundPolicy RefundFeePolicy
+
+	// Overrides replace FeeRate for transactions of their type
+	Overrides []FeePlanOverride
+}
+
+// FeePlanOverride is the fee rate of a FeePlan for transactions of a type
+type FeePlanOverride struct {
+	ID        uint `gorm:"primaryKey;->"`
+	FeePlanID uint
+
+	Type    TransactionType `gorm:"column:_type;type:transaction_type"`
+	FeeRate `gorm:"embedded"`
+}
+
+// NewFeePlan returns a fee plan for the merchant with merchantID which validates its overrides
+func NewFeePlan(merchantID uint, currencyCode CurrencyCode, rate FeeRate, refundPolicy RefundFeePolicy, overrides []FeePlanOverride) (*FeePlan, error) {
+	if !currencyCode.Valid() {
+		return nil, fmt.Errorf("%w: %q is not a supported currency code", ErrInvalidFeePlan, currencyCode)
+	}
+	if rate.BasisPoints > 10_000 {
+		return nil, fmt.Errorf("%w: percentage cannot exceed 100", ErrInvalidFeePlan)
+	}
+	seen := make(map[TransactionType]bool, len(overrides))
+	for _, o := range overrides {
+		if o.Type != TypeCharge && o.Type != TypeRefund {
+			return nil, fmt.Errorf("%w: only CHARGE and REFUND fees can be overridden, not %s", ErrInvalidFeePlan, o.Type)
+		} else if seen[o.Type] {
+			return nil, fmt.Errorf("%w: %s is overridden more than once", ErrInvalidFeePlan, o.Type)
+		} else if o.BasisPoints > 10_000 {
+			return nil, fmt.Errorf("%w: percentage cannot exceed 100", ErrInvalidFeePlan)
+		}
+		seen[o.Type] = true
+	}
+	return &FeePlan{MerchantID: merchantID, CurrencyCode: currencyCode, FeeRate: rate, RefundPolicy: refundPolicy, Overrides: overrides}, nil
+}
+
+// Rate returns the fee rate of transactions of type _type
+func (p *FeePlan) Rate(_type TransactionType) FeeRate {
+	for _, o := range p.Overrides {
+		if o.Type == _type {
+			return o.FeeRate
+		}
+	}
+	return p.FeeRate
+}
+
+// Fee returns the fee of t, whose parent has to be set for refunds. Fees returned to the merchant are negative.
+func (p *FeePlan) Fee(t, parent *Transaction) int64 {
+	if t.Status == StatusError {
+		return 0
+	}
+	switch t.Type { //nolint:exhaustive
+	case TypeCharge:
+		return p.Rate(TypeCharge).fee(t.Amount, t.CurrencyCode, p.CurrencyCode)
+	case TypeRefund:
+		switch p.RefundPolicy {
+		case RefundFeeCharge:
+			return p.Rate(TypeRefund).fee(t.Amount, t.CurrencyCode, p.CurrencyCode)
+		case RefundFeeReturnProportional:
+			if parent == nil || parent.Amount == 0 || parent.FeeAmount <= 0 {
+				return 0
+			}
+			// rounded down, so that partial refunds never return more than the fee of the charge
+			return -parent.FeeAmount * int64(t.Amount) / int64(parent.Amount)
+		default:
+			return 0
+		}
+	default:
+		return 0
+	}
+}
+
+// getFeePlan returns the fee plan of the merchant with merchantID using db or nil if the merchant has none
+func getFeePlan(db *gorm.DB, merchantID uint) (*FeePlan, error) {
+	p := &FeePlan{}
+	res := db.Preload("Overrides").Where("merchant_id = ?", merchantID).First(p)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting fee plan: %w", err)
+	}
+	return p, nil
+}
+
+type FeePlanStore struct {
+	db *gorm.DB
+}
+
+func NewFeePlanStore(db *gorm.DB) *FeePlanStore {
+	return &FeePlanStore{db: db}
+}
+
+// GetFeePlan returns the fee plan of the merchant with merchantID
+func (s *FeePlanStore) GetFeePlan(ctx context.Context, merchantID uint) (*FeePlan, error) {
+	p, err := getFeePlan(s.db.WithContext(ctx), merchantID)
+	if err != nil {
+		return nil, err
+	} else if p == nil {
+		return nil, ErrFeePlanNotFound
+	}
+	return p, nil
+}
+
+// SetFeePlan replaces the fee plan of the merchant of p with p. Fees of existing transactions are not changed.
+func (s *FeePlanStore) SetFeePlan(ctx context.Context, p *FeePlan) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("merchant_id = ?", p.MerchantID).Delete(&FeePlan{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit("Merchant").Create(p).Error
+	})
+	if err != nil {
+		return fmt.Errorf("while setting fee plan: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeePlan removes the fee plan of the merchant with merchantID, so that its future transactions have no fees
+func (s *FeePlanStore) DeleteFeePlan(ctx context.Context, merchantID uint) error {
+	res := s.db.WithContext(ctx).Where("merchant_id = ?", merchantID).Delete(&FeePlan{})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while deleting fee plan: %w", err)
+	} else if res.RowsAffected == 0 {
+		return ErrFeePlanNotFound
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const FeePlanTestSchemaName = "payment_system_fee_plan_test"
+
+var _ = Describe("Using FeePlan", func() {
+	var (
+		newTransaction = func(_type models.TransactionType, amount float64, currencyCode models.CurrencyCode) *models.Transaction {
+			return &models.Transaction{Type: _type, Status: models.StatusApproved, Amount: models.ToCurrency(amount), CurrencyCode: currencyCode}
+		}
+		newPlan = func(policy models.RefundFeePolicy, overrides ...models.FeePlanOverride) *models.FeePlan {
+			plan, err := models.NewFeePlan(1, "USD", models.FeeRate{BasisPoints: 290, FixedAmount: 30, MinimumAmount: 50}, policy, overrides)
+			Expect(err).To(BeNil())
+			return plan
+		}
+	)
+
+	It("charges a percentage and a fixed amount with a minimum", func() {
+		plan := newPlan(models.RefundFeeNone)
+		Expect(plan.Fee(newTransaction(models.TypeCharge, 100, "USD"), nil)).To(BeEquivalentTo(320))
+		Expect(plan.Fee(newTransaction(models.TypeCharge, 0.5, "USD"), nil)).To(BeEquivalentTo(50))
+		// fixed amounts and minimums only apply in the currency of the plan
+		Expect(plan.Fee(newTransaction(models.TypeCharge, 100, "EUR"), nil)).To(BeEquivalentTo(290))
+
+		failed := newTransaction(models.TypeCharge, 100, "USD")
+		failed.Status = models.StatusError
+		Expect(plan.Fee(failed, nil)).To(BeZero())
+		Expect(plan.Fee(newTransaction(models.TypeAuthorize, 100, "USD"), nil)).To(BeZero())
+	})
+
+	It("applies the refund fee policy and overrides", func() {
+		charge := newTransaction(models.TypeCharge, 100, "USD")
+		charge.FeeAmount = 320
+		refund := newTransaction(models.TypeRefund, 25, "USD")
+
+		Expect(newPlan(models.RefundFeeNone).Fee(refund, charge)).To(BeZero())
+		Expect(newPlan(models.RefundFeeReturnProportional).Fee(refund, charge)).To(BeEquivalentTo(-80))
+		Expect(newPlan(models.RefundFeeCharge).Fee(refund, charge)).To(BeEquivalentTo(103))
+
+		plan := newPlan(models.RefundFeeCharge, models.FeePlanOverride{Type: models.TypeRefund, FeeRate: models.FeeRate{FixedAmount: 15}})
+		Expect(plan.Fee(refund, charge)).To(BeEquivalentTo(15))
+		Expect(plan.Fee(charge, nil)).To(BeEquivalentTo(320))
+	})
+
+	It("rejects invalid overrides", func() {
+		_, err := models.NewFeePlan(1, "USD", models.FeeRate{}, models.RefundFeeNone, []models.FeePlanOverride{{Type: models.TypeAuthorize}})
+		Expect(errors.Is(err, models.ErrInvalidFeePlan)).To(BeTrue())
+		_, err = models.NewFeePlan(1, "USD", models.FeeRate{}, models.RefundFeeNone, []models.FeePlanOverride{{Type: models.TypeCharge}, {Type: models.TypeCharge}})
+		Expect(errors.Is(err, models.ErrInvalidFeePlan)).To(BeTrue())
+		_, err = models.NewFeePlan(1, "USD", models.FeeRate{BasisPoints: 10_001}, models.RefundFeeNone, nil)
+		Expect(errors.Is(err, models.ErrInvalidFeePlan)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Using FeePlanStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		feePlanStore     *models.FeePlanStore
+		merchant         *models.Merchant
+		err              error
+		create           = func(_type models.TransactionType, amount float64, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, merchant, _type, models.StatusApproved, amount, "fee@mail.bg", "0889787878", belongsTo)
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, FeePlanTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		feePlanStore = models.NewFeePlanStore(gormDB)
+		merchant, err = models.NewMerchant("Fee Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("stores fees of charges and refunds and exposes net totals", func() {
+		_, err := feePlanStore.GetFeePlan(context.Background(), merchant.UserID)
+		Expect(err).To(MatchError(models.ErrFeePlanNotFound))
+		free := create(models.TypeCharge, 10, nil)
+		Expect(free.FeeAmount).To(BeZero())
+
+		plan, err := models.NewFeePlan(merchant.UserID, models.DefaultCurrencyCode, models.FeeRate{BasisPoints: 200, FixedAmount: 20}, models.RefundFeeReturnProportional,
+			[]models.FeePlanOverride{{Type: models.TypeCharge, FeeRate: models.FeeRate{BasisPoints: 300}}})
+		Expect(err).To(BeNil())
+		Expect(feePlanStore.SetFeePlan(context.Background(), plan)).To(Succeed())
+		stored, err := feePlanStore.GetFeePlan(context.Background(), merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(stored.Overrides).To(HaveLen(1))
+
+		charge := create(models.TypeCharge, 100, nil)
+		Expect(charge.FeeAmount).To(BeEquivalentTo(models.ToCurrency(3)))
+		refund := create(models.TypeRefund, 50, charge)
+		Expect(refund.FeeAmount).To(BeEquivalentTo(-int64(models.ToCurrency(1.5))))
+
+		m, err := merchantStore.GetMerchantByEmail(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(m.TotalTransactionSum[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(60)))
+		Expect(m.TotalFeeSum[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(1.5)))
+		Expect(m.NetTransactionSum()[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(58.5)))
+
+		Expect(feePlanStore.DeleteFeePlan(context.Background(), merchant.UserID)).To(Succeed())
+		Expect(feePlanStore.DeleteFeePlan(context.Background(), merchant.UserID)).To(MatchError(models.ErrFeePlanNotFound))
+	})
+})
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+
+	idempotencyKeyUniqueConstraint     = "idempotency_key_merchant_id_key_unique"
+	transactionExtUUIDUniqueConstraint = "transaction_ext_uuid_unique"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyKeyConflict is returned when an idempotency key has been stored concurrently.
+	ErrIdempotencyKeyConflict = errors.New("idempotency key is already stored")
+	// ErrDuplicateTransaction is returned when a transaction with the same UUID already exists.
+	ErrDuplicateTransaction = errors.New("transaction with the same uuid already exists")
+)
+
+// IdempotencyKey stores the fingerprint of a request together with the response
+// which was returned for it, so that retries of the same request can be replayed.
+type IdempotencyKey struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	MerchantID    uint
+	TransactionID *uint
+	Key           string `gorm:"column:_key"`
+
+	RequestHash    string
+	ResponseStatus int
+	ResponseBody   []byte
+}
+
+func NewIdempotencyKey(merchantID uint, key string, request []byte) (*IdempotencyKey, error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("while creating idempotency key: key must be between 1 and %d characters long", maxIdempotencyKeyLength)
+	}
+	hash := sha256.Sum256(request)
+	return &IdempotencyKey{
+		MerchantID:  merchantID,
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// Matches reports whether other was created for the same request as k.
+func (k *IdempotencyKey) Matches(other *IdempotencyKey) bool {
+	return k.MerchantID == other.MerchantID && k.Key == other.Key && k.RequestHash == other.RequestHash
+}
+
+type IdempotencyStore struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyStore(db *gorm.DB) *IdempotencyStore {
+	return &IdempotencyStore{db: db}
+}
+
+// GetIdempotencyKey returns the stored idempotency key of a merchant or nil if it has not been used yet.
+func (s *IdempotencyStore) GetIdempotencyKey(ctx context.Context, merchantID uint, key string) (*IdempotencyKey, error) {
+	var k IdempotencyKey
+	err := s.db.WithContext(ctx).Where("merchant_id = ? AND _key = ?", merchantID, key).First(&k).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while getting idempotency key: %w", err)
+	}
+	return &k, nil
+}
@@ -0,0 +1,100 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const IdempotencyTestSchemaName = "payment_system_idempotency_test"
+
+var _ = Describe("Using NewIdempotencyKey", func() {
+	It("creates matching keys for the same request", func() {
+		k1, err := models.NewIdempotencyKey(1, "key", []byte(`{"Amount":1}`))
+		Expect(err).To(BeNil())
+		k2, err := models.NewIdempotencyKey(1, "key", []byte(`{"Amount":1}`))
+		Expect(err).To(BeNil())
+		Expect(k1.Matches(k2)).To(BeTrue())
+	})
+	It("creates keys which do not match for different requests", func() {
+		k1, err := models.NewIdempotencyKey(1, "key", []byte(`{"Amount":1}`))
+		Expect(err).To(BeNil())
+		k2, err := models.NewIdempotencyKey(1, "key", []byte(`{"Amount":2}`))
+		Expect(err).To(BeNil())
+		Expect(k1.Matches(k2)).To(BeFalse())
+	})
+	It("fails to create key when it is empty or too long", func() {
+		_, err := models.NewIdempotencyKey(1, "", nil)
+		Expect(err).NotTo(BeNil())
+		_, err = models.NewIdempotencyKey(1, strings.Repeat("k", 256), nil)
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Using IdempotencyStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		idempotencyStore *models.IdempotencyStore
+		merchant         *models.Merchant
+		err              error
+		render           = func(t *models.Transaction) (int, []byte, error) {
+			return http.StatusCreated, []byte(t.ExternalID), nil
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, IdempotencyTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		idempotencyStore = models.NewIdempotencyStore(gormDB)
+		merchant, err = models.NewMerchant("Idempotent Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+
+		err = merchantStore.CreateMerchant(context.Background(), merchant)
+		Expect(err).To(BeNil())
+	})
+
+	It("stores the key together with the created transaction", func() {
+		transaction, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "ic@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		key, err := models.NewIdempotencyKey(merchant.UserID, transaction.ExternalID, []byte("request"))
+		Expect(err).To(BeNil())
+
+		err = transactionStore.CreateTransactionIdempotently(context.Background(), transaction, key, render)
+		Expect(err).To(BeNil())
+
+		stored, err := idempotencyStore.GetIdempotencyKey(context.Background(), merchant.UserID, key.Key)
+		Expect(err).To(BeNil())
+		Expect(stored).NotTo(BeNil())
+		Expect(stored.Matches(key)).To(BeTrue())
+		Expect(*stored.TransactionID).To(Equal(transaction.ID))
+		Expect(stored.ResponseStatus).To(Equal(http.StatusCreated))
+		Expect(stored.ResponseBody).To(BeEquivalentTo(transaction.ExternalID))
+
+		retried, err := models.NewTransaction(transaction.ExternalID, models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "ic@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		err = transactionStore.CreateTransactionIdempotently(context.Background(), retried, key, render)
+		Expect(err).To(MatchError(models.ErrDuplicateTransaction))
+
+		other, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "ic@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		err = transactionStore.CreateTransactionIdempotently(context.Background(), other, key, render)
+		Expect(err).To(MatchError(models.ErrIdempotencyKeyConflict))
+	})
+
+	It("returns nil for keys which were not used", func() {
+		stored, err := idempotencyStore.GetIdempotencyKey(context.Background(), merchant.UserID, uuid.Generate().String())
+		Expect(err).To(BeNil())
+		Expect(stored).To(BeNil())
+	})
+})
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrUnbalancedJournalEntry is returned when the postings of a journal entry do not sum up to zero.
+var ErrUnbalancedJournalEntry = errors.New("journal entry postings must sum up to zero")
+
+type LedgerAccountType string
+
+const (
+	// AccountMerchantBalance holds the captured funds of a merchant
+	AccountMerchantBalance LedgerAccountType = "MERCHANT_BALANCE"
+	// AccountMerchantHolds holds the authorized but not yet captured funds of a merchant
+	AccountMerchantHolds LedgerAccountType = "MERCHANT_HOLDS"
+	// AccountCustomerFunds is the counterpart of AccountMerchantBalance
+	AccountCustomerFunds LedgerAccountType = "CUSTOMER_FUNDS"
+	// AccountCustomerHolds is the counterpart of AccountMerchantHolds
+	AccountCustomerHolds LedgerAccountType = "CUSTOMER_HOLDS"
+	// AccountMerchantFees holds the fees charged to a merchant
+	AccountMerchantFees LedgerAccountType = "MERCHANT_FEES"
+	// AccountPlatformRevenue is the counterpart of AccountMerchantFees
+	AccountPlatformRevenue LedgerAccountType = "PLATFORM_REVENUE"
+)
+
+func NewLedgerAccountType(s string) (LedgerAccountType, error) {
+	return enumFactory(s, AccountMerchantBalance, AccountMerchantHolds, AccountCustomerFunds, AccountCustomerHolds, AccountMerchantFees, AccountPlatformRevenue)
+}
+
+func (lat *LedgerAccountType) Scan(value interface{}) error {
+	return scanEnumValue(lat, value)
+}
+
+func (lat LedgerAccountType) Value() (driver.Value, error) {
+	return string(lat), nil
+}
+
+type LedgerAccount struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	MerchantID   uint
+	Type         LedgerAccountType `gorm:"column:_type;type:ledger_account_type"`
+	CurrencyCode CurrencyCode      `gorm:"type:char(3)"`
+}
+
+type JournalEntry struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	MerchantID    uint
+	TransactionID *uint
+	Description   string
+
+	Postings []Posting
+}
+
+// Posting is a single line of a JournalEntry. Debits are positive and credits are negative amounts.
+type Posting struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	JournalEntryID uint
+	AccountID      uint
+	Amount         int64
+}
+
+// postingLine is a posting to an account of a merchant which is not resolved yet
+type postingLine struct {
+	accountType LedgerAccountType
+	amount      int64
+}
+
+// journalLines returns the balanced posting lines describing the money movement of t including its fee.
+// It has to be called before t is applied to its parent.
+func journalLines(t *Transaction) []postingLine {
+	lines := amountJournalLines(t)
+	if t.FeeAmount != 0 {
+		lines = append(lines, postingLine{AccountMerchantFees, t.FeeAmount}, postingLine{AccountPlatformRevenue, -t.FeeAmount})
+	}
+	return lines
+}
+
+// amountJournalLines returns the balanced posting lines describing the movement of the amount of t
+func amountJournalLines(t *Transaction) []postingLine {
+	amount := int64(t.Amount)
+	switch t.Type {
+	case TypeAuthorize:
+		return []postingLine{{AccountMerchantHolds, amount}, {AccountCustomerHolds, -amount}}
+	case TypeCharge:
+		lines := []postingLine{{AccountMerchantBalance, amount}, {AccountCustomerFunds, -amount}}
+		if t.parent != nil {
+			lines = append(lines, postingLine{AccountMerchantHolds, -amount}, postingLine{AccountCustomerHolds, amount})
+		}
+		return lines
+	case TypeRefund:
+		return []postingLine{{AccountMerchantBalance, -amount}, {AccountCustomerFunds, amount}}
+	case TypeReversal:
+		return []postingLine{{AccountMerchantHolds, -amount}, {AccountCustomerHolds, amount}}
+	case TypeChargeback:
+		return []postingLine{{AccountMerchantBalance, -amount}, {AccountCustomerFunds, amount}}
+	case TypeChargebackReversal:
+		return []postingLine{{AccountMerchantBalance, amount}, {AccountCustomerFunds, -amount}}
+	default:
+		return nil
+	}
+}
+
+// writeJournalEntry writes the journal entry of t using tx, which has to be the DB transaction creating t
+func writeJournalEntry(tx *gorm.DB, t *Transaction) error {
+	lines := journalLines(t)
+	if len(lines) == 0 {
+		return nil
+	}
+	entry := &JournalEntry{
+		MerchantID:    t.MerchantID,
+		TransactionID: &t.ID,
+		Description:   fmt.Sprintf("%s %s", t.Type, t.ExternalID),
+		Postings:      make([]Posting, 0, len(lines)),
+	}
+	var sum int64
+	for _, line := range lines {
+		account, err := getOrCreateLedgerAccount(tx, t.MerchantID, line.accountType, t.CurrencyCode)
+		if err != nil {
+			return err
+		}
+		entry.Postings = append(entry.Postings, Posting{AccountID: account.ID, Amount: line.amount})
+		sum += line.amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("while writing journal entry for transaction %s: %w", t.ExternalID, ErrUnbalancedJournalEntry)
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("while writing journal entry for transaction %s: %w", t.ExternalID, err)
+	}
+	return nil
+}
+
+func getOrCreateLedgerAccount(tx *gorm.DB, merchantID uint, accountType LedgerAccountType, currencyCode CurrencyCode) (*LedgerAccount, error) {
+	account := &LedgerAccount{MerchantID: merchantID, Type: accountType, CurrencyCode: currencyCode}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(account)
+	if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while creating %s ledger account: %w", accountType, err)
+	}
+	if res.RowsAffected > 0 {
+		return account, nil
+	}
+	res = tx.Where("merchant_id = ? AND _type = ? AND currency_code = ?", merchantID, accountType, currencyCode).First(account)
+	if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting %s ledger account: %w", accountType, err)
+	}
+	return account, nil
+}
+
+// merchantBalances returns the balances of all accounts of accountType as of asOf, grouped by merchant and currency
+func merchantBalances(db *gorm.DB, accountType LedgerAccountType, asOf time.Time, merchantIDs ...uint) (map[uint]CurrencyTotals, error) {
+	var rows []struct {
+		MerchantID   uint
+		CurrencyCode CurrencyCode
+		Balance      int64
+	}
+	query := db.Table("posting").
+		Select("ledger_account.merchant_id, ledger_account.currency_code, SUM(posting.amount) AS balance").
+		Joins("JOIN ledger_account ON ledger_account.id = posting.account_id").
+		Where("ledger_account._type = ? AND posting.created_at <= ?", accountType, asOf).
+		Group("ledger_account.merchant_id, ledger_account.currency_code")
+	if len(merchantIDs) > 0 {
+		query = query.Where("ledger_account.merchant_id IN ?", merchantIDs)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("while getting %s balances: %w", accountType, err)
+	}
+	balances := make(map[uint]CurrencyTotals)
+	for _, row := range rows {
+		totals := balances[row.MerchantID]
+		totals.Add(row.CurrencyCode, row.Balance)
+		balances[row.MerchantID] = totals
+	}
+	return balances, nil
+}
+
+type LedgerStore struct {
+	db *gorm.DB
+}
+
+func NewLedgerStore(db *gorm.DB) *LedgerStore {
+	return &LedgerStore{db: db}
+}
+
+func (s *LedgerStore) GetAccount(ctx context.Context, merchantID uint, accountType LedgerAccountType, currencyCode CurrencyCode) (*LedgerAccount, error) {
+	var a LedgerAccount
+	err := s.db.WithContext(ctx).Where("merchant_id = ? AND _type = ? AND currency_code = ?", merchantID, accountType, currencyCode).First(&a).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting ledger account: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAccountBalance returns the sum of all postings to an account made until asOf
+func (s *LedgerStore) GetAccountBalance(ctx context.Context, accountID uint, asOf time.Time) (int64, error) {
+	var balance int64
+	err := s.db.WithContext(ctx).Model(&Posting{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND created_at <= ?", accountID, asOf).
+		Scan(&balance).Error
+	if err != nil {
+		return 0, fmt.Errorf("while getting ledger account balance: %w", err)
+	}
+	return balance, nil
+}
+
+// GetMerchantBalances returns the balances of the merchant accounts of accountType as of asOf per currency
+func (s *LedgerStore) GetMerchantBalances(ctx context.Context, merchantID uint, accountType LedgerAccountType, asOf time.Time) (CurrencyTotals, error) {
+	balances, err := merchantBalances(s.db.WithContext(ctx), accountType, asOf, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return balances[merchantID], nil
+}
+
+func (s *LedgerStore) GetJournalEntries(ctx context.Context, transactionID uint) ([]*JournalEntry, error) {
+	var es []*JournalEntry
+	err := s.db.WithContext(ctx).Where("transaction_id = ?", transactionID).Preload("Postings").Order("id").Find(&es).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting journal entries: %w", err)
+	}
+	return es, nil
+}
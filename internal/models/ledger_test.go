@@ -0,0 +1,103 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const LedgerTestSchemaName = "payment_system_ledger_test"
+
+var _ = Describe("Using LedgerStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		ledgerStore      *models.LedgerStore
+		merchant         *models.Merchant
+		err              error
+		balance          = func(accountType models.LedgerAccountType, asOf time.Time) int64 {
+			account, err := ledgerStore.GetAccount(context.Background(), merchant.UserID, accountType, models.DefaultCurrencyCode)
+			Expect(err).To(BeNil())
+			b, err := ledgerStore.GetAccountBalance(context.Background(), account.ID, asOf)
+			Expect(err).To(BeNil())
+			return b
+		}
+		create = func(amount float64, _type models.TransactionType, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, merchant, _type, models.StatusApproved, amount, "lc@mail.bg", "0889787878", belongsTo)
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, LedgerTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		ledgerStore = models.NewLedgerStore(gormDB)
+		merchant, err = models.NewMerchant("Ledger Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+
+		err = merchantStore.CreateMerchant(context.Background(), merchant)
+		Expect(err).To(BeNil())
+	})
+
+	It("writes balanced postings for every transaction", func() {
+		authorize := create(100, models.TypeAuthorize, nil)
+		Expect(balance(models.AccountMerchantHolds, time.Now())).To(BeEquivalentTo(models.ToCurrency(100)))
+		Expect(balance(models.AccountCustomerHolds, time.Now())).To(BeEquivalentTo(-int64(models.ToCurrency(100))))
+		beforeCharge := time.Now()
+
+		charge := create(60, models.TypeCharge, authorize)
+		Expect(balance(models.AccountMerchantHolds, time.Now())).To(BeEquivalentTo(models.ToCurrency(40)))
+		Expect(balance(models.AccountMerchantBalance, time.Now())).To(BeEquivalentTo(models.ToCurrency(60)))
+		Expect(balance(models.AccountMerchantBalance, beforeCharge)).To(BeZero())
+
+		create(25, models.TypeRefund, charge)
+		Expect(balance(models.AccountMerchantBalance, time.Now())).To(BeEquivalentTo(models.ToCurrency(35)))
+		Expect(balance(models.AccountCustomerFunds, time.Now())).To(BeEquivalentTo(-int64(models.ToCurrency(35))))
+
+		entries, err := ledgerStore.GetJournalEntries(context.Background(), charge.ID)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Postings).To(HaveLen(4))
+		var sum int64
+		for _, p := range entries[0].Postings {
+			sum += p.Amount
+		}
+		Expect(sum).To(BeZero())
+
+		balances, err := ledgerStore.GetMerchantBalances(context.Background(), merchant.UserID, models.AccountMerchantBalance, time.Now())
+		Expect(err).To(BeNil())
+		Expect(balances[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(35)))
+
+		returnedMerchant, err := merchantStore.GetMerchantById(context.Background(), merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(returnedMerchant.TotalTransactionSum).To(Equal(balances))
+	})
+
+	It("does not post transactions in error status", func() {
+		authorize := create(100, models.TypeAuthorize, nil)
+		create(100, models.TypeReversal, authorize)
+		Expect(balance(models.AccountMerchantHolds, time.Now())).To(BeZero())
+
+		t, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(100), models.DefaultCurrencyCode, models.TypeReversal, models.StatusError, "lc@mail.bg", "0889787878", merchant.UserID, &authorize.ID)
+		Expect(err).To(BeNil())
+		Expect(transactionStore.CreateTransaction(context.Background(), t)).To(Succeed())
+
+		entries, err := ledgerStore.GetJournalEntries(context.Background(), t.ID)
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("leaves the total transaction sum empty for merchants without postings", func() {
+		returnedMerchant, err := merchantStore.GetMerchantById(context.Background(), merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(returnedMerchant.TotalTransactionSum).To(BeNil())
+	})
+})
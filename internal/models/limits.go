@@ -0,0 +1,226 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LimitType names one of the limits of MerchantLimits
+type LimitType string
+
+const (
+	LimitMaxAmount     LimitType = "MAX_AMOUNT"
+	LimitDailyVolume   LimitType = "DAILY_VOLUME"
+	LimitMonthlyVolume LimitType = "MONTHLY_VOLUME"
+	LimitDailyCount    LimitType = "DAILY_COUNT"
+	LimitRefundRatio   LimitType = "REFUND_RATIO"
+)
+
+const (
+	// dailyLimitWindow and monthlyLimitWindow are the rolling windows daily and monthly limits are checked in
+	dailyLimitWindow   = 24 * time.Hour
+	monthlyLimitWindow = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrLimitsNotFound is returned when a merchant has no limits
+	ErrLimitsNotFound = errors.New("limits not found")
+	// ErrInvalidLimits is returned when limits have an unsupported currency or an invalid refund ratio
+	ErrInvalidLimits = errors.New("invalid limits")
+	// ErrLimitExceeded is returned when creating a transaction would exceed a limit of its merchant
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// LimitExceededError describes the limit of a merchant which a transaction would exceed
+type LimitExceededError struct {
+	Limit LimitType
+	// Detail describes the limit and the value it would be exceeded with
+	Detail string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s %v: %s", e.Limit, ErrLimitExceeded, e.Detail)
+}
+
+func (e *LimitExceededError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// MerchantLimits caps the transactions a merchant can create. Zero values mean that the respective limit is not set.
+// Amount limits are in the minor units of CurrencyCode and only apply to transactions in that currency.
+// Amounts and volumes count AUTHORIZE and CHARGE transactions which do not belong to another transaction,
+// so that captures of authorizations are not counted twice, and DailyCount counts them in any currency.
+// MaxRefundBasisPoints caps the REFUNDs of the last 30 days as a share of the CHARGEs in the same period.
+type MerchantLimits struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	MerchantID   uint
+	Merchant     Merchant
+	CurrencyCode CurrencyCode `gorm:"type:char(3)"`
+
+	MaxAmount            Currency `gorm:"type:bigint"`
+	DailyVolume          Currency `gorm:"type:bigint"`
+	MonthlyVolume        Currency `gorm:"type:bigint"`
+	DailyCount           uint
+	MaxRefundBasisPoints uint
+}
+
+// NewMerchantLimits returns limits of the merchant with merchantID
+func NewMerchantLimits(merchantID uint, currencyCode CurrencyCode, maxAmount, dailyVolume, monthlyVolume Currency, dailyCount, maxRefundBasisPoints uint) (*MerchantLimits, error) {
+	if !currencyCode.Valid() {
+		return nil, fmt.Errorf("%w: %q is not a supported currency code", ErrInvalidLimits, currencyCode)
+	}
+	if maxRefundBasisPoints > 10_000 {
+		return nil, fmt.Errorf("%w: refund ratio cannot exceed 100 percent", ErrInvalidLimits)
+	}
+	return &MerchantLimits{
+		MerchantID:           merchantID,
+		CurrencyCode:         currencyCode,
+		MaxAmount:            maxAmount,
+		DailyVolume:          dailyVolume,
+		MonthlyVolume:        monthlyVolume,
+		DailyCount:           dailyCount,
+		MaxRefundBasisPoints: maxRefundBasisPoints,
+	}, nil
+}
+
+// check returns a LimitExceededError if creating t would exceed l. It has to be called
+// in the DB transaction t is created in after l has been locked, so that concurrent
+// transactions of the merchant are checked one after another.
+func (l *MerchantLimits) check(tx *gorm.DB, t *Transaction) error {
+	now := time.Now()
+	if t.BelongsToID == nil && (t.Type == TypeAuthorize || t.Type == TypeCharge) {
+		if l.DailyCount > 0 {
+			var count int64
+			if err := l.limitedTransactions(tx, now.Add(-dailyLimitWindow)).Count(&count).Error; err != nil {
+				return fmt.Errorf("while counting daily transactions: %w", err)
+			}
+			if count >= int64(l.DailyCount) {
+				return &LimitExceededError{Limit: LimitDailyCount, Detail: fmt.Sprintf("at most %d transactions can be created per day", l.DailyCount)}
+			}
+		}
+		if t.CurrencyCode != l.CurrencyCode {
+			return nil
+		}
+		if l.MaxAmount > 0 && t.Amount > l.MaxAmount {
+			return &LimitExceededError{Limit: LimitMaxAmount, Detail: fmt.Sprintf("amount of %s exceeds %s", l.CurrencyCode.Format(t.Amount), l.CurrencyCode.Format(l.MaxAmount))}
+		}
+		volumes := []struct {
+			limit  LimitType
+			max    Currency
+			window time.Duration
+		}{
+			{LimitDailyVolume, l.DailyVolume, dailyLimitWindow},
+			{LimitMonthlyVolume, l.MonthlyVolume, monthlyLimitWindow},
+		}
+		for _, v := range volumes {
+			if v.max == 0 {
+				continue
+			}
+			var volume Currency
+			err := l.limitedTransactions(tx, now.Add(-v.window)).Where("currency_code = ?", l.CurrencyCode).
+				Select("COALESCE(SUM(amount), 0)").Scan(&volume).Error
+			if err != nil {
+				return fmt.Errorf("while summing %s: %w", v.limit, err)
+			}
+			if volume+t.Amount > v.max {
+				return &LimitExceededError{Limit: v.limit, Detail: fmt.Sprintf("volume of %s exceeds %s", l.CurrencyCode.Format(volume+t.Amount), l.CurrencyCode.Format(v.max))}
+			}
+		}
+		return nil
+	}
+	if t.Type != TypeRefund || l.MaxRefundBasisPoints == 0 || t.CurrencyCode != l.CurrencyCode {
+		return nil
+	}
+	sums := struct {
+		Charged  Currency
+		Refunded Currency
+	}{}
+	err := tx.Model(&Transaction{}).
+		Select("COALESCE(SUM(amount) FILTER (WHERE _type = ?), 0) AS charged, COALESCE(SUM(amount) FILTER (WHERE _type = ?), 0) AS refunded", TypeCharge, TypeRefund).
+		Where("merchant_id = ? AND currency_code = ? AND status <> ? AND created_at >= ?", l.MerchantID, l.CurrencyCode, StatusError, now.Add(-monthlyLimitWindow)).
+		Scan(&sums).Error
+	if err != nil {
+		return fmt.Errorf("while summing charges and refunds: %w", err)
+	}
+	refunded := sums.Refunded + t.Amount
+	if uint64(refunded)*10_000 > uint64(sums.Charged)*uint64(l.MaxRefundBasisPoints) {
+		return &LimitExceededError{Limit: LimitRefundRatio, Detail: fmt.Sprintf("refunds of %s exceed %.2f%% of the %s charged in the last 30 days",
+			l.CurrencyCode.Format(refunded), float64(l.MaxRefundBasisPoints)/100, l.CurrencyCode.Format(sums.Charged))}
+	}
+	return nil
+}
+
+// limitedTransactions returns a query of the transactions of the merchant of l created since, which count towards its limits
+func (l *MerchantLimits) limitedTransactions(tx *gorm.DB, since time.Time) *gorm.DB {
+	return tx.Model(&Transaction{}).Where("merchant_id = ? AND belongs_to IS NULL AND _type IN ? AND status <> ? AND created_at >= ?",
+		l.MerchantID, []TransactionType{TypeAuthorize, TypeCharge}, StatusError, since)
+}
+
+// checkLimits returns a LimitExceededError if creating t would exceed the limits of its merchant.
+// Transactions in ERROR status and system generated transactions are not limited.
+func checkLimits(tx *gorm.DB, t *Transaction) error {
+	if t.Status == StatusError || t.SystemGenerated {
+		return nil
+	}
+	l := &MerchantLimits{}
+	res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("merchant_id = ?", t.MerchantID).First(l)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil
+	} else if res.Error != nil {
+		return fmt.Errorf("while locking limits: %w", res.Error)
+	}
+	return l.check(tx, t)
+}
+
+type LimitsStore struct {
+	db *gorm.DB
+}
+
+func NewLimitsStore(db *gorm.DB) *LimitsStore {
+	return &LimitsStore{db: db}
+}
+
+// GetLimits returns the limits of the merchant with merchantID
+func (s *LimitsStore) GetLimits(ctx context.Context, merchantID uint) (*MerchantLimits, error) {
+	l := &MerchantLimits{}
+	res := s.db.WithContext(ctx).Where("merchant_id = ?", merchantID).First(l)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrLimitsNotFound
+	} else if res.Error != nil {
+		return nil, fmt.Errorf("while getting limits: %w", res.Error)
+	}
+	return l, nil
+}
+
+// SetLimits replaces the limits of the merchant of l with l. Existing transactions are not affected.
+func (s *LimitsStore) SetLimits(ctx context.Context, l *MerchantLimits) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("merchant_id = ?", l.MerchantID).Delete(&MerchantLimits{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit("Merchant").Create(l).Error
+	})
+	if err != nil {
+		return fmt.Errorf("while setting limits: %w", err)
+	}
+	return nil
+}
+
+// DeleteLimits removes the limits of the merchant with merchantID
+func (s *LimitsStore) DeleteLimits(ctx context.Context, merchantID uint) error {
+	res := s.db.WithContext(ctx).Where("merchant_id = ?", merchantID).Delete(&MerchantLimits{})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while deleting limits: %w", err)
+	} else if res.RowsAffected == 0 {
+		return ErrLimitsNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const LimitsTestSchemaName = "payment_system_limits_test"
+
+var _ = Describe("Using LimitsStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		limitsStore      *models.LimitsStore
+		merchant         *models.Merchant
+		err              error
+		create           = func(_type models.TransactionType, amount float64, belongsTo *models.Transaction) (*models.Transaction, error) {
+			t := newTestTransaction(merchant, _type, models.StatusApproved, amount, "limits@mail.bg", "0889787878", belongsTo)
+			return t, transactionStore.CreateTransaction(context.Background(), t)
+		}
+		exceeded = func(err error) models.LimitType {
+			var limitErr *models.LimitExceededError
+			Expect(errors.As(err, &limitErr)).To(BeTrue())
+			Expect(errors.Is(err, models.ErrLimitExceeded)).To(BeTrue())
+			return limitErr.Limit
+		}
+		setLimits = func(maxAmount, dailyVolume, monthlyVolume float64, dailyCount, maxRefundBasisPoints uint) {
+			l, err := models.NewMerchantLimits(merchant.UserID, models.DefaultCurrencyCode, models.ToCurrency(maxAmount), models.ToCurrency(dailyVolume), models.ToCurrency(monthlyVolume), dailyCount, maxRefundBasisPoints)
+			Expect(err).To(BeNil())
+			Expect(limitsStore.SetLimits(context.Background(), l)).To(Succeed())
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, LimitsTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		limitsStore = models.NewLimitsStore(gormDB)
+		merchant, err = models.NewMerchant("Limits Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("rejects transactions exceeding the amount, volume and count limits", func() {
+		setLimits(100, 150, 0, 2, 0)
+		_, err = create(models.TypeCharge, 101, nil)
+		Expect(exceeded(err)).To(Equal(models.LimitMaxAmount))
+
+		authorize, err := create(models.TypeAuthorize, 100, nil)
+		Expect(err).To(BeNil())
+		// captures are not counted towards the volume again
+		_, err = create(models.TypeCharge, 100, authorize)
+		Expect(err).To(BeNil())
+		_, err = create(models.TypeCharge, 51, nil)
+		Expect(exceeded(err)).To(Equal(models.LimitDailyVolume))
+
+		_, err = create(models.TypeCharge, 25, nil)
+		Expect(err).To(BeNil())
+		_, err = create(models.TypeCharge, 25, nil)
+		Expect(exceeded(err)).To(Equal(models.LimitDailyCount))
+
+		Expect(limitsStore.DeleteLimits(context.Background(), merchant.UserID)).To(Succeed())
+		_, err = create(models.TypeCharge, 500, nil)
+		Expect(err).To(BeNil())
+		Expect(limitsStore.DeleteLimits(context.Background(), merchant.UserID)).To(MatchError(models.ErrLimitsNotFound))
+	})
+
+	It("rejects refunds exceeding the refund ratio", func() {
+		setLimits(0, 0, 0, 0, 1_000)
+		charge, err := create(models.TypeCharge, 100, nil)
+		Expect(err).To(BeNil())
+		_, err = create(models.TypeRefund, 11, charge)
+		Expect(exceeded(err)).To(Equal(models.LimitRefundRatio))
+		_, err = create(models.TypeRefund, 10, charge)
+		Expect(err).To(BeNil())
+
+		l, err := limitsStore.GetLimits(context.Background(), merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(l.MaxRefundBasisPoints).To(Equal(uint(1_000)))
+	})
+
+	It("validates limits", func() {
+		_, err = models.NewMerchantLimits(merchant.UserID, "XXX", 0, 0, 0, 0, 0)
+		Expect(errors.Is(err, models.ErrInvalidLimits)).To(BeTrue())
+		_, err = models.NewMerchantLimits(merchant.UserID, models.DefaultCurrencyCode, 0, 0, 0, 0, 10_001)
+		Expect(errors.Is(err, models.ErrInvalidLimits)).To(BeTrue())
+	})
+})
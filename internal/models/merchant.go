@@ -6,26 +6,43 @@ import (
 	"fmt"
 	"net/mail"
 	"strings"
-
-	"github.com/jackc/pgx/v5/pgconn"
+	"time"
 
 	"gorm.io/gorm/clause"
 
 	"gorm.io/gorm"
 )
 
+// ErrMerchantNotFound is returned when there is no merchant with the requested email
+var ErrMerchantNotFound = errors.New("merchant not found")
+
 type Merchant struct {
 	UserID uint `gorm:"primaryKey"`
 	User   User
 
-	Name                string
-	TotalTransactionSum Currency `gorm:"-"`
-	Description         string
-	Email               string
+	Name string
+	// TotalTransactionSum is the gross balance of the merchant before fees
+	TotalTransactionSum CurrencyTotals `gorm:"-"`
+	// TotalFeeSum is the sum of the fees charged to the merchant
+	TotalFeeSum CurrencyTotals `gorm:"-"`
+	Description string
+	Email       string
 
 	Transactions []Transaction `gorm:"->"`
 }
 
+// NetTransactionSum returns the balance of the merchant after fees
+func (m *Merchant) NetTransactionSum() CurrencyTotals {
+	var net CurrencyTotals
+	for code, amount := range m.TotalTransactionSum {
+		net.Add(code, amount)
+	}
+	for code, fee := range m.TotalFeeSum {
+		net.Add(code, -fee)
+	}
+	return net
+}
+
 func NewMerchant(name string, description string, email string, status UserStatus) (*Merchant, error) {
 	_, err := mail.ParseAddress(email)
 	if err != nil {
@@ -37,28 +54,6 @@ func NewMerchant(name string, description string, email string, status UserStatu
 	}}, nil
 }
 
-func (m *Merchant) BeforeUpdate(tx *gorm.DB) error {
-	merchantWithID := Merchant{}
-	res := tx.Model(&merchantWithID).Where("email = ?", m.Email).First(&merchantWithID)
-	if err := res.Error; err != nil {
-		return fmt.Errorf("while preloading user_id for merchant in before update hook: %w", err)
-	}
-	res = tx.Model(User{}).Where("id = ?", merchantWithID.UserID).Update("status", m.User.Status)
-	if err := res.Error; err != nil {
-		return fmt.Errorf("while updating user in merchant before update hook: %w", err)
-	}
-	return nil
-}
-
-func (m *Merchant) calculateTTS() {
-	m.TotalTransactionSum = Currency(0)
-	for _, t := range m.Transactions {
-		if t.Status == StatusApproved && t.Type == TypeCharge {
-			m.TotalTransactionSum += t.Amount
-		}
-	}
-}
-
 func (m *Merchant) buildTransactionRelations() {
 	tm := make(map[uint]*Transaction, 0)
 	for i := range m.Transactions {
@@ -93,9 +88,11 @@ func (s *MerchantStore) GetAllMerchants(ctx context.Context) ([]*Merchant, error
 	if err != nil {
 		return nil, fmt.Errorf("while getting all merchants: %w", err)
 	}
+	if err = s.loadTotalTransactionSums(ctx, ms...); err != nil {
+		return nil, err
+	}
 	for i := range ms {
 		if ms[i] != nil {
-			ms[i].calculateTTS()
 			ms[i].buildTransactionRelations()
 		}
 	}
@@ -112,28 +109,88 @@ func (s *MerchantStore) GetMerchantByEmail(ctx context.Context, email string) (*
 }
 
 func (s *MerchantStore) UpdateMerchant(ctx context.Context, m *Merchant) error {
-	res := s.db.WithContext(ctx).Model(m).Omit(clause.Associations).Where("email = ?", m.Email).Updates(map[string]interface{}{"name": m.Name, "description": m.Description, "email": m.Email})
-	if err := res.Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(m).Omit(clause.Associations).Where("email = ?", m.Email).Updates(map[string]interface{}{"name": m.Name, "description": m.Description, "email": m.Email})
+		if err := res.Error; err != nil {
+			return err
+		}
+		return writeMerchantUpdatedEvent(tx, m.Email)
+	})
+	if err != nil {
 		return fmt.Errorf("while updating merchant: %w", err)
 	}
 	return nil
 }
 
+// UpdateMerchantStatus activates or deactivates the merchant with email
+func (s *MerchantStore) UpdateMerchantStatus(ctx context.Context, email string, status UserStatus) error {
+	email = strings.ToLower(email)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&User{}).
+			Where("id = (SELECT user_id FROM merchant WHERE email = ?)", email).
+			Update("status", status)
+		if err := res.Error; err != nil {
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrMerchantNotFound
+		}
+		return writeMerchantUpdatedEvent(tx, email)
+	})
+	if errors.Is(err, ErrMerchantNotFound) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("while updating merchant status: %w", err)
+	}
+	return nil
+}
+
 func (s *MerchantStore) getMerchantByCondition(ctx context.Context, condition string, arg any) (*Merchant, error) {
 	var m *Merchant
 	err := s.db.WithContext(ctx).Model(&Merchant{}).Where(condition, arg).Preload("User").Preload("Transactions").First(&m).Error
 	if err != nil {
 		return nil, fmt.Errorf("while getting merchantwith condition %q: %w", condition, err)
 	}
-	m.calculateTTS()
+	if err = s.loadTotalTransactionSums(ctx, m); err != nil {
+		return nil, err
+	}
 	m.buildTransactionRelations()
 	return m, nil
 }
 
+// loadTotalTransactionSums sets the total transaction and fee sums of each merchant to its current ledger balances
+func (s *MerchantStore) loadTotalTransactionSums(ctx context.Context, ms ...*Merchant) error {
+	ids := make([]uint, 0, len(ms))
+	for _, m := range ms {
+		if m != nil {
+			ids = append(ids, m.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	balances, err := merchantBalances(s.db.WithContext(ctx), AccountMerchantBalance, now, ids...)
+	if err != nil {
+		return fmt.Errorf("while getting total transaction sums: %w", err)
+	}
+	fees, err := merchantBalances(s.db.WithContext(ctx), AccountMerchantFees, now, ids...)
+	if err != nil {
+		return fmt.Errorf("while getting total fee sums: %w", err)
+	}
+	for _, m := range ms {
+		if m != nil {
+			m.TotalTransactionSum = balances[m.UserID]
+			m.TotalFeeSum = fees[m.UserID]
+		}
+	}
+	return nil
+}
+
 func (s *MerchantStore) DeleteMerchant(ctx context.Context, email string) error {
 	res := s.db.WithContext(ctx).Where("email = ?", email).Delete(&Merchant{})
 	if err := res.Error; err != nil {
-		if pqError, ok := err.(*pgconn.PgError); ok && pqError.Code == "23503" {
+		if pgConstraintViolation(err, pgForeignKeyViolationCode, "") {
 			return errors.New("merchant is still referenced by transactions")
 		}
 		return fmt.Errorf("while deleting merchant: %w", err)
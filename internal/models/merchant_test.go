@@ -63,9 +63,18 @@ var _ = Describe("Using MerchantStore", func() {
 			err := merchantStore.CreateMerchant(context.Background(), updatedMerchant)
 			Expect(err).To(BeNil())
 
+			updatedMerchant.Name = "Updated name"
 			updatedMerchant.User.Status = models.StatusInactive
 			err = merchantStore.UpdateMerchant(context.Background(), updatedMerchant)
 			Expect(err).To(BeNil())
+
+			m, err := merchantStore.GetMerchantByEmail(context.Background(), updatedMerchant.Email)
+			Expect(err).To(BeNil())
+			Expect(m.Name).To(Equal("Updated name"))
+			Expect(m.User.Status).To(Equal(models.StatusActive))
+
+			err = merchantStore.UpdateMerchantStatus(context.Background(), updatedMerchant.Email, models.StatusInactive)
+			Expect(err).To(BeNil())
 		})
 
 		It("gets all previously created merchants", func() {
@@ -95,13 +104,14 @@ var _ = Describe("Using MerchantStore", func() {
 			err := merchantStore.CreateMerchant(context.Background(), merchantWithTransactions)
 			Expect(err).To(BeNil())
 
-			transaction1, _ = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "cusotmer1@yahoo.com", "0889998989", merchantWithTransactions.UserID, nil)
+			transaction1, _ = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "cusotmer1@yahoo.com", "0889998989", merchantWithTransactions.UserID, nil)
 			err = transactionStore.CreateTransaction(context.Background(), transaction1)
 			Expect(err).To(BeNil())
 
-			transaction2, _ = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(600), models.TypeCharge, models.StatusApproved, "cusotmer1@yahoo.com", "0889998989", merchantWithTransactions.UserID, &transaction1.ID)
+			transaction2, _ = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, "cusotmer1@yahoo.com", "0889998989", merchantWithTransactions.UserID, &transaction1.ID)
 			err = transactionStore.CreateTransaction(context.Background(), transaction2)
 			Expect(err).To(BeNil())
+			transaction1.Status = models.StatusCaptured
 		})
 
 		It("retrieves merchant by id with its transactions successfully", func() {
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -15,18 +17,20 @@ import (
 
 	"gorm.io/driver/postgres"
 
+	"github.com/docker/distribution/uuid"
 	"github.com/docker/go-connections/nat"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"gorm.io/gorm"
 
 	"github.com/krasish/payment-system/internal/config"
+	"github.com/krasish/payment-system/internal/models"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/testcontainers/testcontainers-go"
 )
 
 var (
-	pathToDDL          = "/../../sql/000002_create_schema.up.sql"
+	pathToMigrations   = "/../../sql/*.up.sql"
 	postgresImage      = "postgres:15"
 	testDatabaseConfig = config.DatabaseConfig{
 		User:     "test-user",
@@ -40,7 +44,7 @@ var (
 	sqlDB             *sql.DB
 	gormDB            *gorm.DB
 	testDurationLimit = time.Minute
-	schemaNames       = []string{UserTestSchemaName, MerchantTestSchemaName, TransactionTestSchemaName}
+	schemaNames       = []string{UserTestSchemaName, MerchantTestSchemaName, TransactionTestSchemaName, IdempotencyTestSchemaName, LedgerTestSchemaName, RetentionTestSchemaName, QueryTestSchemaName, AdminTestSchemaName, CredentialsTestSchemaName, APIKeyTestSchemaName, SigningSecretTestSchemaName, WebhookTestSchemaName, OutboxTestSchemaName, DisputeTestSchemaName, SettlementTestSchemaName, FeePlanTestSchemaName, RiskTestSchemaName, ReviewTestSchemaName, LimitsTestSchemaName, CustomerTestSchemaName}
 )
 
 func TestModels(t *testing.T) {
@@ -59,7 +63,7 @@ var _ = BeforeSuite(func() {
 	workDir, err := os.Getwd()
 	Expect(err).To(BeNil())
 
-	schemaSQL, err := os.ReadFile(workDir + pathToDDL)
+	schemaSQL, err := readMigrations(workDir+pathToMigrations, nil)
 	Expect(err).To(BeNil())
 
 	req := testcontainers.ContainerRequest{
@@ -107,7 +111,7 @@ var _ = BeforeSuite(func() {
 	Expect(err).To(BeNil())
 
 	for _, schemaName := range schemaNames {
-		migration := addSchemaToMigration(string(schemaSQL), schemaName)
+		migration := addSchemaToMigration(schemaSQL, schemaName)
 		_, err = sqlDB.Exec(migration)
 		Expect(err).To(BeNil())
 	}
@@ -117,7 +121,48 @@ var _ = BeforeSuite(func() {
 	Expect(err).To(BeNil())
 })
 
+// readMigrations concatenates the migrations matching pattern in the order they have to be applied.
+// If include is not nil, only the migrations whose file name it accepts are read.
+func readMigrations(pattern string, include func(name string) bool) (string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	var sb strings.Builder
+	for _, path := range paths {
+		if include != nil && !include(filepath.Base(path)) {
+			continue
+		}
+		migration, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", err
+		}
+		sb.Write(migration)
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
 func addSchemaToMigration(migration, schema string) string {
 	prefix := fmt.Sprintf("BEGIN TRANSACTION;\n CREATE SCHEMA %s;\n SET search_path TO %s;\n ;COMMIT;\n", schema, schema)
 	return prefix + migration
 }
+
+// newTestTransaction returns a new transaction of m in the default currency, which belongs to belongsTo unless it is nil
+func newTestTransaction(m *models.Merchant, _type models.TransactionType, status models.TransactionStatus, amount float64, email, phone string, belongsTo *models.Transaction) *models.Transaction {
+	var belongsToID *uint
+	if belongsTo != nil {
+		belongsToID = &belongsTo.ID
+	}
+	t, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(amount), models.DefaultCurrencyCode, _type, status, email, phone, m.UserID, belongsToID)
+	Expect(err).To(BeNil())
+	return t
+}
+
+// createTestTransaction creates a new transaction of m with store like newTestTransaction
+func createTestTransaction(store *models.TransactionStore, m *models.Merchant, _type models.TransactionType, status models.TransactionStatus, amount float64, email, phone string, belongsTo *models.Transaction) *models.Transaction {
+	t := newTestTransaction(m, _type, status, amount, email, phone, belongsTo)
+	Expect(store.CreateTransaction(context.Background(), t)).To(Succeed())
+	return t
+}
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type EventType string
+
+const (
+	EventTransactionCreated       EventType = "transaction.created"
+	EventTransactionStatusChanged EventType = "transaction.status_changed"
+	EventMerchantUpdated          EventType = "merchant.updated"
+	EventDisputeOpened            EventType = "dispute.opened"
+	EventDisputeUpdated           EventType = "dispute.updated"
+	EventPayoutCreated            EventType = "payout.created"
+)
+
+// outboxRelayLockKey is the key of the advisory lock held while publishing events, so that
+// only one relay publishes at a time and events of a merchant are published in order
+const outboxRelayLockKey = 7_451_002
+
+// OutboxEvent is an event about a merchant's data. Events are written in the same DB transaction as
+// the change they describe, so no event is lost. Afterwards they are dispatched to the merchant's
+// webhook endpoints (DispatchedAt) and published by the event relay (PublishedAt) independently.
+type OutboxEvent struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	ExternalID   string    `gorm:"column:ext_uuid;type:uuid"`
+	MerchantID   uint      `gorm:"column:merchant_id"`
+	Type         EventType `gorm:"column:_type"`
+	Payload      string
+	DispatchedAt *time.Time
+	PublishedAt  *time.Time
+}
+
+// Event is the JSON payload of an OutboxEvent
+type Event struct {
+	ID        string
+	Type      EventType
+	CreatedAt time.Time
+	Data      any
+}
+
+// TransactionEventData describes a transaction in transaction.* events.
+// PreviousStatus is only set in transaction.status_changed events.
+type TransactionEventData struct {
+	UUID            string
+	BelongsToUUID   *string
+	Type            TransactionType
+	Status          TransactionStatus
+	PreviousStatus  TransactionStatus
+	Amount          float64
+	Currency        CurrencyCode
+	CustomerEmail   string
+	SystemGenerated bool
+	CreatedAt       time.Time
+}
+
+func newTransactionEventData(t *Transaction, belongsToUUID *string) TransactionEventData {
+	return TransactionEventData{
+		UUID:            t.ExternalID,
+		BelongsToUUID:   belongsToUUID,
+		Type:            t.Type,
+		Status:          t.Status,
+		Amount:          t.CurrencyCode.Float64(t.Amount),
+		Currency:        t.CurrencyCode,
+		CustomerEmail:   t.CustomerEmail,
+		SystemGenerated: t.SystemGenerated,
+		CreatedAt:       t.CreatedAt,
+	}
+}
+
+// MerchantEventData describes a merchant in merchant.* events
+type MerchantEventData struct {
+	Name        string
+	Description string
+	Email       string
+	Status      UserStatus
+}
+
+// DisputeEventData describes a dispute in dispute.* events
+type DisputeEventData struct {
+	UUID            string
+	TransactionUUID string
+	Status          DisputeStatus
+	Reason          string
+	Amount          float64
+	Currency        CurrencyCode
+	EvidenceDueBy   time.Time
+	ResolvedAt      *time.Time
+}
+
+// PayoutEventData describes a payout batch in payout.* events
+type PayoutEventData struct {
+	UUID             string
+	Currency         CurrencyCode
+	GrossAmount      float64
+	FeeAmount        float64
+	NetAmount        float64
+	TransactionCount int
+}
+
+// writeOutboxEvent stores an event of eventType about the merchant with merchantID using tx
+func writeOutboxEvent(tx *gorm.DB, merchantID uint, eventType EventType, data any) error {
+	now := time.Now()
+	e := Event{ID: uuid.Generate().String(), Type: eventType, CreatedAt: now, Data: data}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("while marshalling %s event: %w", eventType, err)
+	}
+	// IDs are assigned on insert, not on commit. Locking the merchant until tx ends makes DB transactions write the events
+	// of a merchant one after another, so they are committed in the order of their IDs and the relay, which publishes
+	// in that order, never sees an event of a merchant while an earlier one is still uncommitted.
+	if err := tx.Exec("SELECT 1 FROM merchant WHERE user_id = ? FOR NO KEY UPDATE", merchantID).Error; err != nil {
+		return fmt.Errorf("while locking merchant for %s event: %w", eventType, err)
+	}
+	oe := &OutboxEvent{CreatedAt: now, ExternalID: e.ID, MerchantID: merchantID, Type: eventType, Payload: string(payload)}
+	if err := tx.Create(oe).Error; err != nil {
+		return fmt.Errorf("while writing %s event to outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+// writeTransactionEvents writes the events caused by the creation of t. previousParentStatus is
+// the status the transaction t belongs to had before t was applied to it.
+func writeTransactionEvents(tx *gorm.DB, t *Transaction, previousParentStatus TransactionStatus) error {
+	var (
+		parent        = t.parent
+		belongsToUUID *string
+	)
+	if parent != nil {
+		belongsToUUID = &parent.ExternalID
+	}
+	if err := writeOutboxEvent(tx, t.MerchantID, EventTransactionCreated, newTransactionEventData(t, belongsToUUID)); err != nil {
+		return err
+	}
+	if parent == nil || parent.Status == previousParentStatus {
+		return nil
+	}
+	return writeStatusChangedEvent(tx, parent, previousParentStatus)
+}
+
+// writeStatusChangedEvent writes a transaction.status_changed event for t, which was in previousStatus before
+func writeStatusChangedEvent(tx *gorm.DB, t *Transaction, previousStatus TransactionStatus) error {
+	data := newTransactionEventData(t, nil)
+	if t.BelongsToID != nil {
+		parent := &Transaction{}
+		if err := tx.Select("ext_uuid").Where("id = ?", *t.BelongsToID).First(parent).Error; err != nil {
+			return fmt.Errorf("while getting referenced transaction of %s: %w", t.ExternalID, err)
+		}
+		data.BelongsToUUID = &parent.ExternalID
+	}
+	data.PreviousStatus = previousStatus
+	return writeOutboxEvent(tx, t.MerchantID, EventTransactionStatusChanged, data)
+}
+
+// writeMerchantUpdatedEvent writes a merchant.updated event with the current data of the merchant with email
+func writeMerchantUpdatedEvent(tx *gorm.DB, email string) error {
+	m := Merchant{}
+	if err := tx.Model(&Merchant{}).Where("email = ?", email).Preload("User").First(&m).Error; err != nil {
+		return fmt.Errorf("while getting updated merchant: %w", err)
+	}
+	return writeOutboxEvent(tx, m.UserID, EventMerchantUpdated, MerchantEventData{
+		Name:        m.Name,
+		Description: m.Description,
+		Email:       m.Email,
+		Status:      m.User.Status,
+	})
+}
+
+type OutboxStore struct {
+	db *gorm.DB
+}
+
+func NewOutboxStore(db *gorm.DB) *OutboxStore {
+	return &OutboxStore{db: db}
+}
+
+// PublishEvents calls publish for up to limit unpublished events in the order they were written and marks
+// the successfully published ones. When publishing an event fails, the following events of the same merchant
+// are not published until it succeeds, so events of a merchant are always published in order, while the events
+// of other merchants are published regardless of how many events are held back.
+// Events are published at least once, since an event might be published again if marking it fails.
+// It returns the number of published events.
+func (s *OutboxStore) PublishEvents(ctx context.Context, limit int, publish func(context.Context, *OutboxEvent) error) (int, error) {
+	var published int
+	// the advisory lock is held by the session of a dedicated connection instead of a DB transaction,
+	// so that no transaction is kept open while publishing and every published event is marked right away
+	err := s.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", outboxRelayLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			// another relay is publishing
+			return nil
+		}
+		defer func() {
+			// the lock is released even if ctx is done, since it would be held by the pooled connection otherwise
+			if err := conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", outboxRelayLockKey).Error; err != nil {
+				logrus.Errorf("could not release outbox relay lock: %v", err)
+			}
+		}()
+
+		var (
+			lastID  uint
+			blocked []uint
+		)
+		for published < limit {
+			var events []*OutboxEvent
+			query := conn.Where("published_at IS NULL AND id > ?", lastID)
+			if len(blocked) > 0 {
+				query = query.Where("merchant_id NOT IN ?", blocked)
+			}
+			if err := query.Order("id").Limit(limit - published).Find(&events).Error; err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				return nil
+			}
+			for _, e := range events {
+				lastID = e.ID
+				if containsID(blocked, e.MerchantID) {
+					continue
+				}
+				if err := publish(ctx, e); err != nil {
+					logrus.Warnf("could not publish event %s of merchant %d: %v", e.ExternalID, e.MerchantID, err)
+					blocked = append(blocked, e.MerchantID)
+					continue
+				}
+				if err := conn.Model(e).Update("published_at", time.Now()).Error; err != nil {
+					return err
+				}
+				published++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("while publishing events: %w", err)
+	}
+	return published, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDisputeEvent writes an event of eventType with the current data of d, whose Transaction has to be loaded
+func writeDisputeEvent(tx *gorm.DB, d *Dispute, eventType EventType) error {
+	return writeOutboxEvent(tx, d.MerchantID, eventType, DisputeEventData{
+		UUID:            d.ExternalID,
+		TransactionUUID: d.Transaction.ExternalID,
+		Status:          d.Status,
+		Reason:          d.Reason,
+		Amount:          d.CurrencyCode.Float64(d.Amount),
+		Currency:        d.CurrencyCode,
+		EvidenceDueBy:   d.EvidenceDueBy,
+		ResolvedAt:      d.ResolvedAt,
+	})
+}
@@ -0,0 +1,156 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const OutboxTestSchemaName = "payment_system_outbox_test"
+
+var _ = Describe("Using OutboxStore", func() {
+	var (
+		merchantStore *models.MerchantStore
+		outboxStore   *models.OutboxStore
+		first, second *models.Merchant
+		err           error
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, OutboxTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		outboxStore = models.NewOutboxStore(gormDB)
+		first, err = models.NewMerchant("First Outbox Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), first)).To(Succeed())
+		second, err = models.NewMerchant("Second Outbox Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), second)).To(Succeed())
+	})
+
+	It("publishes events of a merchant in order and holds them back after a failure", func() {
+		for i := 0; i < 2; i++ {
+			Expect(merchantStore.UpdateMerchant(context.Background(), first)).To(Succeed())
+			Expect(merchantStore.UpdateMerchant(context.Background(), second)).To(Succeed())
+		}
+
+		var published []*models.OutboxEvent
+		failFirst := true
+		publish := func(_ context.Context, e *models.OutboxEvent) error {
+			if e.MerchantID == first.UserID && failFirst {
+				failFirst = false
+				return errors.New("stream unavailable")
+			}
+			published = append(published, e)
+			return nil
+		}
+
+		n, err := outboxStore.PublishEvents(context.Background(), 1000, publish)
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(2))
+		Expect(published).To(HaveLen(2))
+		for _, e := range published {
+			Expect(e.MerchantID).To(Equal(second.UserID))
+		}
+		Expect(published[0].ID).To(BeNumerically("<", published[1].ID))
+
+		published = nil
+		n, err = outboxStore.PublishEvents(context.Background(), 1000, publish)
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(2))
+		Expect(published).To(HaveLen(2))
+		for _, e := range published {
+			Expect(e.MerchantID).To(Equal(first.UserID))
+			Expect(e.Type).To(Equal(models.EventMerchantUpdated))
+		}
+		Expect(published[0].ID).To(BeNumerically("<", published[1].ID))
+
+		n, err = outboxStore.PublishEvents(context.Background(), 1000, publish)
+		Expect(err).To(BeNil())
+		Expect(n).To(BeZero())
+	})
+
+	It("publishes events of other merchants however many events of a merchant are held back", func() {
+		for i := 0; i < 3; i++ {
+			Expect(merchantStore.UpdateMerchant(context.Background(), first)).To(Succeed())
+		}
+		Expect(merchantStore.UpdateMerchant(context.Background(), second)).To(Succeed())
+
+		var published []*models.OutboxEvent
+		publish := func(_ context.Context, e *models.OutboxEvent) error {
+			if e.MerchantID == first.UserID {
+				return errors.New("stream unavailable")
+			}
+			published = append(published, e)
+			return nil
+		}
+
+		n, err := outboxStore.PublishEvents(context.Background(), 1, publish)
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(1))
+		Expect(published).To(HaveLen(1))
+		Expect(published[0].MerchantID).To(Equal(second.UserID))
+
+		n, err = outboxStore.PublishEvents(context.Background(), 1, func(context.Context, *models.OutboxEvent) error { return nil })
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(1))
+	})
+
+	It("publishes events of a merchant in the order their DB transactions are committed", func() {
+		// the DB transactions run concurrently on several connections, which all need the search path of the schema
+		db, err := gorm.Open(postgres.Open(testDatabaseConfig.GetConnString()+" search_path="+OutboxTestSchemaName),
+			&gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+		Expect(err).To(BeNil())
+		conns, err := db.DB()
+		Expect(err).To(BeNil())
+		defer conns.Close()
+		outboxStore = models.NewOutboxStore(db)
+		publishAll := func() []*models.OutboxEvent {
+			var published []*models.OutboxEvent
+			_, err := outboxStore.PublishEvents(context.Background(), 1000, func(_ context.Context, e *models.OutboxEvent) error {
+				if e.MerchantID == first.UserID {
+					published = append(published, e)
+				}
+				return nil
+			})
+			Expect(err).To(BeNil())
+			return published
+		}
+		publishAll()
+
+		tx := db.Begin()
+		Expect(tx.Error).To(BeNil())
+		defer tx.Rollback()
+		t, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(10), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, "outbox@mail.bg", "0889787878", first.UserID, nil)
+		Expect(err).To(BeNil())
+		Expect(models.NewTransactionStore(tx).CreateTransaction(context.Background(), t)).To(Succeed())
+
+		updated := make(chan error, 1)
+		go func() {
+			updated <- models.NewMerchantStore(db).UpdateMerchant(context.Background(), first)
+		}()
+		// the later DB transaction cannot write an event of the merchant until the earlier one is committed
+		Consistently(updated, 500*time.Millisecond).ShouldNot(Receive())
+		Expect(publishAll()).To(BeEmpty())
+
+		Expect(tx.Commit().Error).To(Succeed())
+		Eventually(updated, 5*time.Second).Should(Receive(BeNil()))
+		published := publishAll()
+		Expect(published).To(HaveLen(2))
+		Expect(published[0].Type).To(Equal(models.EventTransactionCreated))
+		Expect(published[1].Type).To(Equal(models.EventMerchantUpdated))
+		Expect(published[0].ID).To(BeNumerically("<", published[1].ID))
+	})
+})
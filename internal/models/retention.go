@@ -0,0 +1,288 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetentionPolicyDefaultKey is the key of the retention period used for transactions without a more specific one
+const RetentionPolicyDefaultKey = "*"
+
+// RetentionPolicy holds how long transactions are retained before being archived.
+// The period of a status takes precedence over the period of a type, which takes precedence over Default.
+type RetentionPolicy struct {
+	Default  time.Duration
+	ByStatus map[TransactionStatus]time.Duration
+	ByType   map[TransactionType]time.Duration
+}
+
+// NewRetentionPolicy creates a RetentionPolicy from periods keyed by a transaction status,
+// a transaction type or RetentionPolicyDefaultKey.
+func NewRetentionPolicy(periods map[string]time.Duration) (*RetentionPolicy, error) {
+	p := &RetentionPolicy{ByStatus: make(map[TransactionStatus]time.Duration), ByType: make(map[TransactionType]time.Duration)}
+	defaultSet := false
+	for key, period := range periods {
+		if period <= 0 {
+			return nil, fmt.Errorf("while creating retention policy: period for %q must be positive", key)
+		}
+		if key == RetentionPolicyDefaultKey {
+			p.Default, defaultSet = period, true
+		} else if status, err := NewTransactionStatus(key); err == nil {
+			p.ByStatus[status] = period
+		} else if _type, err := NewTransactionType(key); err == nil {
+			p.ByType[_type] = period
+		} else {
+			return nil, fmt.Errorf("while creating retention policy: %q is neither a transaction status nor a type", key)
+		}
+	}
+	if !defaultSet {
+		return nil, fmt.Errorf("while creating retention policy: a default period (%q) is required", RetentionPolicyDefaultKey)
+	}
+	return p, nil
+}
+
+// Period returns the period for which t is retained
+func (p *RetentionPolicy) Period(t *Transaction) time.Duration {
+	if period, ok := p.ByStatus[t.Status]; ok {
+		return period
+	}
+	if period, ok := p.ByType[t.Type]; ok {
+		return period
+	}
+	return p.Default
+}
+
+// Expired reports whether the retention period of t has passed at now
+func (p *RetentionPolicy) Expired(t *Transaction, now time.Time) bool {
+	return t.CreatedAt.Add(p.Period(t)).Before(now)
+}
+
+// shortestPeriod returns the shortest period of the policy. No transaction can expire before it passes.
+func (p *RetentionPolicy) shortestPeriod() time.Duration {
+	shortest := p.Default
+	for _, period := range p.ByStatus {
+		if period < shortest {
+			shortest = period
+		}
+	}
+	for _, period := range p.ByType {
+		if period < shortest {
+			shortest = period
+		}
+	}
+	return shortest
+}
+
+// ArchivedTransaction is a transaction moved to the archive after its retention period has passed.
+// IDs are the ones the transactions had before being archived.
+type ArchivedTransaction struct {
+	ID         uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ArchivedAt time.Time
+
+	ExternalID      string            `gorm:"column:ext_uuid;type:uuid"`
+	Type            TransactionType   `gorm:"column:_type;type:transaction_type"`
+	Amount          Currency          `gorm:"type:bigint"`
+	CurrencyCode    CurrencyCode      `gorm:"type:char(3)"`
+	Status          TransactionStatus `gorm:"type:transaction_status"`
+	CustomerEmail   string
+	CustomerPhone   string
+	CustomerID      *uint
+	SystemGenerated bool
+	CapturedAmount  Currency `gorm:"type:bigint"`
+	RefundedAmount  Currency `gorm:"type:bigint"`
+	DisputedAmount  Currency `gorm:"type:bigint"`
+
+	FeeAmount     int64
+	RiskDecision  RiskDecision
+	RiskRuleID    string
+	ReviewedAt    *time.Time
+	ReviewedBy    string
+	MerchantID    uint
+	PayoutBatchID *uint
+	BelongsToID   *uint `gorm:"column:belongs_to"`
+}
+
+func (ArchivedTransaction) TableName() string {
+	return "transaction_archive"
+}
+
+func newArchivedTransaction(t *Transaction, archivedAt time.Time) *ArchivedTransaction {
+	return &ArchivedTransaction{
+		ID:              t.ID,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+		ArchivedAt:      archivedAt,
+		ExternalID:      t.ExternalID,
+		Type:            t.Type,
+		Amount:          t.Amount,
+		CurrencyCode:    t.CurrencyCode,
+		Status:          t.Status,
+		CustomerEmail:   t.CustomerEmail,
+		CustomerPhone:   t.CustomerPhone,
+		CustomerID:      t.CustomerID,
+		SystemGenerated: t.SystemGenerated,
+		CapturedAmount:  t.CapturedAmount,
+		RefundedAmount:  t.RefundedAmount,
+		DisputedAmount:  t.DisputedAmount,
+		FeeAmount:       t.FeeAmount,
+		RiskDecision:    t.RiskDecision,
+		RiskRuleID:      t.RiskRuleID,
+		ReviewedAt:      t.ReviewedAt,
+		ReviewedBy:      t.ReviewedBy,
+		MerchantID:      t.MerchantID,
+		PayoutBatchID:   t.PayoutBatchID,
+		BelongsToID:     t.BelongsToID,
+	}
+}
+
+// transaction returns a as a transaction, e.g. to report it together with transactions which are not archived
+func (a *ArchivedTransaction) transaction() *Transaction {
+	return &Transaction{
+		ID:              a.ID,
+		CreatedAt:       a.CreatedAt,
+		UpdatedAt:       a.UpdatedAt,
+		ExternalID:      a.ExternalID,
+		Type:            a.Type,
+		Amount:          a.Amount,
+		CurrencyCode:    a.CurrencyCode,
+		Status:          a.Status,
+		CustomerEmail:   a.CustomerEmail,
+		CustomerPhone:   a.CustomerPhone,
+		CustomerID:      a.CustomerID,
+		SystemGenerated: a.SystemGenerated,
+		CapturedAmount:  a.CapturedAmount,
+		RefundedAmount:  a.RefundedAmount,
+		DisputedAmount:  a.DisputedAmount,
+		FeeAmount:       a.FeeAmount,
+		RiskDecision:    a.RiskDecision,
+		RiskRuleID:      a.RiskRuleID,
+		ReviewedAt:      a.ReviewedAt,
+		ReviewedBy:      a.ReviewedBy,
+		MerchantID:      a.MerchantID,
+		PayoutBatchID:   a.PayoutBatchID,
+		BelongsToID:     a.BelongsToID,
+	}
+}
+
+// GetPeriodicJobArchiver returns a job which archives transaction chains whose retention period has passed
+func (s *TransactionStore) GetPeriodicJobArchiver(policy *RetentionPolicy, jobExecutionInterval time.Duration) TransactionPeriodicJob {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.ArchiveExpiredTransactions(ctx, policy, time.Now()); err != nil {
+					logrus.Warnf("periodic transaction archival job failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ArchiveExpiredTransactions moves every transaction chain (a transaction without a parent and all
+// transactions belonging to it) whose transactions are all expired at now to the archive.
+// Chains are archived as a whole, so no transaction is archived while a related one is still retained.
+// It returns the number of archived transactions.
+func (s *TransactionStore) ArchiveExpiredTransactions(ctx context.Context, policy *RetentionPolicy, now time.Time) (int, error) {
+	var rootIDs []uint
+	err := s.db.WithContext(ctx).Model(&Transaction{}).
+		Where("belongs_to IS NULL AND created_at < ?", now.Add(-policy.shortestPeriod())).
+		Order("id").
+		Pluck("id", &rootIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("while getting transactions to archive: %w", err)
+	}
+	archived := 0
+	for _, rootID := range rootIDs {
+		n, err := s.archiveChain(ctx, rootID, policy, now)
+		if err != nil {
+			return archived, err
+		}
+		archived += n
+	}
+	return archived, nil
+}
+
+func (s *TransactionStore) archiveChain(ctx context.Context, rootID uint, policy *RetentionPolicy, now time.Time) (int, error) {
+	var archived int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		root := &Transaction{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", rootID).Limit(1).Find(root)
+		if err := res.Error; err != nil {
+			return err
+		}
+		if res.RowsAffected == 0 {
+			// already archived by another job
+			return nil
+		}
+		chain, err := getTransactionChain(tx, rootID)
+		if err != nil {
+			return err
+		}
+		ids := make([]uint, len(chain))
+		for i, t := range chain {
+			if !policy.Expired(t, now) || t.Status == StatusPendingReview || (t.settleable() && t.PayoutBatchID == nil) {
+				// transactions are archived only once they have been reviewed and settled
+				return nil
+			}
+			ids[i] = t.ID
+		}
+		var unresolvedDisputes int64
+		err = tx.Model(&Dispute{}).
+			Where("transaction_id IN ? AND status IN ?", ids, []DisputeStatus{DisputeOpened, DisputeEvidenceSubmitted}).
+			Count(&unresolvedDisputes).Error
+		if err != nil || unresolvedDisputes > 0 {
+			// chains are archived only once their disputes are resolved, which then reference the archived transactions
+			return err
+		}
+		archive := make([]*ArchivedTransaction, len(chain))
+		for i, t := range chain {
+			archive[i] = newArchivedTransaction(t, now)
+		}
+		if err := tx.Create(archive).Error; err != nil {
+			return err
+		}
+		// children are deleted by the belongs_to cascade
+		if err := tx.Delete(root).Error; err != nil {
+			return err
+		}
+		archived = len(chain)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("while archiving transaction chain of %d: %w", rootID, err)
+	}
+	return archived, nil
+}
+
+// getTransactionChain returns the transaction with rootID followed by all transactions belonging to it directly or indirectly
+func getTransactionChain(db *gorm.DB, rootID uint) ([]*Transaction, error) {
+	var chain []*Transaction
+	err := db.Raw(`WITH RECURSIVE chain AS (
+		SELECT * FROM transaction WHERE id = ?
+		UNION ALL
+		SELECT t.* FROM transaction t JOIN chain c ON t.belongs_to = c.id
+	) SELECT * FROM chain ORDER BY id`, rootID).Scan(&chain).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting transaction chain: %w", err)
+	}
+	return chain, nil
+}
+
+func (s *TransactionStore) GetArchivedTransactions(ctx context.Context) ([]*ArchivedTransaction, error) {
+	var ts []*ArchivedTransaction
+	err := s.db.WithContext(ctx).Order("id").Find(&ts).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting archived transactions: %w", err)
+	}
+	return ts, nil
+}
@@ -0,0 +1,165 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const RetentionTestSchemaName = "payment_system_retention_test"
+
+var _ = Describe("Using NewRetentionPolicy", func() {
+	It("prefers status over type over default periods", func() {
+		policy, err := models.NewRetentionPolicy(map[string]time.Duration{"*": time.Hour, "AUTHORIZE": 2 * time.Hour, "ERROR": 3 * time.Hour})
+		Expect(err).To(BeNil())
+
+		Expect(policy.Period(&models.Transaction{Type: models.TypeCharge, Status: models.StatusApproved})).To(Equal(time.Hour))
+		Expect(policy.Period(&models.Transaction{Type: models.TypeAuthorize, Status: models.StatusApproved})).To(Equal(2 * time.Hour))
+		Expect(policy.Period(&models.Transaction{Type: models.TypeAuthorize, Status: models.StatusError})).To(Equal(3 * time.Hour))
+	})
+	It("fails for unknown keys, non positive periods and without a default", func() {
+		_, err := models.NewRetentionPolicy(map[string]time.Duration{"*": time.Hour, "UNKNOWN": time.Hour})
+		Expect(err).NotTo(BeNil())
+		_, err = models.NewRetentionPolicy(map[string]time.Duration{"*": 0})
+		Expect(err).NotTo(BeNil())
+		_, err = models.NewRetentionPolicy(map[string]time.Duration{"CHARGE": time.Hour})
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Using TransactionStore for archival", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		merchant         *models.Merchant
+		err              error
+		create           = func(_type models.TransactionType, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, merchant, _type, models.StatusApproved, 100, "rc@mail.bg", "0889787878", belongsTo)
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, RetentionTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		merchant, err = models.NewMerchant("Retention Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+
+		err = merchantStore.CreateMerchant(context.Background(), merchant)
+		Expect(err).To(BeNil())
+	})
+
+	It("archives whole chains only after all of their transactions expire", func() {
+		authorize := create(models.TypeAuthorize, nil)
+		charge := create(models.TypeCharge, authorize)
+		lone := create(models.TypeAuthorize, nil)
+
+		policy, err := models.NewRetentionPolicy(map[string]time.Duration{"*": time.Hour, "CHARGE": 10 * time.Hour})
+		Expect(err).To(BeNil())
+
+		archived, err := transactionStore.ArchiveExpiredTransactions(context.Background(), policy, time.Now().Add(2*time.Hour))
+		Expect(err).To(BeNil())
+		Expect(archived).To(Equal(1))
+
+		transactions, err := transactionStore.GetAllTransactions(context.Background())
+		Expect(err).To(BeNil())
+		authorize.Status = models.StatusCaptured
+		compareTransactions([]*models.Transaction{authorize, charge}, transactions)
+
+		// charges are archived only once they have been settled
+		_, err = models.NewSettlementStore(gormDB).SettleTransactions(context.Background(), time.Now())
+		Expect(err).To(BeNil())
+		archived, err = transactionStore.ArchiveExpiredTransactions(context.Background(), policy, time.Now().Add(11*time.Hour))
+		Expect(err).To(BeNil())
+		Expect(archived).To(Equal(2))
+
+		transactions, err = transactionStore.GetAllTransactions(context.Background())
+		Expect(err).To(BeNil())
+		Expect(transactions).To(BeEmpty())
+
+		archive, err := transactionStore.GetArchivedTransactions(context.Background())
+		Expect(err).To(BeNil())
+		Expect(archive).To(HaveLen(3))
+		Expect(archive[0].ID).To(Equal(authorize.ID))
+		Expect(archive[0].Status).To(Equal(models.StatusCaptured))
+		Expect(archive[1].ID).To(Equal(charge.ID))
+		Expect(*archive[1].BelongsToID).To(Equal(authorize.ID))
+		Expect(archive[2].ID).To(Equal(lone.ID))
+	})
+
+	It("keeps resolved disputes of archived chains", func() {
+		disputeStore := models.NewDisputeStore(gormDB)
+		settle := func() {
+			_, err := models.NewSettlementStore(gormDB).SettleTransactions(context.Background(), time.Now())
+			Expect(err).To(BeNil())
+		}
+		policy, err := models.NewRetentionPolicy(map[string]time.Duration{"*": time.Hour})
+		Expect(err).To(BeNil())
+
+		charge := create(models.TypeCharge, nil)
+		d, err := disputeStore.OpenDispute(context.Background(), charge.ExternalID, 0, "fraudulent", time.Now().Add(time.Hour))
+		Expect(err).To(BeNil())
+		settle()
+
+		_, err = transactionStore.ArchiveExpiredTransactions(context.Background(), policy, time.Now().Add(2*time.Hour))
+		Expect(err).To(BeNil())
+		_, err = transactionStore.GetTransactionByUUID(context.Background(), charge.ExternalID)
+		Expect(err).To(BeNil())
+
+		_, err = disputeStore.ResolveDispute(context.Background(), d.ExternalID, models.DisputeLost)
+		Expect(err).To(BeNil())
+		_, err = transactionStore.ArchiveExpiredTransactions(context.Background(), policy, time.Now().Add(2*time.Hour))
+		Expect(err).To(BeNil())
+		_, err = transactionStore.GetTransactionByUUID(context.Background(), charge.ExternalID)
+		Expect(err).To(MatchError(models.ErrTransactionNotFound))
+
+		d, err = disputeStore.GetDisputeByUUID(context.Background(), d.ExternalID, &merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(d.Status).To(Equal(models.DisputeLost))
+		Expect(d.Transaction.ExternalID).To(Equal(charge.ExternalID))
+		Expect(d.Chargeback).NotTo(BeNil())
+		Expect(d.Chargeback.Type).To(Equal(models.TypeChargeback))
+
+		// disputes can reference archived transactions only as long as they exist
+		err = gormDB.Exec("UPDATE dispute SET chargeback_reversal_id = ? WHERE ext_uuid = ?", d.Chargeback.ID+1_000_000, d.ExternalID).Error
+		Expect(err).NotTo(BeNil())
+		Expect(gormDB.Exec("DELETE FROM transaction_archive WHERE ext_uuid = ?", charge.ExternalID).Error).To(Succeed())
+		_, err = disputeStore.GetDisputeByUUID(context.Background(), d.ExternalID, &merchant.UserID)
+		Expect(err).To(MatchError(models.ErrDisputeNotFound))
+	})
+
+	It("keeps the risk reasons of archived transactions", func() {
+		t, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(100), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, "rc@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		assessment := &models.RiskAssessment{}
+		assessment.Add("blocklist", models.RiskDecline, "customer is blocklisted")
+		t.ApplyRiskAssessment(assessment)
+		Expect(transactionStore.CreateTransaction(context.Background(), t)).To(Succeed())
+
+		policy, err := models.NewRetentionPolicy(map[string]time.Duration{"*": time.Hour})
+		Expect(err).To(BeNil())
+		_, err = transactionStore.ArchiveExpiredTransactions(context.Background(), policy, time.Now().Add(2*time.Hour))
+		Expect(err).To(BeNil())
+		_, err = transactionStore.GetTransactionByUUID(context.Background(), t.ExternalID)
+		Expect(err).To(MatchError(models.ErrTransactionNotFound))
+
+		var reasons []models.RiskReason
+		Expect(gormDB.Where("transaction_id = ?", t.ID).Find(&reasons).Error).To(Succeed())
+		Expect(reasons).To(HaveLen(1))
+		Expect(reasons[0].RuleID).To(Equal("blocklist"))
+
+		// risk reasons can reference archived transactions only as long as they exist
+		Expect(gormDB.Exec("UPDATE risk_reason SET transaction_id = ? WHERE transaction_id = ?", t.ID+1_000_000, t.ID).Error).NotTo(BeNil())
+		Expect(gormDB.Exec("DELETE FROM transaction_archive WHERE id = ?", t.ID).Error).To(Succeed())
+		Expect(gormDB.Where("transaction_id = ?", t.ID).Find(&reasons).Error).To(Succeed())
+		Expect(reasons).To(BeEmpty())
+	})
+})
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetTransactionsPendingReview returns the transactions held for review ordered from the oldest
+func (s *TransactionStore) GetTransactionsPendingReview(ctx context.Context) ([]*Transaction, error) {
+	var ts []*Transaction
+	err := s.db.WithContext(ctx).Preload("Merchant").Preload("BelongsTo").Preload("RiskReasons").
+		Where("status = ?", StatusPendingReview).Order("created_at, id").Find(&ts).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting transactions pending review: %w", err)
+	}
+	return ts, nil
+}
+
+// ApproveTransaction approves the transaction with extID held for review by reviewer. It is applied with the
+// same side effects as a transaction created as APPROVED, i.e. it is posted to the ledger and applied to its parent.
+func (s *TransactionStore) ApproveTransaction(ctx context.Context, extID, reviewer string) (*Transaction, error) {
+	return s.review(ctx, extID, StatusApproved, reviewer)
+}
+
+// DeclineTransaction declines the transaction with extID held for review by reviewer, which moves it to ERROR status
+func (s *TransactionStore) DeclineTransaction(ctx context.Context, extID, reviewer string) (*Transaction, error) {
+	return s.review(ctx, extID, StatusError, reviewer)
+}
+
+func (s *TransactionStore) review(ctx context.Context, extID string, status TransactionStatus, reviewer string) (*Transaction, error) {
+	t := &Transaction{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ext_uuid = ?", extID).First(t)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrTransactionNotFound
+		} else if res.Error != nil {
+			return res.Error
+		}
+		if t.Status != StatusPendingReview {
+			return ErrTransactionNotPendingReview
+		}
+		if t.BelongsToID != nil {
+			t.parent = &Transaction{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *t.BelongsToID).First(t.parent).Error; err != nil {
+				return fmt.Errorf("while locking referenced transaction: %w", err)
+			}
+		}
+		now := time.Now()
+		t.Status, t.ReviewedAt, t.ReviewedBy = status, &now, reviewer
+		if status == StatusError {
+			t.FeeAmount = 0
+		}
+		res = tx.Model(&Transaction{}).Where("id = ?", t.ID).Updates(map[string]interface{}{
+			"status":      t.Status,
+			"fee_amount":  t.FeeAmount,
+			"reviewed_at": t.ReviewedAt,
+			"reviewed_by": t.ReviewedBy,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		var previousParentStatus TransactionStatus
+		if t.parent != nil {
+			previousParentStatus = t.parent.Status
+		}
+		if err := t.applyAfterCreate(tx); err != nil {
+			return err
+		}
+		if err := writeStatusChangedEvent(tx, t, StatusPendingReview); err != nil {
+			return err
+		}
+		if t.parent != nil && t.parent.Status != previousParentStatus {
+			return writeStatusChangedEvent(tx, t.parent, previousParentStatus)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrTransactionNotFound), errors.Is(err, ErrTransactionNotPendingReview):
+		return nil, err
+	case err != nil:
+		return nil, fmt.Errorf("while reviewing transaction %s: %w", extID, err)
+	}
+	return s.GetTransactionByUUID(ctx, extID)
+}
@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const ReviewTestSchemaName = "payment_system_review_test"
+
+var _ = Describe("Reviewing transactions with TransactionStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		ledgerStore      *models.LedgerStore
+		merchant         *models.Merchant
+		err              error
+		hold             = func(_type models.TransactionType, amount float64) *models.Transaction {
+			t, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(amount), models.DefaultCurrencyCode, _type, models.StatusApproved, "review@mail.bg", "0889787878", merchant.UserID, nil)
+			Expect(err).To(BeNil())
+			a := &models.RiskAssessment{}
+			a.Add("large-amount", models.RiskReview, "amount is too large")
+			t.ApplyRiskAssessment(a)
+			Expect(transactionStore.CreateTransaction(context.Background(), t)).To(Succeed())
+			Expect(t.Status).To(Equal(models.StatusPendingReview))
+			return t
+		}
+		events = func(t *models.Transaction) []models.EventType {
+			var es []*models.OutboxEvent
+			Expect(gormDB.Where("merchant_id = ? AND payload LIKE ?", merchant.UserID, "%"+t.ExternalID+"%").Order("id").Find(&es).Error).To(Succeed())
+			types := make([]models.EventType, len(es))
+			for i, e := range es {
+				types[i] = e.Type
+			}
+			return types
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, ReviewTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		ledgerStore = models.NewLedgerStore(gormDB)
+		merchant, err = models.NewMerchant("Review Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("holds flagged transactions until they are approved", func() {
+		authorize := hold(models.TypeAuthorize, 500)
+		entries, err := ledgerStore.GetJournalEntries(context.Background(), authorize.ID)
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+
+		charge, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(100), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, "review@mail.bg", "0889787878", merchant.UserID, &authorize.ID)
+		Expect(err).To(BeNil())
+		err = models.TransactionStateMachine.Validate(charge, authorize)
+		Expect(errors.Is(err, models.ErrIllegalParentStatus)).To(BeTrue())
+
+		queue, err := transactionStore.GetTransactionsPendingReview(context.Background())
+		Expect(err).To(BeNil())
+		Expect(queue).To(HaveLen(1))
+		Expect(queue[0].ExternalID).To(Equal(authorize.ExternalID))
+		Expect(queue[0].RiskReasons).To(HaveLen(1))
+
+		approved, err := transactionStore.ApproveTransaction(context.Background(), authorize.ExternalID, "admin@abv.bg")
+		Expect(err).To(BeNil())
+		Expect(approved.Status).To(Equal(models.StatusApproved))
+		Expect(approved.ReviewedBy).To(Equal("admin@abv.bg"))
+		Expect(approved.ReviewedAt).NotTo(BeNil())
+		Expect(models.TransactionStateMachine.Validate(charge, approved)).To(Succeed())
+
+		entries, err = ledgerStore.GetJournalEntries(context.Background(), authorize.ID)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(events(authorize)).To(Equal([]models.EventType{models.EventTransactionCreated, models.EventTransactionStatusChanged}))
+
+		_, err = transactionStore.ApproveTransaction(context.Background(), authorize.ExternalID, "admin@abv.bg")
+		Expect(err).To(MatchError(models.ErrTransactionNotPendingReview))
+		queue, err = transactionStore.GetTransactionsPendingReview(context.Background())
+		Expect(err).To(BeNil())
+		Expect(queue).To(BeEmpty())
+	})
+
+	It("declines flagged transactions", func() {
+		charge := hold(models.TypeCharge, 500)
+		declined, err := transactionStore.DeclineTransaction(context.Background(), charge.ExternalID, "admin@abv.bg")
+		Expect(err).To(BeNil())
+		Expect(declined.Status).To(Equal(models.StatusError))
+		Expect(declined.ReviewedBy).To(Equal("admin@abv.bg"))
+
+		entries, err := ledgerStore.GetJournalEntries(context.Background(), charge.ID)
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+		Expect(events(charge)).To(Equal([]models.EventType{models.EventTransactionCreated, models.EventTransactionStatusChanged}))
+
+		_, err = transactionStore.DeclineTransaction(context.Background(), uuid.Generate().String(), "admin@abv.bg")
+		Expect(err).To(MatchError(models.ErrTransactionNotFound))
+	})
+})
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RiskDecision is the outcome of assessing the risk of a transaction
+type RiskDecision string
+
+const (
+	RiskApprove RiskDecision = "APPROVE"
+	RiskReview  RiskDecision = "REVIEW"
+	RiskDecline RiskDecision = "DECLINE"
+)
+
+func NewRiskDecision(s string) (RiskDecision, error) {
+	return enumFactory(s, RiskApprove, RiskReview, RiskDecline)
+}
+
+// severity orders decisions from the least to the most restrictive one
+func (d RiskDecision) severity() int {
+	switch d {
+	case RiskReview:
+		return 1
+	case RiskDecline:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// RiskReason is a risk rule which fired for a transaction
+type RiskReason struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	TransactionID uint
+	RuleID        string
+	Decision      RiskDecision
+	Reason        string
+}
+
+// RiskAssessment is the decision of all risk rules for a transaction. RuleID is the first rule which
+// made the decision and is empty for approved transactions without reasons.
+type RiskAssessment struct {
+	Decision RiskDecision
+	RuleID   string
+	Reasons  []RiskReason
+}
+
+// Add records that the rule with ruleID fired with decision and makes it the decision of a if it is more restrictive
+func (a *RiskAssessment) Add(ruleID string, decision RiskDecision, reason string) {
+	if a.Decision == "" {
+		a.Decision = RiskApprove
+	}
+	a.Reasons = append(a.Reasons, RiskReason{RuleID: ruleID, Decision: decision, Reason: reason})
+	if decision.severity() > a.Decision.severity() {
+		a.Decision, a.RuleID = decision, ruleID
+	}
+}
+
+// ApplyRiskAssessment stores a with t. Declined transactions are stored in ERROR status,
+// while transactions to be reviewed are held in PENDING_REVIEW status.
+func (t *Transaction) ApplyRiskAssessment(a *RiskAssessment) {
+	t.RiskDecision = a.Decision
+	if t.RiskDecision == "" {
+		t.RiskDecision = RiskApprove
+	}
+	t.RiskRuleID = a.RuleID
+	t.RiskReasons = a.Reasons
+	switch t.RiskDecision { //nolint:exhaustive
+	case RiskDecline:
+		t.Status = StatusError
+	case RiskReview:
+		t.Status = StatusPendingReview
+	}
+}
+
+// RiskStore provides the transaction history risk rules are evaluated against
+type RiskStore struct {
+	db *gorm.DB
+}
+
+func NewRiskStore(db *gorm.DB) *RiskStore {
+	return &RiskStore{db: db}
+}
+
+// CountCustomerTransactions returns the number of transactions of the merchant with merchantID created since since,
+// whose customer has email or phone. Empty arguments are not matched.
+func (s *RiskStore) CountCustomerTransactions(ctx context.Context, merchantID uint, email, phone string, since time.Time) (int64, error) {
+	if email == "" && phone == "" {
+		return 0, nil
+	}
+	var count int64
+	query := s.db.WithContext(ctx).Model(&Transaction{}).Where("merchant_id = ? AND created_at >= ?", merchantID, since)
+	if email != "" {
+		query = query.Where("customer_email = ?", email)
+	}
+	if phone != "" {
+		query = query.Where("customer_phone = ?", phone)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("while counting customer transactions: %w", err)
+	}
+	return count, nil
+}
+
+// CountMismatchedCustomerTransactions returns the number of transactions of the merchant with merchantID created since since,
+// which have either email with another phone or phone with another email
+func (s *RiskStore) CountMismatchedCustomerTransactions(ctx context.Context, merchantID uint, email, phone string, since time.Time) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&Transaction{}).
+		Where("merchant_id = ? AND created_at >= ?", merchantID, since).
+		Where("(customer_email = ? AND customer_phone <> ?) OR (customer_phone = ? AND customer_email <> ?)", email, phone, phone, email).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("while counting mismatched customer transactions: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,105 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+	"github.com/krasish/payment-system/internal/risk"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const RiskTestSchemaName = "payment_system_risk_test"
+
+var _ = Describe("Using RiskAssessment", func() {
+	It("makes the most restrictive decision of the fired rules", func() {
+		a := &models.RiskAssessment{}
+		a.Add("review-1", models.RiskReview, "first")
+		a.Add("decline-1", models.RiskDecline, "second")
+		a.Add("decline-2", models.RiskDecline, "third")
+		a.Add("review-2", models.RiskReview, "fourth")
+		Expect(a.Decision).To(Equal(models.RiskDecline))
+		Expect(a.RuleID).To(Equal("decline-1"))
+		Expect(a.Reasons).To(HaveLen(4))
+
+		t := &models.Transaction{Status: models.StatusApproved}
+		t.ApplyRiskAssessment(a)
+		Expect(t.Status).To(Equal(models.StatusError))
+		Expect(t.RiskRuleID).To(Equal("decline-1"))
+	})
+})
+
+var _ = Describe("Using the risk engine with RiskStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		merchant         *models.Merchant
+		engine           *risk.Engine
+		err              error
+		create           = func(amount float64, email, phone string) *models.Transaction {
+			t := newTestTransaction(merchant, models.TypeCharge, models.StatusApproved, amount, email, phone, nil)
+			a, err := engine.Assess(context.Background(), t)
+			Expect(err).To(BeNil())
+			t.ApplyRiskAssessment(a)
+			Expect(transactionStore.CreateTransaction(context.Background(), t)).To(Succeed())
+			return t
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, RiskTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		merchant, err = models.NewMerchant("Risk Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+
+		history := models.NewRiskStore(gormDB)
+		engine = risk.NewEngine(
+			risk.NewAmountRule("large-amount", models.RiskReview, models.ToCurrency(100), models.DefaultCurrencyCode),
+			risk.NewVelocityRule("email-velocity", models.RiskDecline, history, risk.KeyEmail, time.Hour, 2),
+			risk.NewBlocklistRule("blocklist", models.RiskDecline, nil, []string{"fraud.bg"}, []string{"+359 888 000 000"}),
+			risk.NewMismatchedCustomerRule("mismatched-customer", models.RiskReview, history, time.Hour),
+		)
+	})
+
+	It("approves, reviews and declines transactions and stores the reasons", func() {
+		approved := create(10, "risk@mail.bg", "0889787878")
+		Expect(approved.RiskDecision).To(Equal(models.RiskApprove))
+		Expect(approved.RiskReasons).To(BeEmpty())
+
+		review := create(150, "risk@mail.bg", "0889787878")
+		Expect(review.RiskDecision).To(Equal(models.RiskReview))
+		Expect(review.RiskRuleID).To(Equal("large-amount"))
+		Expect(review.Status).To(Equal(models.StatusPendingReview))
+
+		declined := create(10, "risk@mail.bg", "0889787878")
+		Expect(declined.RiskDecision).To(Equal(models.RiskDecline))
+		Expect(declined.RiskRuleID).To(Equal("email-velocity"))
+
+		stored, err := transactionStore.GetTransactionByUUID(context.Background(), declined.ExternalID)
+		Expect(err).To(BeNil())
+		Expect(stored.Status).To(Equal(models.StatusError))
+		Expect(stored.RiskRuleID).To(Equal("email-velocity"))
+		var reasons []models.RiskReason
+		Expect(gormDB.Where("transaction_id = ?", declined.ID).Find(&reasons).Error).To(Succeed())
+		Expect(reasons).To(HaveLen(1))
+		Expect(reasons[0].Decision).To(Equal(models.RiskDecline))
+	})
+
+	It("declines blocklisted customers and reviews mismatched ones", func() {
+		Expect(create(10, "someone@fraud.bg", "0889787878").RiskRuleID).To(Equal("blocklist"))
+		Expect(create(10, "other@mail.bg", "+359-888-000-000").RiskRuleID).To(Equal("blocklist"))
+
+		create(10, "first@mail.bg", "0881111111")
+		mismatched := create(10, "first@mail.bg", "0882222222")
+		Expect(mismatched.RiskDecision).To(Equal(models.RiskReview))
+		Expect(mismatched.RiskRuleID).To(Equal("mismatched-customer"))
+	})
+})
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPayoutBatchNotFound is returned when a payout batch does not exist or is not visible to the caller
+var ErrPayoutBatchNotFound = errors.New("payout batch not found")
+
+// settledTypes are the types of transactions which move money to or from the balance of a merchant and get settled
+var settledTypes = []TransactionType{TypeCharge, TypeRefund, TypeChargeback, TypeChargebackReversal}
+
+// SettledAmount returns the amount t adds to the payout of its merchant, which is negative for money taken back from the merchant
+func (t *Transaction) SettledAmount() int64 {
+	switch t.Type { //nolint:exhaustive
+	case TypeCharge, TypeChargebackReversal:
+		return int64(t.Amount)
+	case TypeRefund, TypeChargeback:
+		return -int64(t.Amount)
+	default:
+		return 0
+	}
+}
+
+// settleable reports whether t has to be included in a payout batch
+func (t *Transaction) settleable() bool {
+	return t.effective() && t.SettledAmount() != 0
+}
+
+// PayoutBatch groups the settled transactions of a merchant in a currency, which are paid out together.
+// Amounts are in the minor units of the currency and NetAmount is negative when the merchant owes money.
+type PayoutBatch struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	ExternalID   string `gorm:"column:ext_uuid;type:uuid"`
+	MerchantID   uint
+	Merchant     Merchant
+	CurrencyCode CurrencyCode `gorm:"type:char(3)"`
+
+	// GrossAmount is the sum of charges and chargeback reversals less the sum of refunds and chargebacks
+	GrossAmount int64
+	// FeeAmount is the sum of the fees of the settled transactions
+	FeeAmount        int64
+	NetAmount        int64
+	TransactionCount int
+}
+
+type SettlementStore struct {
+	db *gorm.DB
+}
+
+func NewSettlementStore(db *gorm.DB) *SettlementStore {
+	return &SettlementStore{db: db}
+}
+
+// GetPeriodicJobSettler returns a job which settles the transactions created until its execution every jobExecutionInterval
+func (s *SettlementStore) GetPeriodicJobSettler(jobExecutionInterval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.SettleTransactions(ctx, time.Now()); err != nil {
+					logrus.Warnf("periodic settlement job failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func unsettledTransactions(db *gorm.DB) *gorm.DB {
+	return db.Model(&Transaction{}).Where("payout_batch_id IS NULL AND status NOT IN ? AND _type IN ?", []TransactionStatus{StatusError, StatusPendingReview}, settledTypes)
+}
+
+// SettleTransactions groups the unsettled transactions created before createdBefore into a payout batch per merchant
+// and currency and marks them as settled. The fees of the transactions are deducted from each batch.
+func (s *SettlementStore) SettleTransactions(ctx context.Context, createdBefore time.Time) ([]*PayoutBatch, error) {
+	var groups []struct {
+		MerchantID   uint
+		CurrencyCode CurrencyCode
+	}
+	err := unsettledTransactions(s.db.WithContext(ctx)).
+		Distinct("merchant_id", "currency_code").
+		Where("created_at < ?", createdBefore).
+		Order("merchant_id").Scan(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting unsettled transactions: %w", err)
+	}
+	batches := make([]*PayoutBatch, 0, len(groups))
+	for _, g := range groups {
+		batch, err := s.settle(ctx, g.MerchantID, g.CurrencyCode, createdBefore)
+		if err != nil {
+			return batches, err
+		}
+		if batch != nil {
+			batches = append(batches, batch)
+		}
+	}
+	return batches, nil
+}
+
+// settle creates the payout batch of the unsettled transactions of a merchant in a currency. It returns nil
+// when there are no transactions left to settle, e.g. because they have been settled concurrently.
+func (s *SettlementStore) settle(ctx context.Context, merchantID uint, currencyCode CurrencyCode, createdBefore time.Time) (*PayoutBatch, error) {
+	var batch *PayoutBatch
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ts []*Transaction
+		err := unsettledTransactions(tx).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("merchant_id = ? AND currency_code = ? AND created_at < ?", merchantID, currencyCode, createdBefore).
+			Order("id").Find(&ts).Error
+		if err != nil || len(ts) == 0 {
+			return err
+		}
+		batch = &PayoutBatch{ExternalID: uuid.Generate().String(), MerchantID: merchantID, CurrencyCode: currencyCode, TransactionCount: len(ts)}
+		ids := make([]uint, len(ts))
+		for i, t := range ts {
+			batch.GrossAmount += t.SettledAmount()
+			batch.FeeAmount += t.FeeAmount
+			ids[i] = t.ID
+		}
+		batch.NetAmount = batch.GrossAmount - batch.FeeAmount
+		if err := tx.Omit(clause.Associations).Create(batch).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Transaction{}).Where("id IN ?", ids).Update("payout_batch_id", batch.ID).Error; err != nil {
+			return err
+		}
+		return writeOutboxEvent(tx, merchantID, EventPayoutCreated, PayoutEventData{
+			UUID:             batch.ExternalID,
+			Currency:         currencyCode,
+			GrossAmount:      currencyCode.SignedFloat64(batch.GrossAmount),
+			FeeAmount:        currencyCode.SignedFloat64(batch.FeeAmount),
+			NetAmount:        currencyCode.SignedFloat64(batch.NetAmount),
+			TransactionCount: batch.TransactionCount,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while settling transactions of merchant %d in %s: %w", merchantID, currencyCode, err)
+	}
+	return batch, nil
+}
+
+// GetPayoutBatches returns the payout batches ordered from the newest. If merchantID is not nil, only batches of that merchant are returned.
+func (s *SettlementStore) GetPayoutBatches(ctx context.Context, merchantID *uint) ([]*PayoutBatch, error) {
+	query := s.db.WithContext(ctx).Preload("Merchant")
+	if merchantID != nil {
+		query = query.Where("merchant_id = ?", *merchantID)
+	}
+	var bs []*PayoutBatch
+	if err := query.Order("id DESC").Find(&bs).Error; err != nil {
+		return nil, fmt.Errorf("while getting payout batches: %w", err)
+	}
+	return bs, nil
+}
+
+// GetPayoutBatchByUUID returns the payout batch with extID. If merchantID is not nil, only a batch of that merchant is returned.
+func (s *SettlementStore) GetPayoutBatchByUUID(ctx context.Context, extID string, merchantID *uint) (*PayoutBatch, error) {
+	if _, err := uuid.Parse(extID); err != nil {
+		return nil, ErrPayoutBatchNotFound
+	}
+	query := s.db.WithContext(ctx).Preload("Merchant").Where("ext_uuid = ?", extID)
+	if merchantID != nil {
+		query = query.Where("merchant_id = ?", *merchantID)
+	}
+	b := &PayoutBatch{}
+	res := query.First(b)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrPayoutBatchNotFound
+	} else if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting payout batch: %w", err)
+	}
+	return b, nil
+}
+
+// GetPayoutBatchTransactions returns the transactions settled in the batch with batchID ordered by ID,
+// including the ones which have been archived since
+func (s *SettlementStore) GetPayoutBatchTransactions(ctx context.Context, batchID uint) ([]*Transaction, error) {
+	var ts []*Transaction
+	if err := s.db.WithContext(ctx).Preload("BelongsTo").Where("payout_batch_id = ?", batchID).Find(&ts).Error; err != nil {
+		return nil, fmt.Errorf("while getting settled transactions: %w", err)
+	}
+	var archived []*ArchivedTransaction
+	if err := s.db.WithContext(ctx).Where("payout_batch_id = ?", batchID).Find(&archived).Error; err != nil {
+		return nil, fmt.Errorf("while getting settled archived transactions: %w", err)
+	}
+	// chains are archived together, so the parents of archived transactions are archived too
+	parentIDs := make([]uint, 0, len(archived))
+	for _, a := range archived {
+		if a.BelongsToID != nil {
+			parentIDs = append(parentIDs, *a.BelongsToID)
+		}
+	}
+	parents := make(map[uint]*Transaction, len(parentIDs))
+	if len(parentIDs) > 0 {
+		var archivedParents []*ArchivedTransaction
+		if err := s.db.WithContext(ctx).Where("id IN ?", parentIDs).Find(&archivedParents).Error; err != nil {
+			return nil, fmt.Errorf("while getting parents of settled archived transactions: %w", err)
+		}
+		for _, p := range archivedParents {
+			parents[p.ID] = p.transaction()
+		}
+	}
+	for _, a := range archived {
+		t := a.transaction()
+		if a.BelongsToID != nil {
+			t.BelongsTo = parents[*a.BelongsToID]
+		}
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].ID < ts[j].ID })
+	return ts, nil
+}
@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const SettlementTestSchemaName = "payment_system_settlement_test"
+
+var _ = Describe("Using SettlementStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		settlementStore  *models.SettlementStore
+		merchant         *models.Merchant
+		err              error
+		create           = func(_type models.TransactionType, status models.TransactionStatus, amount float64, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, merchant, _type, status, amount, "settle@mail.bg", "0889787878", belongsTo)
+		}
+		settle = func() *models.PayoutBatch {
+			batches, err := settlementStore.SettleTransactions(context.Background(), time.Now())
+			Expect(err).To(BeNil())
+			for _, b := range batches {
+				if b.MerchantID == merchant.UserID {
+					return b
+				}
+			}
+			return nil
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, SettlementTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		settlementStore = models.NewSettlementStore(gormDB)
+		merchant, err = models.NewMerchant("Settlement Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+		plan, err := models.NewFeePlan(merchant.UserID, models.DefaultCurrencyCode, models.FeeRate{BasisPoints: 250}, models.RefundFeeNone, nil)
+		Expect(err).To(BeNil())
+		Expect(models.NewFeePlanStore(gormDB).SetFeePlan(context.Background(), plan)).To(Succeed())
+	})
+
+	It("settles charges and refunds into a batch net of their fees", func() {
+		authorize := create(models.TypeAuthorize, models.StatusApproved, 50, nil)
+		capture := create(models.TypeCharge, models.StatusApproved, 50, authorize)
+		charge := create(models.TypeCharge, models.StatusApproved, 100, nil)
+		refund := create(models.TypeRefund, models.StatusApproved, 30, charge)
+		create(models.TypeCharge, models.StatusError, 70, nil)
+
+		batch := settle()
+		Expect(batch).NotTo(BeNil())
+		Expect(batch.TransactionCount).To(Equal(3))
+		Expect(batch.GrossAmount).To(BeEquivalentTo(models.ToCurrency(120)))
+		Expect(batch.FeeAmount).To(BeEquivalentTo(models.ToCurrency(3.75)))
+		Expect(batch.NetAmount).To(BeEquivalentTo(models.ToCurrency(116.25)))
+		Expect(settle()).To(BeNil())
+
+		ts, err := settlementStore.GetPayoutBatchTransactions(context.Background(), batch.ID)
+		Expect(err).To(BeNil())
+		uuids := make([]string, len(ts))
+		for i, t := range ts {
+			uuids[i] = t.ExternalID
+			Expect(t.PayoutBatchID).To(Equal(&batch.ID))
+		}
+		Expect(uuids).To(Equal([]string{capture.ExternalID, charge.ExternalID, refund.ExternalID}))
+		Expect(ts[2].SettledAmount()).To(BeEquivalentTo(-models.ToCurrency(30)))
+		Expect(ts[2].BelongsTo.ExternalID).To(Equal(charge.ExternalID))
+
+		later := create(models.TypeRefund, models.StatusApproved, 70, charge)
+		next := settle()
+		Expect(next).NotTo(BeNil())
+		Expect(next.TransactionCount).To(Equal(1))
+		Expect(next.NetAmount).To(BeEquivalentTo(-models.ToCurrency(70)))
+		later, err = transactionStore.GetTransactionByUUID(context.Background(), later.ExternalID)
+		Expect(err).To(BeNil())
+		Expect(later.PayoutBatchID).To(Equal(&next.ID))
+	})
+
+	It("scopes payout batches to their merchant", func() {
+		create(models.TypeCharge, models.StatusApproved, 10, nil)
+		batch := settle()
+		Expect(batch).NotTo(BeNil())
+
+		other := merchant.UserID + 1000
+		_, err := settlementStore.GetPayoutBatchByUUID(context.Background(), batch.ExternalID, &other)
+		Expect(err).To(MatchError(models.ErrPayoutBatchNotFound))
+		found, err := settlementStore.GetPayoutBatchByUUID(context.Background(), batch.ExternalID, &merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(found.Merchant.Email).To(Equal(merchant.Email))
+
+		batches, err := settlementStore.GetPayoutBatches(context.Background(), &merchant.UserID)
+		Expect(err).To(BeNil())
+		Expect(batches).To(HaveLen(1))
+		_, err = settlementStore.GetPayoutBatchByUUID(context.Background(), "not-a-uuid", nil)
+		Expect(err).To(MatchError(models.ErrPayoutBatchNotFound))
+	})
+})
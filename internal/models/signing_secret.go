@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// signingSecretBytes is the number of random bytes in signing and webhook secrets
+const signingSecretBytes = 32
+
+// ErrSigningSecretNotFound is returned when a merchant has no signing secret
+var ErrSigningSecretNotFound = errors.New("signing secret not found")
+
+// SigningSecret is the secret shared with a merchant which the merchant signs its requests with.
+// Unlike API keys it is stored as is, since it is needed to verify signatures.
+type SigningSecret struct {
+	MerchantID uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	Secret     string
+}
+
+// randomSecret returns a new random secret shared with a merchant
+func randomSecret() (string, error) {
+	b := make([]byte, signingSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RotateSigningSecret replaces the signing secret of the merchant with merchantEmail with a new one and returns it
+func (s *MerchantStore) RotateSigningSecret(ctx context.Context, merchantEmail string) (string, error) {
+	m := Merchant{}
+	res := s.db.WithContext(ctx).Model(&Merchant{}).Where("email = ?", strings.ToLower(merchantEmail)).First(&m)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return "", ErrMerchantNotFound
+	} else if err := res.Error; err != nil {
+		return "", fmt.Errorf("while getting merchant of signing secret: %w", err)
+	}
+
+	value, err := randomSecret()
+	if err != nil {
+		return "", fmt.Errorf("while generating signing secret: %w", err)
+	}
+	secret := &SigningSecret{MerchantID: m.UserID, CreatedAt: time.Now(), Secret: value}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "merchant_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "secret"}),
+	}).Create(secret).Error
+	if err != nil {
+		return "", fmt.Errorf("while storing signing secret: %w", err)
+	}
+	return secret.Secret, nil
+}
+
+// GetSigningSecret returns the signing secret of the merchant with merchantEmail
+func (s *MerchantStore) GetSigningSecret(ctx context.Context, merchantEmail string) (string, error) {
+	secret := SigningSecret{}
+	res := s.db.WithContext(ctx).
+		Where("merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", strings.ToLower(merchantEmail)).
+		Limit(1).Find(&secret)
+	if err := res.Error; err != nil {
+		return "", fmt.Errorf("while getting signing secret: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return "", ErrSigningSecretNotFound
+	}
+	return secret.Secret, nil
+}
+
+// DeleteSigningSecret deletes the signing secret of the merchant with merchantEmail, so that its requests no longer have to be signed
+func (s *MerchantStore) DeleteSigningSecret(ctx context.Context, merchantEmail string) error {
+	res := s.db.WithContext(ctx).
+		Where("merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", strings.ToLower(merchantEmail)).
+		Delete(&SigningSecret{})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while deleting signing secret: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSigningSecretNotFound
+	}
+	return nil
+}
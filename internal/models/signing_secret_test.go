@@ -0,0 +1,57 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const SigningSecretTestSchemaName = "payment_system_signing_secret_test"
+
+var _ = Describe("Using MerchantStore for signing secrets", func() {
+	var (
+		merchantStore *models.MerchantStore
+		merchant      *models.Merchant
+		err           error
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, SigningSecretTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		merchant, err = models.NewMerchant("Signing Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+	})
+
+	It("rotates, gets and deletes signing secrets", func() {
+		_, err = merchantStore.GetSigningSecret(context.Background(), merchant.Email)
+		Expect(err).To(MatchError(models.ErrSigningSecretNotFound))
+
+		first, err := merchantStore.RotateSigningSecret(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		second, err := merchantStore.RotateSigningSecret(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(second).NotTo(Equal(first))
+
+		secret, err := merchantStore.GetSigningSecret(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(secret).To(Equal(second))
+
+		Expect(merchantStore.DeleteSigningSecret(context.Background(), merchant.Email)).To(Succeed())
+		_, err = merchantStore.GetSigningSecret(context.Background(), merchant.Email)
+		Expect(err).To(MatchError(models.ErrSigningSecretNotFound))
+		Expect(merchantStore.DeleteSigningSecret(context.Background(), merchant.Email)).To(MatchError(models.ErrSigningSecretNotFound))
+	})
+
+	It("fails to rotate signing secrets of missing merchants", func() {
+		_, err = merchantStore.RotateSigningSecret(context.Background(), "missing@abv.bg")
+		Expect(err).To(MatchError(models.ErrMerchantNotFound))
+	})
+})
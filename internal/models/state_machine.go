@@ -0,0 +1,247 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrIllegalTransition is matched by every error returned for a transition which is not declared.
+	ErrIllegalTransition = errors.New("illegal transaction transition")
+	// ErrIllegalParentType is returned when a transaction cannot belong to a transaction of the given type.
+	ErrIllegalParentType = errors.New("transaction cannot belong to a transaction of this type")
+	// ErrIllegalParentStatus is returned when a transaction cannot belong to a transaction in the given status.
+	ErrIllegalParentStatus = errors.New("transaction cannot belong to a transaction in this status")
+)
+
+// IllegalTransitionError describes a transition which was rejected by a StateMachine.
+type IllegalTransitionError struct {
+	Type         TransactionType
+	ParentType   TransactionType
+	ParentStatus TransactionStatus
+	// Reason is either ErrIllegalParentType or ErrIllegalParentStatus
+	Reason error
+}
+
+func (e *IllegalTransitionError) Error() string {
+	if e.ParentType == "" {
+		return fmt.Sprintf("%s transactions must belong to another transaction: %v", e.Type, e.Reason)
+	}
+	return fmt.Sprintf("%s transaction cannot belong to %s transaction in status %s: %v", e.Type, e.ParentType, e.ParentStatus, e.Reason)
+}
+
+func (e *IllegalTransitionError) Unwrap() error {
+	return e.Reason
+}
+
+func (e *IllegalTransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Transition declares that a transaction of Type can be created for a parent
+// (BelongsTo) transaction of ParentType, which is in one of ParentStatuses.
+// Transitions with an empty ParentType declare transactions without a parent.
+type Transition struct {
+	Type           TransactionType
+	ParentType     TransactionType
+	ParentStatuses []TransactionStatus
+
+	// ConsumesAmount is true when the amount of the transaction is subtracted
+	// from the remaining amount of the parent. ErrExceeded is returned when
+	// it is bigger than the remaining amount.
+	ConsumesAmount bool
+	ErrExceeded    error
+	// ReleasesRemainingAmount is true when the transaction releases the whole remaining
+	// amount of the parent, so its amount has to be equal to it.
+	ReleasesRemainingAmount bool
+
+	// PartialStatus and FullStatus are the statuses the parent moves to when
+	// part of or all of its remaining amount gets consumed. Empty statuses
+	// leave the status of the parent unchanged.
+	PartialStatus TransactionStatus
+	FullStatus    TransactionStatus
+}
+
+func (tr *Transition) allowsParentStatus(status TransactionStatus) bool {
+	for _, s := range tr.ParentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// StateMachine holds every legal transition between transactions.
+type StateMachine struct {
+	transitions []Transition
+}
+
+func NewStateMachine(transitions ...Transition) *StateMachine {
+	return &StateMachine{transitions: transitions}
+}
+
+// TransactionStateMachine is the state machine used for all transactions
+var TransactionStateMachine = NewStateMachine(
+	Transition{Type: TypeAuthorize},
+	Transition{Type: TypeCharge},
+	Transition{
+		Type:           TypeCharge,
+		ParentType:     TypeAuthorize,
+		ParentStatuses: []TransactionStatus{StatusApproved, StatusPartiallyCaptured},
+		ConsumesAmount: true,
+		ErrExceeded:    ErrCaptureExceedsAuthorization,
+		PartialStatus:  StatusPartiallyCaptured,
+		FullStatus:     StatusCaptured,
+	},
+	Transition{
+		Type:                    TypeReversal,
+		ParentType:              TypeAuthorize,
+		ParentStatuses:          []TransactionStatus{StatusApproved, StatusPartiallyCaptured},
+		ReleasesRemainingAmount: true,
+		PartialStatus:           StatusReversed,
+		FullStatus:              StatusReversed,
+	},
+	Transition{
+		Type:           TypeRefund,
+		ParentType:     TypeCharge,
+		ParentStatuses: []TransactionStatus{StatusApproved, StatusPartiallyRefunded},
+		ConsumesAmount: true,
+		ErrExceeded:    ErrRefundExceedsCharge,
+		PartialStatus:  StatusPartiallyRefunded,
+		FullStatus:     StatusRefunded,
+	},
+	Transition{
+		Type:           TypeChargeback,
+		ParentType:     TypeCharge,
+		ParentStatuses: []TransactionStatus{StatusApproved, StatusPartiallyRefunded},
+		ConsumesAmount: true,
+		ErrExceeded:    ErrChargebackExceedsCharge,
+	},
+	Transition{
+		Type:           TypeChargebackReversal,
+		ParentType:     TypeChargeback,
+		ParentStatuses: []TransactionStatus{StatusApproved},
+		PartialStatus:  StatusReversed,
+		FullStatus:     StatusReversed,
+	},
+)
+
+// Transition returns the transition for creating a transaction of type _type for parent.
+// parent is nil for transactions which do not belong to another transaction.
+func (m *StateMachine) Transition(_type TransactionType, parent *Transaction) (*Transition, error) {
+	var parentType TransactionType
+	if parent != nil {
+		parentType = parent.Type
+	}
+	var typeMatched bool
+	for i := range m.transitions {
+		tr := &m.transitions[i]
+		if tr.Type != _type || tr.ParentType != parentType {
+			continue
+		}
+		if parent == nil || tr.allowsParentStatus(parent.Status) {
+			return tr, nil
+		}
+		typeMatched = true
+	}
+
+	err := &IllegalTransitionError{Type: _type, ParentType: parentType, Reason: ErrIllegalParentType}
+	if parent != nil {
+		err.ParentStatus = parent.Status
+	}
+	if typeMatched {
+		err.Reason = ErrIllegalParentStatus
+	}
+	return nil, err
+}
+
+// Validate checks whether t can be created for parent, including whether its amount fits in the parent.
+func (m *StateMachine) Validate(t, parent *Transaction) error {
+	tr, err := m.Transition(t.Type, parent)
+	if err != nil {
+		return err
+	}
+	if parent != nil && t.CurrencyCode != parent.CurrencyCode {
+		return fmt.Errorf("while creating %s in %s for transaction in %s: %w", t.Type, t.CurrencyCode, parent.CurrencyCode, ErrCurrencyMismatch)
+	}
+	if tr.ReleasesRemainingAmount && t.Amount != parent.RemainingAmount() {
+		return fmt.Errorf("while creating %s for %s instead of the remaining %s: %w", t.Type, t.CurrencyCode.Format(t.Amount), t.CurrencyCode.Format(parent.RemainingAmount()), ErrInvalidAmount)
+	}
+	if !tr.ConsumesAmount {
+		return nil
+	}
+	if t.Amount == 0 {
+		return ErrInvalidAmount
+	}
+	if t.Amount > parent.RemainingAmount() {
+		return fmt.Errorf("while creating %s for %s: %w", t.Type, t.CurrencyCode.Format(t.Amount), tr.ErrExceeded)
+	}
+	return nil
+}
+
+// Apply validates t and moves parent to the state it has after t is created.
+func (m *StateMachine) Apply(t, parent *Transaction) error {
+	if err := m.Validate(t, parent); err != nil {
+		return err
+	}
+	if parent == nil {
+		return nil
+	}
+	tr, _ := m.Transition(t.Type, parent)
+	if tr.ConsumesAmount {
+		parent.consume(t.Type, t.Amount)
+	}
+	status := tr.PartialStatus
+	if parent.RemainingAmount() == 0 || !tr.ConsumesAmount {
+		status = tr.FullStatus
+	}
+	if status != "" {
+		parent.Status = status
+	}
+	return nil
+}
+
+// Table returns all transitions as rows of a table, starting with a header row
+func (m *StateMachine) Table() [][]string {
+	rows := [][]string{{"Type", "Parent type", "Parent statuses", "Parent status after partial amount", "Parent status after full amount"}}
+	for _, tr := range m.transitions {
+		parentType, statuses := string(tr.ParentType), make([]string, 0, len(tr.ParentStatuses))
+		if parentType == "" {
+			parentType = "-"
+		}
+		for _, s := range tr.ParentStatuses {
+			statuses = append(statuses, string(s))
+		}
+		partial, full := string(tr.PartialStatus), string(tr.FullStatus)
+		if !tr.ConsumesAmount {
+			partial = "-"
+		}
+		rows = append(rows, []string{string(tr.Type), parentType, orDash(strings.Join(statuses, ", ")), orDash(partial), orDash(full)})
+	}
+	return rows
+}
+
+// WriteMarkdownTable writes the table returned by Table to w in markdown format
+func (m *StateMachine) WriteMarkdownTable(w io.Writer) error {
+	rows := m.Table()
+	separator := make([]string, len(rows[0]))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	rows = append(rows[:1], append([][]string{separator}, rows[1:]...)...)
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+			return fmt.Errorf("while writing state machine table: %w", err)
+		}
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package models_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// The state machine does not need a database, so its tests are plain tests outside of the Ginkgo suite
+// and can be run on their own with: go test -run TestTransactionStateMachine ./internal/models
+
+var sm = models.TransactionStateMachine
+
+func newParent(_type models.TransactionType, status models.TransactionStatus, amount float64) *models.Transaction {
+	return &models.Transaction{Type: _type, Status: status, Amount: models.ToCurrency(amount)}
+}
+
+func newChild(_type models.TransactionType, amount float64) *models.Transaction {
+	return &models.Transaction{Type: _type, Status: models.StatusApproved, Amount: models.ToCurrency(amount)}
+}
+
+func TestTransactionStateMachineValidate(t *testing.T) {
+	t.Run("allows transactions without parents only for authorize and charge", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(sm.Validate(newChild(models.TypeAuthorize, 10), nil)).To(Succeed())
+		g.Expect(sm.Validate(newChild(models.TypeCharge, 10), nil)).To(Succeed())
+
+		err := sm.Validate(newChild(models.TypeRefund, 10), nil)
+		g.Expect(errors.Is(err, models.ErrIllegalTransition)).To(BeTrue())
+		g.Expect(errors.Is(err, models.ErrIllegalParentType)).To(BeTrue())
+	})
+	t.Run("returns typed error for an illegal parent type", func(t *testing.T) {
+		g := NewWithT(t)
+		err := sm.Validate(newChild(models.TypeRefund, 10), newParent(models.TypeAuthorize, models.StatusApproved, 10))
+		var transitionErr *models.IllegalTransitionError
+		g.Expect(errors.As(err, &transitionErr)).To(BeTrue())
+		g.Expect(transitionErr.ParentType).To(Equal(models.TypeAuthorize))
+		g.Expect(errors.Is(err, models.ErrIllegalParentType)).To(BeTrue())
+	})
+	t.Run("returns typed error for an illegal parent status", func(t *testing.T) {
+		g := NewWithT(t)
+		err := sm.Validate(newChild(models.TypeRefund, 10), newParent(models.TypeCharge, models.StatusReversed, 10))
+		g.Expect(errors.Is(err, models.ErrIllegalTransition)).To(BeTrue())
+		g.Expect(errors.Is(err, models.ErrIllegalParentStatus)).To(BeTrue())
+
+		err = sm.Validate(newChild(models.TypeReversal, 10), newParent(models.TypeAuthorize, models.StatusCaptured, 10))
+		g.Expect(errors.Is(err, models.ErrIllegalParentStatus)).To(BeTrue())
+	})
+	t.Run("rejects transactions in a different currency than the parent", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeAuthorize, models.StatusApproved, 10)
+		parent.CurrencyCode = "EUR"
+		child := newChild(models.TypeCharge, 10)
+		child.CurrencyCode = "USD"
+		g.Expect(errors.Is(sm.Validate(child, parent), models.ErrCurrencyMismatch)).To(BeTrue())
+
+		child.CurrencyCode = "EUR"
+		g.Expect(sm.Validate(child, parent)).To(Succeed())
+	})
+	t.Run("rejects amounts exceeding the remaining amount of the parent", func(t *testing.T) {
+		g := NewWithT(t)
+		err := sm.Validate(newChild(models.TypeCharge, 11), newParent(models.TypeAuthorize, models.StatusApproved, 10))
+		g.Expect(errors.Is(err, models.ErrCaptureExceedsAuthorization)).To(BeTrue())
+
+		err = sm.Validate(newChild(models.TypeRefund, 11), newParent(models.TypeCharge, models.StatusApproved, 10))
+		g.Expect(errors.Is(err, models.ErrRefundExceedsCharge)).To(BeTrue())
+
+		err = sm.Validate(newChild(models.TypeRefund, 0), newParent(models.TypeCharge, models.StatusApproved, 10))
+		g.Expect(errors.Is(err, models.ErrInvalidAmount)).To(BeTrue())
+	})
+}
+
+func TestTransactionStateMachineApply(t *testing.T) {
+	t.Run("moves authorizations through partial and full capture", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeAuthorize, models.StatusApproved, 10)
+		g.Expect(sm.Apply(newChild(models.TypeCharge, 4), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusPartiallyCaptured))
+		g.Expect(parent.RemainingAmount()).To(Equal(models.ToCurrency(6)))
+
+		g.Expect(sm.Apply(newChild(models.TypeCharge, 6), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusCaptured))
+		g.Expect(parent.RemainingAmount()).To(BeZero())
+
+		g.Expect(sm.Apply(newChild(models.TypeCharge, 1), parent)).NotTo(Succeed())
+	})
+	t.Run("moves charges through partial and full refund", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeCharge, models.StatusApproved, 10)
+		g.Expect(sm.Apply(newChild(models.TypeRefund, 4), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusPartiallyRefunded))
+
+		g.Expect(sm.Apply(newChild(models.TypeRefund, 6), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusRefunded))
+	})
+	t.Run("charges back charges without changing their status", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeCharge, models.StatusApproved, 10)
+		g.Expect(sm.Apply(newChild(models.TypeChargeback, 6), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusApproved))
+		g.Expect(parent.DisputedAmount).To(Equal(models.ToCurrency(6)))
+		g.Expect(parent.RemainingAmount()).To(Equal(models.ToCurrency(4)))
+
+		err := sm.Validate(newChild(models.TypeRefund, 5), parent)
+		g.Expect(errors.Is(err, models.ErrRefundExceedsCharge)).To(BeTrue())
+		err = sm.Validate(newChild(models.TypeChargeback, 5), parent)
+		g.Expect(errors.Is(err, models.ErrChargebackExceedsCharge)).To(BeTrue())
+
+		chargeback := newParent(models.TypeChargeback, models.StatusApproved, 6)
+		g.Expect(sm.Apply(newChild(models.TypeChargebackReversal, 6), chargeback)).To(Succeed())
+		g.Expect(chargeback.Status).To(Equal(models.StatusReversed))
+	})
+	t.Run("reverses the remaining amount of authorizations", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeAuthorize, models.StatusApproved, 10)
+		g.Expect(sm.Apply(newChild(models.TypeReversal, 10), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusReversed))
+		g.Expect(parent.RemainingAmount()).To(BeZero())
+	})
+	t.Run("reverses the uncaptured amount of partially captured authorizations", func(t *testing.T) {
+		g := NewWithT(t)
+		parent := newParent(models.TypeAuthorize, models.StatusApproved, 10)
+		g.Expect(sm.Apply(newChild(models.TypeCharge, 4), parent)).To(Succeed())
+
+		err := sm.Validate(newChild(models.TypeReversal, 10), parent)
+		g.Expect(errors.Is(err, models.ErrInvalidAmount)).To(BeTrue())
+
+		g.Expect(sm.Apply(newChild(models.TypeReversal, 6), parent)).To(Succeed())
+		g.Expect(parent.Status).To(Equal(models.StatusReversed))
+		g.Expect(parent.CapturedAmount).To(Equal(models.ToCurrency(4)))
+		g.Expect(parent.RemainingAmount()).To(BeZero())
+	})
+}
+
+func TestTransactionStateMachineTable(t *testing.T) {
+	g := NewWithT(t)
+	sb := &strings.Builder{}
+	g.Expect(sm.WriteMarkdownTable(sb)).To(Succeed())
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	g.Expect(lines).To(HaveLen(len(sm.Table()) + 1))
+	g.Expect(lines[1]).To(HavePrefix("| --- |"))
+	g.Expect(sb.String()).To(ContainSubstring("| REFUND | CHARGE | APPROVED, PARTIALLY_REFUNDED | PARTIALLY_REFUNDED | REFUNDED |"))
+}
@@ -14,19 +14,40 @@ import (
 	"github.com/docker/distribution/uuid"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TransactionStatus string
 
 const (
-	StatusApproved TransactionStatus = "APPROVED"
-	StatusReversed TransactionStatus = "REVERSED"
-	StatusRefunded TransactionStatus = "REFUNDED"
-	StatusError    TransactionStatus = "ERROR"
+	StatusApproved          TransactionStatus = "APPROVED"
+	StatusPartiallyCaptured TransactionStatus = "PARTIALLY_CAPTURED"
+	StatusCaptured          TransactionStatus = "CAPTURED"
+	StatusReversed          TransactionStatus = "REVERSED"
+	StatusPartiallyRefunded TransactionStatus = "PARTIALLY_REFUNDED"
+	StatusRefunded          TransactionStatus = "REFUNDED"
+	StatusError             TransactionStatus = "ERROR"
+	// StatusPendingReview holds a transaction flagged by the risk engine until an admin approves or declines it
+	StatusPendingReview TransactionStatus = "PENDING_REVIEW"
+)
+
+var (
+	// ErrInvalidAmount is returned when a transaction which moves money has no amount.
+	ErrInvalidAmount = errors.New("transaction amount must be greater than zero")
+	// ErrCaptureExceedsAuthorization is returned when the sum of all captures would exceed the authorized amount.
+	ErrCaptureExceedsAuthorization = errors.New("captured amount cannot exceed the remaining authorized amount")
+	// ErrRefundExceedsCharge is returned when the sum of all refunds would exceed the charged amount.
+	ErrRefundExceedsCharge = errors.New("refunded amount cannot exceed the remaining charged amount")
+	// ErrChargebackExceedsCharge is returned when the sum of all refunds and chargebacks would exceed the charged amount.
+	ErrChargebackExceedsCharge = errors.New("disputed amount cannot exceed the remaining charged amount")
+	// ErrCurrencyMismatch is returned when a transaction has a different currency than the transaction it belongs to.
+	ErrCurrencyMismatch = errors.New("transaction currency must match the currency of the referenced transaction")
+	// ErrTransactionNotPendingReview is returned when a transaction which is not held for review is approved or declined.
+	ErrTransactionNotPendingReview = errors.New("transaction is not pending review")
 )
 
 func NewTransactionStatus(s string) (TransactionStatus, error) {
-	return enumFactory(s, StatusApproved, StatusReversed, StatusRefunded, StatusError)
+	return enumFactory(s, StatusApproved, StatusPartiallyCaptured, StatusCaptured, StatusReversed, StatusPartiallyRefunded, StatusRefunded, StatusError, StatusPendingReview)
 }
 
 func (ts *TransactionStatus) Scan(value interface{}) error {
@@ -44,10 +65,13 @@ const (
 	TypeCharge    TransactionType = "CHARGE"
 	TypeRefund    TransactionType = "REFUND"
 	TypeReversal  TransactionType = "REVERSAL"
+	// TypeChargeback and TypeChargebackReversal are only created by disputes
+	TypeChargeback         TransactionType = "CHARGEBACK"
+	TypeChargebackReversal TransactionType = "CHARGEBACK_REVERSAL"
 )
 
 func NewTransactionType(s string) (TransactionType, error) {
-	return enumFactory(s, TypeAuthorize, TypeCharge, TypeRefund, TypeReversal)
+	return enumFactory(s, TypeAuthorize, TypeCharge, TypeRefund, TypeReversal, TypeChargeback, TypeChargebackReversal)
 }
 
 func (tt *TransactionType) Scan(value interface{}) error {
@@ -66,48 +90,176 @@ type Transaction struct {
 	ExternalID    string            `gorm:"column:ext_uuid;type:uuid"`
 	Type          TransactionType   `gorm:"column:_type;type:transaction_type"`
 	Amount        Currency          `gorm:"type:bigint"`
+	CurrencyCode  CurrencyCode      `gorm:"type:char(3)"`
 	Status        TransactionStatus `gorm:"type:transaction_status"`
 	CustomerEmail string
+	// CustomerPhone is in E.164 format
 	CustomerPhone string
+	// CustomerID is the customer profile of the merchant with CustomerEmail
+	CustomerID *uint
+	Customer   *Customer
+	// SystemGenerated is true for transactions created by the system rather than by a merchant
+	SystemGenerated bool
+
+	// CapturedAmount is the sum of all charges made against an AUTHORIZE transaction
+	CapturedAmount Currency `gorm:"type:bigint"`
+	// RefundedAmount is the sum of all refunds made against a CHARGE transaction
+	RefundedAmount Currency `gorm:"type:bigint"`
+	// DisputedAmount is the sum of all chargebacks of a CHARGE transaction, which have not been reversed
+	DisputedAmount Currency `gorm:"type:bigint"`
+	// FeeAmount is the fee charged to the merchant for the transaction according to its fee plan.
+	// It is negative when fees are returned to the merchant, e.g. by refunds.
+	FeeAmount int64
+	// RiskDecision and RiskRuleID are the outcome of the risk assessment of the transaction and the rule which made it.
+	// Only transactions which do not belong to another transaction are assessed.
+	RiskDecision RiskDecision
+	RiskRuleID   string
+	RiskReasons  []RiskReason
+	// ReviewedAt and ReviewedBy are set when an admin approves or declines a transaction pending review
+	ReviewedAt *time.Time
+	ReviewedBy string
 
 	MerchantID uint
 	Merchant   Merchant
+	// PayoutBatchID is the payout batch the transaction has been settled in
+	PayoutBatchID *uint
 
 	BelongsToID *uint `gorm:"column:belongs_to"`
 	BelongsTo   *Transaction
+
+	// parent is the locked BelongsTo transaction, loaded while t is being created
+	parent *Transaction
+}
+
+// RemainingAuthorizedAmount returns the amount of an AUTHORIZE transaction which can still be captured.
+// Nothing remains of reversed authorizations, since their remaining amount has been released.
+func (t *Transaction) RemainingAuthorizedAmount() Currency {
+	if t.Type != TypeAuthorize || t.Status == StatusReversed || t.CapturedAmount >= t.Amount {
+		return 0
+	}
+	return t.Amount - t.CapturedAmount
+}
+
+// RemainingRefundableAmount returns the amount of a CHARGE transaction which can still be refunded or disputed
+func (t *Transaction) RemainingRefundableAmount() Currency {
+	if t.Type != TypeCharge || t.RefundedAmount+t.DisputedAmount >= t.Amount {
+		return 0
+	}
+	return t.Amount - t.RefundedAmount - t.DisputedAmount
+}
+
+// RemainingAmount returns the amount which can still be consumed by the children of t
+func (t *Transaction) RemainingAmount() Currency {
+	switch t.Type { //nolint:exhaustive
+	case TypeAuthorize:
+		return t.RemainingAuthorizedAmount()
+	case TypeCharge:
+		return t.RemainingRefundableAmount()
+	default:
+		return 0
+	}
+}
+
+// effective reports whether t moves money, i.e. it has neither failed nor is held for review
+func (t *Transaction) effective() bool {
+	return t.Status != StatusError && t.Status != StatusPendingReview
+}
+
+// consume subtracts amount of a child transaction of type childType from the remaining amount of t
+func (t *Transaction) consume(childType TransactionType, amount Currency) {
+	switch { //nolint:exhaustive
+	case t.Type == TypeAuthorize:
+		t.CapturedAmount += amount
+	case t.Type == TypeCharge && childType == TypeChargeback:
+		t.DisputedAmount += amount
+	case t.Type == TypeCharge:
+		t.RefundedAmount += amount
+	}
 }
 
 func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
 	user := &User{}
 	res := tx.Model(&User{}).Where("id = ?", t.MerchantID).First(user)
 	if res.Error != nil {
-		return fmt.Errorf("while getting user in transaction before create hook: %w", err)
+		return fmt.Errorf("while getting user in transaction before create hook: %w", res.Error)
 	}
-	if user.Status != StatusActive {
+	// system generated transactions, e.g. chargebacks, are not initiated by the merchant and apply regardless of its status
+	if user.Status != StatusActive && !t.SystemGenerated {
 		return errors.New("while creating transaction: user not in active status")
 	}
-	return err
+	if t.BelongsToID != nil {
+		t.parent = &Transaction{}
+		res = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *t.BelongsToID).First(t.parent)
+		if res.Error != nil {
+			return fmt.Errorf("while locking referenced transaction in before create hook: %w", res.Error)
+		}
+	}
+	if err = linkCustomer(tx, t); err != nil {
+		return fmt.Errorf("in transaction before create hook: %w", err)
+	}
+
+	err = TransactionStateMachine.Validate(t, t.parent)
+	if t.Status == StatusError && errors.Is(err, ErrIllegalParentStatus) {
+		// failed attempts are stored as long as the transaction types are compatible
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = checkLimits(tx, t); err != nil {
+		return err
+	}
+	plan, err := getFeePlan(tx, t.MerchantID)
+	if err != nil {
+		return fmt.Errorf("while computing fee in transaction before create hook: %w", err)
+	}
+	if plan != nil {
+		t.FeeAmount = plan.Fee(t, t.parent)
+	}
+	return nil
 }
 
 func (t *Transaction) AfterCreate(tx *gorm.DB) (err error) {
-	if t.BelongsToID != nil {
-		switch t.Type { //nolint:exhaustive
-		case TypeRefund:
-			res := tx.Model(&Transaction{}).Where("id = ?", *t.BelongsToID).Update("status", StatusRefunded)
-			if err := res.Error; err != nil {
-				return fmt.Errorf("while updating refund referenced transaction in after create hook: %w", err)
-			}
-		case TypeReversal:
-			res := tx.Model(&Transaction{}).Where("id = ?", *t.BelongsToID).Update("status", StatusReversed)
-			if err := res.Error; err != nil {
-				return fmt.Errorf("while updating reversal referenced transaction in adter create hook: %w", err)
-			}
-		}
+	var previousParentStatus TransactionStatus
+	if t.parent != nil {
+		previousParentStatus = t.parent.Status
+	}
+	if err := t.applyAfterCreate(tx); err != nil {
+		return err
+	}
+	if err := writeTransactionEvents(tx, t, previousParentStatus); err != nil {
+		return fmt.Errorf("while writing transaction events in after create hook: %w", err)
 	}
 	return nil
 }
 
-func NewTransaction(externalID string, amount Currency, Type TransactionType, status TransactionStatus, customerEmail string, customerPhone string, merchantID uint, belongsToID *uint) (*Transaction, error) {
+// applyAfterCreate posts t to the ledger and applies it to the transaction it belongs to.
+// Transactions pending review are applied once they are approved.
+func (t *Transaction) applyAfterCreate(tx *gorm.DB) error {
+	if !t.effective() {
+		return nil
+	}
+	if err := writeJournalEntry(tx, t); err != nil {
+		return fmt.Errorf("while posting transaction to ledger in after create hook: %w", err)
+	}
+	if t.parent == nil {
+		return nil
+	}
+	if err := TransactionStateMachine.Apply(t, t.parent); err != nil {
+		return fmt.Errorf("while applying transaction to referenced transaction in after create hook: %w", err)
+	}
+	res := tx.Model(&Transaction{}).Where("id = ?", t.parent.ID).Updates(map[string]interface{}{
+		"captured_amount": t.parent.CapturedAmount,
+		"refunded_amount": t.parent.RefundedAmount,
+		"disputed_amount": t.parent.DisputedAmount,
+		"status":          t.parent.Status,
+	})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while updating referenced transaction in after create hook: %w", err)
+	}
+	return nil
+}
+
+func NewTransaction(externalID string, amount Currency, currencyCode CurrencyCode, Type TransactionType, status TransactionStatus, customerEmail string, customerPhone string, merchantID uint, belongsToID *uint) (*Transaction, error) {
 	_, err := mail.ParseAddress(customerEmail)
 	if err != nil {
 		return nil, fmt.Errorf("while creating transaction: %q is not a valid email address: %w", customerEmail, err)
@@ -116,10 +268,18 @@ func NewTransaction(externalID string, amount Currency, Type TransactionType, st
 	if err != nil {
 		return nil, fmt.Errorf("while creating transaction: %q is not a valid uuid: %w", externalID, err)
 	}
+	if !currencyCode.Valid() {
+		return nil, fmt.Errorf("while creating transaction: %q is not a supported currency code", currencyCode)
+	}
+	customerPhone, err = NormalizePhone(customerPhone)
+	if err != nil {
+		return nil, fmt.Errorf("while creating transaction: %w", err)
+	}
 	transaction := &Transaction{
 		ExternalID:    externalID,
 		Type:          Type,
 		Amount:        amount,
+		CurrencyCode:  currencyCode,
 		Status:        status,
 		CustomerEmail: strings.ToLower(customerEmail),
 		CustomerPhone: customerPhone,
@@ -141,6 +301,32 @@ func (s *TransactionStore) CreateTransaction(ctx context.Context, t *Transaction
 	return createSingleGorm[Transaction](ctx, t, s.db)
 }
 
+// CreateTransactionIdempotently creates t and stores k in the same DB transaction.
+// render is called with the created transaction to produce the response stored in k.
+func (s *TransactionStore) CreateTransactionIdempotently(ctx context.Context, t *Transaction, k *IdempotencyKey, render func(*Transaction) (int, []byte, error)) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		status, body, err := render(t)
+		if err != nil {
+			return fmt.Errorf("while rendering idempotent response: %w", err)
+		}
+		k.TransactionID, k.ResponseStatus, k.ResponseBody = &t.ID, status, body
+		return tx.Create(k).Error
+	})
+	switch {
+	case err == nil:
+		return nil
+	case pgConstraintViolation(err, pgUniqueViolationCode, idempotencyKeyUniqueConstraint):
+		return ErrIdempotencyKeyConflict
+	case pgConstraintViolation(err, pgUniqueViolationCode, transactionExtUUIDUniqueConstraint):
+		return ErrDuplicateTransaction
+	default:
+		return fmt.Errorf("while creating transaction idempotently: %w", err)
+	}
+}
+
 func (s *TransactionStore) CreateTransactions(ctx context.Context, ts []*Transaction) error {
 	return createMultipleGorm[Transaction](ctx, ts, s.db)
 }
@@ -148,12 +334,59 @@ func (s *TransactionStore) CreateTransactions(ctx context.Context, ts []*Transac
 func (s *TransactionStore) GetTransactionByUUID(ctx context.Context, extID string) (*Transaction, error) {
 	var t Transaction
 	err := s.db.WithContext(ctx).Model(&Transaction{}).Where("ext_uuid = ?", extID).Preload("Merchant").Preload("BelongsTo").First(&t).Error
-	if err != nil {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTransactionNotFound
+	} else if err != nil {
 		return nil, fmt.Errorf("while getting all transctions: %w", err)
 	}
 	return &t, nil
 }
 
+// ErrTransactionNotFound is returned when a transaction does not exist or is not visible to the caller
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// GetTransactionChainByUUID returns the chain of the transaction with extID: the transaction without a
+// parent it belongs to (directly or indirectly) followed by all transactions belonging to it, ordered by ID.
+// If merchantID is not nil, only transactions of that merchant are returned.
+func (s *TransactionStore) GetTransactionChainByUUID(ctx context.Context, extID string, merchantID *uint) ([]*Transaction, error) {
+	if _, err := uuid.Parse(extID); err != nil {
+		return nil, ErrTransactionNotFound
+	}
+	merchantCondition := "TRUE"
+	args := []any{extID}
+	if merchantID != nil {
+		merchantCondition = "merchant_id = ?"
+		args = append(args, *merchantID)
+	}
+	var ids []uint
+	err := s.db.WithContext(ctx).Raw(`WITH RECURSIVE ancestor AS (
+		SELECT id, belongs_to FROM transaction WHERE ext_uuid = ? AND `+merchantCondition+`
+		UNION ALL
+		SELECT t.id, t.belongs_to FROM transaction t JOIN ancestor a ON t.id = a.belongs_to
+	), chain AS (
+		SELECT id FROM ancestor WHERE belongs_to IS NULL
+		UNION ALL
+		SELECT t.id FROM transaction t JOIN chain c ON t.belongs_to = c.id
+	) SELECT id FROM chain`, args...).Scan(&ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting transaction chain: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+
+	query := s.db.WithContext(ctx).Where("id IN ?", ids)
+	if merchantID != nil {
+		query = query.Where("merchant_id = ?", *merchantID)
+	}
+	var ts []*Transaction
+	if err = query.Preload("Merchant").Order("id").Find(&ts).Error; err != nil {
+		return nil, fmt.Errorf("while getting transaction chain: %w", err)
+	}
+	s.buildTransactionRelations(ts)
+	return ts, nil
+}
+
 func (s *TransactionStore) GetAllTransactions(ctx context.Context) ([]*Transaction, error) {
 	var ts []*Transaction
 	err := s.db.WithContext(ctx).Preload("Merchant").Find(&ts).Error
@@ -170,15 +403,15 @@ func (s *TransactionStore) DeleteTransaction(ctx context.Context, t *Transaction
 
 type TransactionPeriodicJob func(context.Context)
 
-func (s *TransactionStore) GetPeriodicJobDeleter(deleteOlderThan, jobExecutionInterval time.Duration) TransactionPeriodicJob {
+// GetPeriodicJobAuthorizationExpirer returns a job which reverses approved authorizations older than authorizationTTL
+func (s *TransactionStore) GetPeriodicJobAuthorizationExpirer(authorizationTTL, jobExecutionInterval time.Duration) TransactionPeriodicJob {
 	return func(ctx context.Context) {
 		ticker := time.NewTicker(jobExecutionInterval)
 		for {
 			select {
 			case <-ticker.C:
-				res := s.db.Where("created_at < ?", time.Now().Add(-deleteOlderThan)).Delete(&Transaction{})
-				if err := res.Error; err != nil {
-					logrus.Warnf("periodic transaction deletion job failed: %v", err)
+				if err := s.ExpireAuthorizations(ctx, time.Now().Add(-authorizationTTL)); err != nil {
+					logrus.Warnf("periodic authorization expiry job failed: %v", err)
 				}
 			case <-ctx.Done():
 				return
@@ -187,6 +420,44 @@ func (s *TransactionStore) GetPeriodicJobDeleter(deleteOlderThan, jobExecutionIn
 	}
 }
 
+// ExpireAuthorizations creates a system generated REVERSAL for every AUTHORIZE transaction
+// created before createdBefore, which is still in APPROVED status (i.e. has not been charged).
+func (s *TransactionStore) ExpireAuthorizations(ctx context.Context, createdBefore time.Time) error {
+	var ts []*Transaction
+	err := s.db.WithContext(ctx).
+		Where("_type = ? AND status = ? AND created_at < ?", TypeAuthorize, StatusApproved, createdBefore).
+		Find(&ts).Error
+	if err != nil {
+		return fmt.Errorf("while getting expired authorizations: %w", err)
+	}
+	for _, t := range ts {
+		reversal := newExpiryReversal(t)
+		if err := s.CreateTransaction(ctx, reversal); err != nil {
+			// the authorization might have been charged or reversed in the meantime
+			logrus.Warnf("could not reverse expired authorization %s: %v", t.ExternalID, err)
+			continue
+		}
+		logrus.Infof("reversed expired authorization %s of merchant %d for %s with transaction %s",
+			t.ExternalID, t.MerchantID, t.CurrencyCode.Format(t.Amount), reversal.ExternalID)
+	}
+	return nil
+}
+
+func newExpiryReversal(authorization *Transaction) *Transaction {
+	return &Transaction{
+		ExternalID:      uuid.Generate().String(),
+		Type:            TypeReversal,
+		Amount:          authorization.RemainingAuthorizedAmount(),
+		CurrencyCode:    authorization.CurrencyCode,
+		Status:          StatusApproved,
+		CustomerEmail:   authorization.CustomerEmail,
+		CustomerPhone:   authorization.CustomerPhone,
+		SystemGenerated: true,
+		MerchantID:      authorization.MerchantID,
+		BelongsToID:     &authorization.ID,
+	}
+}
+
 func (s *TransactionStore) buildTransactionRelations(ts []*Transaction) {
 	tm := make(map[uint]*Transaction, 0)
 	for i := range ts {
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTransactionQueryLimit = 50
+	MaxTransactionQueryLimit     = 500
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// TransactionSort is the order of transactions returned by TransactionStore.QueryTransactions.
+// Ties are broken by the transaction ID, so the order is stable across pages.
+type TransactionSort string
+
+const (
+	SortCreatedAtAsc  TransactionSort = "created_at"
+	SortCreatedAtDesc TransactionSort = "-created_at"
+	SortAmountAsc     TransactionSort = "amount"
+	SortAmountDesc    TransactionSort = "-amount"
+)
+
+func NewTransactionSort(s string) (TransactionSort, error) {
+	switch sort := TransactionSort(s); sort {
+	case "":
+		return SortCreatedAtDesc, nil
+	case SortCreatedAtAsc, SortCreatedAtDesc, SortAmountAsc, SortAmountDesc:
+		return sort, nil
+	default:
+		return "", fmt.Errorf("%q is not a valid sort order", s)
+	}
+}
+
+func (ts TransactionSort) column() string {
+	if ts == SortAmountAsc || ts == SortAmountDesc {
+		return "amount"
+	}
+	return "created_at"
+}
+
+func (ts TransactionSort) descending() bool {
+	return ts == SortCreatedAtDesc || ts == SortAmountDesc
+}
+
+// TransactionQuery filters, orders and paginates transactions.
+// Zero values of the filters mean that transactions are not filtered by them.
+type TransactionQuery struct {
+	MerchantEmail string
+	CustomerEmail string
+	Types         []TransactionType
+	Statuses      []TransactionStatus
+	CurrencyCode  CurrencyCode
+
+	// CreatedFrom is inclusive and CreatedTo is exclusive
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// MinAmount and MaxAmount are both inclusive
+	MinAmount *Currency
+	MaxAmount *Currency
+
+	Sort TransactionSort
+	// Cursor is the TransactionPage.NextCursor of the previous page or empty for the first page
+	Cursor string
+	Limit  int
+}
+
+// TransactionPage is a page of transactions. NextCursor is empty for the last page.
+type TransactionPage struct {
+	Transactions []*Transaction
+	NextCursor   string
+}
+
+type transactionCursor struct {
+	Sort      TransactionSort `json:"s"`
+	CreatedAt time.Time       `json:"c"`
+	Amount    Currency        `json:"a"`
+	ID        uint            `json:"i"`
+}
+
+func newTransactionCursor(sort TransactionSort, last *Transaction) string {
+	c := transactionCursor{Sort: sort, CreatedAt: last.CreatedAt, Amount: last.Amount, ID: last.ID}
+	// marshalling a struct of basic types cannot fail
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTransactionCursor(s string, sort TransactionSort) (*transactionCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &transactionCursor{}
+	if err := json.Unmarshal(b, c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (c *transactionCursor) value() any {
+	if c.Sort.column() == "amount" {
+		return c.Amount
+	}
+	return c.CreatedAt
+}
+
+// QueryTransactions returns a page of transactions matching q. All filtering is done by the DB.
+func (s *TransactionStore) QueryTransactions(ctx context.Context, q *TransactionQuery) (*TransactionPage, error) {
+	sort, err := NewTransactionSort(string(q.Sort))
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultTransactionQueryLimit
+	} else if limit > MaxTransactionQueryLimit {
+		limit = MaxTransactionQueryLimit
+	}
+
+	db := applyTransactionFilters(s.db.WithContext(ctx).Model(&Transaction{}), q)
+	direction, comparison := "ASC", ">"
+	if sort.descending() {
+		direction, comparison = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeTransactionCursor(q.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", sort.column(), comparison), cursor.value(), cursor.ID)
+	}
+
+	var ts []*Transaction
+	err = db.Order(fmt.Sprintf("%s %s, id %s", sort.column(), direction, direction)).
+		Limit(limit + 1).
+		Preload("Merchant").Preload("BelongsTo").
+		Find(&ts).Error
+	if err != nil {
+		return nil, fmt.Errorf("while querying transactions: %w", err)
+	}
+
+	page := &TransactionPage{Transactions: ts}
+	if len(ts) > limit {
+		page.Transactions = ts[:limit]
+		page.NextCursor = newTransactionCursor(sort, ts[limit-1])
+	}
+	return page, nil
+}
+
+func applyTransactionFilters(db *gorm.DB, q *TransactionQuery) *gorm.DB {
+	if q.MerchantEmail != "" {
+		db = db.Where("merchant_id IN (SELECT user_id FROM merchant WHERE email = ?)", q.MerchantEmail)
+	}
+	if q.CustomerEmail != "" {
+		db = db.Where("customer_email = ?", q.CustomerEmail)
+	}
+	if len(q.Types) > 0 {
+		db = db.Where("_type IN ?", q.Types)
+	}
+	if len(q.Statuses) > 0 {
+		db = db.Where("status IN ?", q.Statuses)
+	}
+	if q.CurrencyCode != "" {
+		db = db.Where("currency_code = ?", q.CurrencyCode)
+	}
+	if !q.CreatedFrom.IsZero() {
+		db = db.Where("created_at >= ?", q.CreatedFrom)
+	}
+	if !q.CreatedTo.IsZero() {
+		db = db.Where("created_at < ?", q.CreatedTo)
+	}
+	if q.MinAmount != nil {
+		db = db.Where("amount >= ?", *q.MinAmount)
+	}
+	if q.MaxAmount != nil {
+		db = db.Where("amount <= ?", *q.MaxAmount)
+	}
+	return db
+}
@@ -0,0 +1,144 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const QueryTestSchemaName = "payment_system_query_test"
+
+var _ = Describe("Using TransactionStore to query transactions", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		merchant         *models.Merchant
+		other            *models.Merchant
+		transactions     []*models.Transaction
+		err              error
+		create           = func(m *models.Merchant, amount float64, _type models.TransactionType, customerEmail string, belongsTo *models.Transaction) *models.Transaction {
+			return createTestTransaction(transactionStore, m, _type, models.StatusApproved, amount, customerEmail, "0889787878", belongsTo)
+		}
+		ids = func(ts []*models.Transaction) []uint {
+			res := make([]uint, len(ts))
+			for i := range ts {
+				res[i] = ts[i].ID
+			}
+			return res
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, QueryTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		merchant, err = models.NewMerchant("Query Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+		other, err = models.NewMerchant("Other Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), other)).To(Succeed())
+
+		authorize := create(merchant, 100, models.TypeAuthorize, "first@mail.bg", nil)
+		transactions = []*models.Transaction{
+			authorize,
+			create(merchant, 40, models.TypeCharge, "first@mail.bg", authorize),
+			create(merchant, 300, models.TypeCharge, "second@mail.bg", nil),
+			create(merchant, 20, models.TypeCharge, "second@mail.bg", nil),
+		}
+		create(other, 500, models.TypeCharge, "first@mail.bg", nil)
+	})
+
+	It("filters transactions in the DB", func() {
+		page, err := transactionStore.QueryTransactions(context.Background(), &models.TransactionQuery{MerchantEmail: merchant.Email})
+		Expect(err).To(BeNil())
+		Expect(page.NextCursor).To(BeEmpty())
+		Expect(ids(page.Transactions)).To(Equal([]uint{transactions[3].ID, transactions[2].ID, transactions[1].ID, transactions[0].ID}))
+		Expect(page.Transactions[2].BelongsTo.ID).To(Equal(transactions[0].ID))
+		Expect(page.Transactions[0].Merchant.Email).To(Equal(merchant.Email))
+
+		minAmount, maxAmount := models.ToCurrency(30), models.ToCurrency(300)
+		page, err = transactionStore.QueryTransactions(context.Background(), &models.TransactionQuery{
+			MerchantEmail: merchant.Email,
+			Types:         []models.TransactionType{models.TypeCharge},
+			MinAmount:     &minAmount,
+			MaxAmount:     &maxAmount,
+			Sort:          models.SortAmountAsc,
+		})
+		Expect(err).To(BeNil())
+		Expect(ids(page.Transactions)).To(Equal([]uint{transactions[1].ID, transactions[2].ID}))
+
+		page, err = transactionStore.QueryTransactions(context.Background(), &models.TransactionQuery{
+			MerchantEmail: merchant.Email,
+			CustomerEmail: "first@mail.bg",
+			Statuses:      []models.TransactionStatus{models.StatusPartiallyCaptured},
+		})
+		Expect(err).To(BeNil())
+		Expect(ids(page.Transactions)).To(Equal([]uint{transactions[0].ID}))
+
+		page, err = transactionStore.QueryTransactions(context.Background(), &models.TransactionQuery{
+			MerchantEmail: merchant.Email,
+			CreatedTo:     time.Now().Add(-time.Hour),
+		})
+		Expect(err).To(BeNil())
+		Expect(page.Transactions).To(BeEmpty())
+
+		page, err = transactionStore.QueryTransactions(context.Background(), &models.TransactionQuery{
+			MerchantEmail: merchant.Email,
+			CreatedFrom:   time.Now().Add(time.Hour),
+		})
+		Expect(err).To(BeNil())
+		Expect(page.Transactions).To(BeEmpty())
+	})
+
+	It("returns the whole chain of a transaction", func() {
+		refund := create(merchant, 10, models.TypeRefund, "first@mail.bg", transactions[1])
+
+		for _, t := range []*models.Transaction{transactions[0], refund} {
+			chain, err := transactionStore.GetTransactionChainByUUID(context.Background(), t.ExternalID, &merchant.UserID)
+			Expect(err).To(BeNil())
+			Expect(ids(chain)).To(Equal([]uint{transactions[0].ID, transactions[1].ID, refund.ID}))
+			Expect(chain[2].BelongsTo.ID).To(Equal(transactions[1].ID))
+			Expect(chain[0].Merchant.Email).To(Equal(merchant.Email))
+		}
+
+		chain, err := transactionStore.GetTransactionChainByUUID(context.Background(), transactions[2].ExternalID, nil)
+		Expect(err).To(BeNil())
+		Expect(ids(chain)).To(Equal([]uint{transactions[2].ID}))
+
+		_, err = transactionStore.GetTransactionChainByUUID(context.Background(), refund.ExternalID, &other.UserID)
+		Expect(err).To(MatchError(models.ErrTransactionNotFound))
+		_, err = transactionStore.GetTransactionChainByUUID(context.Background(), "not-a-uuid", nil)
+		Expect(err).To(MatchError(models.ErrTransactionNotFound))
+	})
+
+	It("paginates transactions with a cursor", func() {
+		query := &models.TransactionQuery{MerchantEmail: merchant.Email, Sort: models.SortAmountDesc, Limit: 3}
+		page, err := transactionStore.QueryTransactions(context.Background(), query)
+		Expect(err).To(BeNil())
+		Expect(ids(page.Transactions)).To(Equal([]uint{transactions[2].ID, transactions[0].ID, transactions[1].ID}))
+		Expect(page.NextCursor).NotTo(BeEmpty())
+
+		query.Cursor = page.NextCursor
+		page, err = transactionStore.QueryTransactions(context.Background(), query)
+		Expect(err).To(BeNil())
+		Expect(ids(page.Transactions)).To(Equal([]uint{transactions[3].ID}))
+		Expect(page.NextCursor).To(BeEmpty())
+
+		query.Sort = models.SortCreatedAtAsc
+		_, err = transactionStore.QueryTransactions(context.Background(), query)
+		Expect(err).To(MatchError(models.ErrInvalidCursor))
+
+		query.Cursor = "not a cursor"
+		_, err = transactionStore.QueryTransactions(context.Background(), query)
+		Expect(err).To(MatchError(models.ErrInvalidCursor))
+	})
+})
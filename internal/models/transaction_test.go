@@ -2,6 +2,7 @@ package models_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,24 +17,24 @@ const TransactionTestSchemaName = "payment_system_transaction_test"
 
 var _ = Describe("Using NewTransction", func() {
 	It("creates transaction without error for correct values", func() {
-		t1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
+		t1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
 		Expect(err).To(BeNil())
 
-		_, err = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, &t1.ID)
+		_, err = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, &t1.ID)
 		Expect(err).To(BeNil())
 	})
 	It("fails to create transaction when email is wrong", func() {
-		_, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "", "0888555885", 1, nil)
+		_, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "", "0888555885", 1, nil)
 		Expect(err).NotTo(BeNil())
 
-		_, err = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "www.google.com", "0888555885", 1, nil)
+		_, err = models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "www.google.com", "0888555885", 1, nil)
 		Expect(err).NotTo(BeNil())
 	})
 	It("fails to create transaction when uuid is wrong", func() {
-		_, err := models.NewTransaction("", models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
+		_, err := models.NewTransaction("", models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
 		Expect(err).NotTo(BeNil())
 
-		_, err = models.NewTransaction("123", models.ToCurrency(500), models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
+		_, err = models.NewTransaction("123", models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "test@yahoo.com", "0888555885", 1, nil)
 		Expect(err).NotTo(BeNil())
 	})
 })
@@ -69,13 +70,13 @@ var _ = Describe("Using TransactionStore", func() {
 
 	Context("to create get and delete transactions", func() {
 		It("works for Authorize -> Charge -> Refund flow", func() {
-			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
+			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction1)
 			Expect(err).To(BeNil())
 
-			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction2)
@@ -85,12 +86,13 @@ var _ = Describe("Using TransactionStore", func() {
 			Expect(err).To(BeNil())
 			compareTransactions([]*models.Transaction{transaction2}, []*models.Transaction{returnedTransaction2})
 
-			transaction3, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeRefund, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction2.ID)
+			transaction3, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeRefund, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction2.ID)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction3)
 			Expect(err).To(BeNil())
 
+			transaction1.Status = models.StatusCaptured
 			transaction2.Status = models.StatusRefunded
 			transactions, err := transactionStore.GetAllTransactions(context.Background())
 			Expect(err).To(BeNil())
@@ -109,13 +111,13 @@ var _ = Describe("Using TransactionStore", func() {
 		})
 
 		It("works for Authorize -> Reverse flow", func() {
-			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
+			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction1)
 			Expect(err).To(BeNil())
 
-			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeReversal, models.StatusReversed, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeReversal, models.StatusReversed, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction2)
@@ -134,6 +136,98 @@ var _ = Describe("Using TransactionStore", func() {
 			Expect(err).To(BeNil())
 		})
 
+		It("works for Authorize -> multiple partial Charges flow", func() {
+			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction1)
+			Expect(err).To(BeNil())
+
+			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(300), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction2)
+			Expect(err).To(BeNil())
+
+			returnedTransaction1, err := transactionStore.GetTransactionByUUID(context.Background(), transaction1.ExternalID)
+			Expect(err).To(BeNil())
+			Expect(returnedTransaction1.Status).To(Equal(models.StatusPartiallyCaptured))
+			Expect(returnedTransaction1.CapturedAmount).To(Equal(models.ToCurrency(300)))
+			Expect(returnedTransaction1.RemainingAuthorizedAmount()).To(Equal(models.ToCurrency(500)))
+
+			exceedingCharge, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(600), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), exceedingCharge)
+			Expect(errors.Is(err, models.ErrCaptureExceedsAuthorization)).To(BeTrue())
+
+			transaction3, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction3)
+			Expect(err).To(BeNil())
+
+			returnedTransaction1, err = transactionStore.GetTransactionByUUID(context.Background(), transaction1.ExternalID)
+			Expect(err).To(BeNil())
+			Expect(returnedTransaction1.Status).To(Equal(models.StatusCaptured))
+			Expect(returnedTransaction1.RemainingAuthorizedAmount()).To(BeZero())
+
+			err = transactionStore.DeleteTransaction(context.Background(), transaction1)
+			Expect(err).To(BeNil())
+		})
+
+		It("works for Charge -> multiple partial Refunds flow", func() {
+			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction1)
+			Expect(err).To(BeNil())
+
+			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction2)
+			Expect(err).To(BeNil())
+
+			transaction3, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(300), models.DefaultCurrencyCode, models.TypeRefund, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction2.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction3)
+			Expect(err).To(BeNil())
+
+			returnedTransaction2, err := transactionStore.GetTransactionByUUID(context.Background(), transaction2.ExternalID)
+			Expect(err).To(BeNil())
+			Expect(returnedTransaction2.Status).To(Equal(models.StatusPartiallyRefunded))
+			Expect(returnedTransaction2.RemainingRefundableAmount()).To(Equal(models.ToCurrency(500)))
+
+			returnedMerchant, err := merchantStore.GetMerchantById(context.Background(), merchant.UserID)
+			Expect(err).To(BeNil())
+			Expect(returnedMerchant.TotalTransactionSum[models.DefaultCurrencyCode]).To(BeEquivalentTo(models.ToCurrency(500)))
+
+			exceedingRefund, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(600), models.DefaultCurrencyCode, models.TypeRefund, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction2.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), exceedingRefund)
+			Expect(errors.Is(err, models.ErrRefundExceedsCharge)).To(BeTrue())
+
+			transaction4, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(500), models.DefaultCurrencyCode, models.TypeRefund, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction2.ID)
+			Expect(err).To(BeNil())
+
+			err = transactionStore.CreateTransaction(context.Background(), transaction4)
+			Expect(err).To(BeNil())
+
+			returnedTransaction2, err = transactionStore.GetTransactionByUUID(context.Background(), transaction2.ExternalID)
+			Expect(err).To(BeNil())
+			Expect(returnedTransaction2.Status).To(Equal(models.StatusRefunded))
+
+			returnedMerchant, err = merchantStore.GetMerchantById(context.Background(), merchant.UserID)
+			Expect(err).To(BeNil())
+			Expect(returnedMerchant.TotalTransactionSum[models.DefaultCurrencyCode]).To(BeZero())
+
+			err = transactionStore.DeleteTransaction(context.Background(), transaction1)
+			Expect(err).To(BeNil())
+		})
+
 		It("does not create transactions for inactive merchants", func() {
 			inactiveMerchant, err := models.NewMerchant("Merchant With Transactions", "Hello!", "inactive_merchant@gmail.com", models.StatusInactive)
 			Expect(err).To(BeNil())
@@ -141,7 +235,7 @@ var _ = Describe("Using TransactionStore", func() {
 			err = merchantStore.CreateMerchant(context.Background(), inactiveMerchant)
 			Expect(err).To(BeNil())
 
-			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, inactiveMerchant.UserID, nil)
+			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, inactiveMerchant.UserID, nil)
 			Expect(err).To(BeNil())
 
 			err = transactionStore.CreateTransaction(context.Background(), transaction1)
@@ -149,34 +243,51 @@ var _ = Describe("Using TransactionStore", func() {
 		})
 	})
 
-	Context("for periodic transactions deletion", func() {
-		It("deletes transactions", func() {
-			transaction1, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
+	Context("for authorization expiry", func() {
+		It("reverses approved authorizations older than the TTL", func() {
+			expired, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
 			Expect(err).To(BeNil())
-
-			err = transactionStore.CreateTransaction(context.Background(), transaction1)
+			err = transactionStore.CreateTransaction(context.Background(), expired)
 			Expect(err).To(BeNil())
 
-			transaction2, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &transaction1.ID)
+			charged, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(800), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, nil)
 			Expect(err).To(BeNil())
-
-			err = transactionStore.CreateTransaction(context.Background(), transaction2)
+			err = transactionStore.CreateTransaction(context.Background(), charged)
 			Expect(err).To(BeNil())
 
-			transactionDeleter := transactionStore.GetPeriodicJobDeleter(100*time.Millisecond, 100*time.Millisecond)
-			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-			DeferCleanup(cancel)
-
-			go transactionDeleter(ctx)
-			<-ctx.Done()
+			charge, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(300), models.DefaultCurrencyCode, models.TypeCharge, models.StatusApproved, customerEmail, customerPhone, merchant.UserID, &charged.ID)
+			Expect(err).To(BeNil())
+			err = transactionStore.CreateTransaction(context.Background(), charge)
+			Expect(err).To(BeNil())
 
-			//TODO: There is an issue causing the gormDB to use another schema. Fix it
-			_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, TransactionTestSchemaName))
+			err = transactionStore.ExpireAuthorizations(context.Background(), time.Now())
 			Expect(err).To(BeNil())
 
 			transactions, err := transactionStore.GetAllTransactions(context.Background())
 			Expect(err).To(BeNil())
-			Expect(transactions).To(BeEmpty())
+			Expect(transactions).To(HaveLen(4))
+			var reversal *models.Transaction
+			for _, t := range transactions {
+				switch t.ID {
+				case expired.ID:
+					Expect(t.Status).To(Equal(models.StatusReversed))
+				case charged.ID:
+					Expect(t.Status).To(Equal(models.StatusPartiallyCaptured))
+				case charge.ID:
+				default:
+					reversal = t
+				}
+			}
+			Expect(reversal).NotTo(BeNil())
+			Expect(reversal.Type).To(Equal(models.TypeReversal))
+			Expect(reversal.SystemGenerated).To(BeTrue())
+			Expect(*reversal.BelongsToID).To(Equal(expired.ID))
+			Expect(reversal.Amount).To(Equal(expired.Amount))
+
+			for _, t := range []*models.Transaction{reversal, charge, expired, charged} {
+				err = transactionStore.DeleteTransaction(context.Background(), t)
+				Expect(err).To(BeNil())
+			}
 		})
 	})
 })
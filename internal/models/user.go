@@ -56,6 +56,8 @@ type User struct {
 
 	Role   UserRole   `gorm:"column:_role;type:user_role"`
 	Status UserStatus `gorm:"type:user_status"`
+	// PasswordHash is the bcrypt hash of the password of the user or empty if no password is set
+	PasswordHash string
 }
 
 func NewUser(role UserRole, status UserStatus) *User {
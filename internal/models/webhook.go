@@ -0,0 +1,272 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "PENDING"
+	DeliverySucceeded DeliveryStatus = "SUCCEEDED"
+	DeliveryFailed    DeliveryStatus = "FAILED"
+)
+
+var (
+	// ErrWebhookEndpointNotFound is returned when a merchant has no webhook endpoint with the requested ID
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	// ErrWebhookDeliveryNotFound is returned when a merchant has no webhook delivery with the requested ID
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookEndpoint is a URL of a merchant which receives the merchant's events signed with Secret
+type WebhookEndpoint struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	MerchantID uint
+	URL        string `gorm:"column:url"`
+	Secret     string
+}
+
+// WebhookDelivery is the delivery of an event to a webhook endpoint
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	EventID    uint
+	Event      OutboxEvent
+	EndpointID uint
+	Endpoint   WebhookEndpoint
+
+	Status        DeliveryStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+
+	Log []WebhookDeliveryAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookDeliveryAttempt is an entry in the delivery log. ResponseStatus is 0 when no response was received.
+type WebhookDeliveryAttempt struct {
+	ID        uint      `gorm:"primaryKey;->"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	DeliveryID     uint
+	ResponseStatus int
+	Error          string
+}
+
+// RetryPolicy controls when failed deliveries are retried
+type RetryPolicy struct {
+	// BaseDelay is the delay after the first failed attempt, which doubles with every further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// MaxAttempts is the number of attempts after which a delivery fails
+	MaxAttempts int
+}
+
+// Backoff returns the delay before the next attempt after attempts failed attempts
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+type WebhookStore struct {
+	db *gorm.DB
+}
+
+func NewWebhookStore(db *gorm.DB) *WebhookStore {
+	return &WebhookStore{db: db}
+}
+
+// CreateEndpoint registers url as a webhook endpoint of the merchant with merchantEmail
+func (s *WebhookStore) CreateEndpoint(ctx context.Context, merchantEmail, url string) (*WebhookEndpoint, error) {
+	m := Merchant{}
+	res := s.db.WithContext(ctx).Model(&Merchant{}).Where("email = ?", strings.ToLower(merchantEmail)).First(&m)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrMerchantNotFound
+	} else if err := res.Error; err != nil {
+		return nil, fmt.Errorf("while getting merchant of webhook endpoint: %w", err)
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, fmt.Errorf("while generating webhook secret: %w", err)
+	}
+	e := &WebhookEndpoint{MerchantID: m.UserID, URL: url, Secret: secret}
+	if err := s.db.WithContext(ctx).Create(e).Error; err != nil {
+		return nil, fmt.Errorf("while creating webhook endpoint: %w", err)
+	}
+	return e, nil
+}
+
+// GetEndpoints returns the webhook endpoints of the merchant with merchantEmail
+func (s *WebhookStore) GetEndpoints(ctx context.Context, merchantEmail string) ([]*WebhookEndpoint, error) {
+	var es []*WebhookEndpoint
+	err := s.db.WithContext(ctx).
+		Where("merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", strings.ToLower(merchantEmail)).
+		Order("id").Find(&es).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting webhook endpoints: %w", err)
+	}
+	return es, nil
+}
+
+// DeleteEndpoint deletes the webhook endpoint with id of the merchant with merchantEmail together with its deliveries
+func (s *WebhookStore) DeleteEndpoint(ctx context.Context, merchantEmail string, id uint) error {
+	res := s.db.WithContext(ctx).
+		Where("id = ? AND merchant_id = (SELECT user_id FROM merchant WHERE email = ?)", id, strings.ToLower(merchantEmail)).
+		Delete(&WebhookEndpoint{})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while deleting webhook endpoint: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// GetDeliveries returns the latest limit deliveries to the webhook endpoints of the merchant with merchantEmail together with their log
+func (s *WebhookStore) GetDeliveries(ctx context.Context, merchantEmail string, limit int) ([]*WebhookDelivery, error) {
+	var ds []*WebhookDelivery
+	err := s.db.WithContext(ctx).
+		Joins("Endpoint").Joins("Event").
+		Preload("Log", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where(`"Endpoint".merchant_id = (SELECT user_id FROM merchant WHERE email = ?)`, strings.ToLower(merchantEmail)).
+		Order("webhook_delivery.id DESC").Limit(limit).
+		Find(&ds).Error
+	if err != nil {
+		return nil, fmt.Errorf("while getting webhook deliveries: %w", err)
+	}
+	return ds, nil
+}
+
+// Redeliver schedules the delivery with id of the merchant with merchantEmail to be attempted again right away,
+// regardless of its status. The attempts made so far remain in its log.
+func (s *WebhookStore) Redeliver(ctx context.Context, merchantEmail string, id uint) error {
+	res := s.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("id = ? AND endpoint_id IN (SELECT id FROM webhook_endpoint WHERE merchant_id = (SELECT user_id FROM merchant WHERE email = ?))", id, strings.ToLower(merchantEmail)).
+		Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("while scheduling redelivery: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// DispatchEvents creates a delivery to every webhook endpoint of the merchant for up to limit events
+// which have not been dispatched yet. It returns the number of dispatched events.
+func (s *WebhookStore) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	var dispatched int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []*OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, e := range events {
+			var endpointIDs []uint
+			if err := tx.Model(&WebhookEndpoint{}).Where("merchant_id = ?", e.MerchantID).Order("id").Pluck("id", &endpointIDs).Error; err != nil {
+				return err
+			}
+			for _, endpointID := range endpointIDs {
+				d := &WebhookDelivery{EventID: e.ID, EndpointID: endpointID, Status: DeliveryPending, NextAttemptAt: now}
+				if err := tx.Omit(clause.Associations).Create(d).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(e).Update("dispatched_at", now).Error; err != nil {
+				return err
+			}
+		}
+		dispatched = len(events)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("while dispatching events: %w", err)
+	}
+	return dispatched, nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next attempt is due. The next attempt
+// of the returned deliveries is postponed by lease, so that they are not claimed again while being delivered.
+func (s *WebhookStore) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	var ds []*WebhookDelivery
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var ids []uint
+		err := tx.Model(&WebhookDelivery{}).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at").Limit(limit).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return err
+		}
+		return tx.Preload("Event").Preload("Endpoint").Where("id IN ?", ids).Order("id").Find(&ds).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while claiming due webhook deliveries: %w", err)
+	}
+	return ds, nil
+}
+
+// RecordAttempt adds an attempt to the log of d and schedules its next attempt according to policy.
+// A non-nil attemptErr means that the attempt failed.
+func (s *WebhookStore) RecordAttempt(ctx context.Context, d *WebhookDelivery, responseStatus int, attemptErr error, policy RetryPolicy) error {
+	attempt := &WebhookDeliveryAttempt{DeliveryID: d.ID, ResponseStatus: responseStatus}
+	if attemptErr != nil {
+		attempt.Error = attemptErr.Error()
+	}
+	now := time.Now()
+	d.Attempts++
+	switch {
+	case attemptErr == nil:
+		d.Status, d.DeliveredAt = DeliverySucceeded, &now
+	case d.Attempts >= policy.MaxAttempts:
+		d.Status = DeliveryFailed
+	default:
+		d.NextAttemptAt = now.Add(policy.Backoff(d.Attempts))
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"next_attempt_at": d.NextAttemptAt,
+			"delivered_at":    d.DeliveredAt,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("while recording webhook delivery attempt: %w", err)
+	}
+	return nil
+}
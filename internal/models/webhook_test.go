@@ -0,0 +1,141 @@
+package models_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/krasish/payment-system/internal/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const WebhookTestSchemaName = "payment_system_webhook_test"
+
+var _ = Describe("Using RetryPolicy", func() {
+	It("backs off exponentially up to the maximum delay", func() {
+		policy := models.RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, MaxAttempts: 5}
+		Expect(policy.Backoff(1)).To(Equal(time.Second))
+		Expect(policy.Backoff(2)).To(Equal(2 * time.Second))
+		Expect(policy.Backoff(3)).To(Equal(4 * time.Second))
+		Expect(policy.Backoff(10)).To(Equal(10 * time.Second))
+	})
+})
+
+var _ = Describe("Using WebhookStore", func() {
+	var (
+		merchantStore    *models.MerchantStore
+		transactionStore *models.TransactionStore
+		webhookStore     *models.WebhookStore
+		merchant         *models.Merchant
+		endpoint         *models.WebhookEndpoint
+		policy           = models.RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour, MaxAttempts: 2}
+		err              error
+		deliveries       = func() []*models.WebhookDelivery {
+			_, err := webhookStore.DispatchEvents(context.Background(), 1000)
+			Expect(err).To(BeNil())
+			ds, err := webhookStore.GetDeliveries(context.Background(), merchant.Email, 100)
+			Expect(err).To(BeNil())
+			return ds
+		}
+		claim = func(id uint) *models.WebhookDelivery {
+			ds, err := webhookStore.ClaimDueDeliveries(context.Background(), 1000, time.Minute)
+			Expect(err).To(BeNil())
+			for _, d := range ds {
+				if d.ID == id {
+					return d
+				}
+			}
+			return nil
+		}
+	)
+
+	BeforeEach(func() {
+		_, err = sqlDB.Exec(fmt.Sprintf(SetSearchPathStatementFormat, WebhookTestSchemaName))
+		Expect(err).To(BeNil())
+
+		merchantStore = models.NewMerchantStore(gormDB)
+		transactionStore = models.NewTransactionStore(gormDB)
+		webhookStore = models.NewWebhookStore(gormDB)
+		merchant, err = models.NewMerchant("Webhook Merchant", "Hello!", uuid.Generate().String()+"@abv.bg", models.StatusActive)
+		Expect(err).To(BeNil())
+		Expect(merchantStore.CreateMerchant(context.Background(), merchant)).To(Succeed())
+		endpoint, err = webhookStore.CreateEndpoint(context.Background(), merchant.Email, "https://example.com/hook")
+		Expect(err).To(BeNil())
+		Expect(endpoint.Secret).NotTo(BeEmpty())
+	})
+
+	It("writes events of transactions and merchants to the outbox", func() {
+		authorize, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(10), models.DefaultCurrencyCode, models.TypeAuthorize, models.StatusApproved, "wh@mail.bg", "0889787878", merchant.UserID, nil)
+		Expect(err).To(BeNil())
+		Expect(transactionStore.CreateTransaction(context.Background(), authorize)).To(Succeed())
+		reversal, err := models.NewTransaction(uuid.Generate().String(), models.ToCurrency(10), models.DefaultCurrencyCode, models.TypeReversal, models.StatusApproved, "wh@mail.bg", "0889787878", merchant.UserID, &authorize.ID)
+		Expect(err).To(BeNil())
+		Expect(transactionStore.CreateTransaction(context.Background(), reversal)).To(Succeed())
+		Expect(merchantStore.UpdateMerchantStatus(context.Background(), merchant.Email, models.StatusInactive)).To(Succeed())
+
+		ds := deliveries()
+		types := make([]models.EventType, len(ds))
+		for i, d := range ds {
+			types[i] = d.Event.Type
+			Expect(d.EndpointID).To(Equal(endpoint.ID))
+			Expect(d.Status).To(Equal(models.DeliveryPending))
+		}
+		Expect(types).To(Equal([]models.EventType{
+			models.EventMerchantUpdated,
+			models.EventTransactionStatusChanged,
+			models.EventTransactionCreated,
+			models.EventTransactionCreated,
+		}))
+
+		e := struct {
+			Type models.EventType
+			Data models.TransactionEventData
+		}{}
+		Expect(json.Unmarshal([]byte(ds[1].Event.Payload), &e)).To(Succeed())
+		Expect(e.Data.UUID).To(Equal(authorize.ExternalID))
+		Expect(e.Data.Status).To(Equal(models.StatusReversed))
+		Expect(e.Data.PreviousStatus).To(Equal(models.StatusApproved))
+	})
+
+	It("retries failed deliveries and redelivers them on request", func() {
+		Expect(merchantStore.UpdateMerchant(context.Background(), merchant)).To(Succeed())
+		ds := deliveries()
+		Expect(ds).To(HaveLen(1))
+
+		d := claim(ds[0].ID)
+		Expect(d).NotTo(BeNil())
+		Expect(claim(d.ID)).To(BeNil())
+		Expect(webhookStore.RecordAttempt(context.Background(), d, 500, errors.New("endpoint responded with status 500"), policy)).To(Succeed())
+		Expect(d.Status).To(Equal(models.DeliveryPending))
+		Expect(d.NextAttemptAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		Expect(webhookStore.RecordAttempt(context.Background(), d, 0, errors.New("timeout"), policy)).To(Succeed())
+		Expect(d.Status).To(Equal(models.DeliveryFailed))
+
+		Expect(webhookStore.Redeliver(context.Background(), merchant.Email, d.ID)).To(Succeed())
+		d = claim(d.ID)
+		Expect(d).NotTo(BeNil())
+		Expect(webhookStore.RecordAttempt(context.Background(), d, 200, nil, policy)).To(Succeed())
+
+		ds = deliveries()
+		Expect(ds[0].Status).To(Equal(models.DeliverySucceeded))
+		Expect(ds[0].DeliveredAt).NotTo(BeNil())
+		Expect(ds[0].Log).To(HaveLen(3))
+		Expect(ds[0].Log[0].ResponseStatus).To(Equal(500))
+
+		Expect(webhookStore.Redeliver(context.Background(), "other@abv.bg", d.ID)).To(MatchError(models.ErrWebhookDeliveryNotFound))
+	})
+
+	It("deletes endpoints", func() {
+		Expect(webhookStore.DeleteEndpoint(context.Background(), merchant.Email, endpoint.ID)).To(Succeed())
+		Expect(webhookStore.DeleteEndpoint(context.Background(), merchant.Email, endpoint.ID)).To(MatchError(models.ErrWebhookEndpointNotFound))
+		endpoints, err := webhookStore.GetEndpoints(context.Background(), merchant.Email)
+		Expect(err).To(BeNil())
+		Expect(endpoints).To(BeEmpty())
+	})
+})
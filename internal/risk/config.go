@@ -0,0 +1,130 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+const (
+	RuleTypeAmount             = "AMOUNT"
+	RuleTypeVelocity           = "VELOCITY"
+	RuleTypeBlocklist          = "BLOCKLIST"
+	RuleTypeMismatchedCustomer = "MISMATCHED_CUSTOMER"
+)
+
+// ErrInvalidRule is returned when a rule in the rules file cannot be built
+var ErrInvalidRule = errors.New("invalid risk rule")
+
+// RuleConfig is a rule in the rules file. Which fields are used depends on Type:
+//   - AMOUNT uses MaxAmount in Currency
+//   - VELOCITY uses Key (EMAIL or PHONE), Window and MaxCount
+//   - BLOCKLIST uses Emails, Domains and Phones
+//   - MISMATCHED_CUSTOMER uses Window
+//
+// Window is a duration like "24h" and Decision is either REVIEW or DECLINE.
+type RuleConfig struct {
+	ID       string
+	Type     string
+	Decision string
+
+	MaxAmount float64
+	Currency  string
+
+	Key      string
+	Window   string
+	MaxCount int64
+
+	Emails  []string
+	Domains []string
+	Phones  []string
+}
+
+// RulesFile is the JSON file the rules of the engine are configured in
+type RulesFile struct {
+	Rules []RuleConfig
+}
+
+// NewEngineFromFile returns an engine with the rules configured in the file at path or an engine without rules if path is empty
+func NewEngineFromFile(path string, history History) (*Engine, error) {
+	if path == "" {
+		return NewEngine(), nil
+	}
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("while reading risk rules from %q: %w", path, err)
+	}
+	file := RulesFile{}
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("while parsing risk rules from %q: %w", path, err)
+	}
+	rules := make([]Rule, 0, len(file.Rules))
+	ids := make(map[string]bool, len(file.Rules))
+	for _, c := range file.Rules {
+		if ids[c.ID] {
+			return nil, fmt.Errorf("%w: rule ID %q is not unique", ErrInvalidRule, c.ID)
+		}
+		ids[c.ID] = true
+		rule, err := c.build(history)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return NewEngine(rules...), nil
+}
+
+func (c *RuleConfig) build(history History) (Rule, error) {
+	if c.ID == "" {
+		return nil, fmt.Errorf("%w: rules must have an ID", ErrInvalidRule)
+	}
+	decision, err := models.NewRiskDecision(strings.ToUpper(c.Decision))
+	if err != nil || decision == models.RiskApprove {
+		return nil, fmt.Errorf("%w: decision of rule %s must be either REVIEW or DECLINE", ErrInvalidRule, c.ID)
+	}
+	switch strings.ToUpper(c.Type) {
+	case RuleTypeAmount:
+		currencyCode, err := models.NewCurrencyCode(c.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %s: %v", ErrInvalidRule, c.ID, err)
+		}
+		return NewAmountRule(c.ID, decision, currencyCode.ToCurrency(c.MaxAmount), currencyCode), nil
+	case RuleTypeVelocity:
+		key := CustomerKey(strings.ToUpper(c.Key))
+		if key != KeyEmail && key != KeyPhone {
+			return nil, fmt.Errorf("%w: key of rule %s must be either EMAIL or PHONE", ErrInvalidRule, c.ID)
+		}
+		window, err := c.window()
+		if err != nil {
+			return nil, err
+		}
+		if c.MaxCount < 1 {
+			return nil, fmt.Errorf("%w: max count of rule %s must be positive", ErrInvalidRule, c.ID)
+		}
+		return NewVelocityRule(c.ID, decision, history, key, window, c.MaxCount), nil
+	case RuleTypeBlocklist:
+		return NewBlocklistRule(c.ID, decision, c.Emails, c.Domains, c.Phones), nil
+	case RuleTypeMismatchedCustomer:
+		window, err := c.window()
+		if err != nil {
+			return nil, err
+		}
+		return NewMismatchedCustomerRule(c.ID, decision, history, window), nil
+	default:
+		return nil, fmt.Errorf("%w: rule %s has unknown type %q", ErrInvalidRule, c.ID, c.Type)
+	}
+}
+
+func (c *RuleConfig) window() (time.Duration, error) {
+	window, err := time.ParseDuration(c.Window)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("%w: window of rule %s must be a positive duration", ErrInvalidRule, c.ID)
+	}
+	return window, nil
+}
@@ -0,0 +1,48 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// Rule is a check of a transaction which is about to be created
+type Rule interface {
+	// ID identifies the rule in the stored risk reasons of transactions
+	ID() string
+	// Evaluate returns whether the rule fires for t and the reason it does
+	Evaluate(ctx context.Context, t *models.Transaction) (fired bool, reason string, err error)
+	// Decision is the decision made when the rule fires
+	Decision() models.RiskDecision
+}
+
+// Engine assesses the risk of transactions with its rules. The most restrictive decision of
+// all rules which fire is the decision of the engine, so any declining rule declines a transaction.
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine returns an engine evaluating rules in order. An engine without rules approves all transactions.
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Assess evaluates all rules for t. Transactions belonging to another transaction are not assessed,
+// since the transaction they belong to was assessed when it was created.
+func (e *Engine) Assess(ctx context.Context, t *models.Transaction) (*models.RiskAssessment, error) {
+	a := &models.RiskAssessment{Decision: models.RiskApprove}
+	if t.BelongsToID != nil {
+		return a, nil
+	}
+	for _, rule := range e.rules {
+		fired, reason, err := rule.Evaluate(ctx, t)
+		if err != nil {
+			return nil, fmt.Errorf("while evaluating risk rule %s: %w", rule.ID(), err)
+		}
+		if fired {
+			a.Add(rule.ID(), rule.Decision(), reason)
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,147 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/krasish/payment-system/internal/models"
+)
+
+// History provides the recent transactions of customers, see models.RiskStore
+type History interface {
+	CountCustomerTransactions(ctx context.Context, merchantID uint, email, phone string, since time.Time) (int64, error)
+	CountMismatchedCustomerTransactions(ctx context.Context, merchantID uint, email, phone string, since time.Time) (int64, error)
+}
+
+type baseRule struct {
+	id       string
+	decision models.RiskDecision
+}
+
+func (r baseRule) ID() string {
+	return r.id
+}
+
+func (r baseRule) Decision() models.RiskDecision {
+	return r.decision
+}
+
+// AmountRule fires for transactions in Currency with an amount above MaxAmount
+type AmountRule struct {
+	baseRule
+	maxAmount    models.Currency
+	currencyCode models.CurrencyCode
+}
+
+func NewAmountRule(id string, decision models.RiskDecision, maxAmount models.Currency, currencyCode models.CurrencyCode) *AmountRule {
+	return &AmountRule{baseRule: baseRule{id: id, decision: decision}, maxAmount: maxAmount, currencyCode: currencyCode}
+}
+
+func (r *AmountRule) Evaluate(_ context.Context, t *models.Transaction) (bool, string, error) {
+	if t.CurrencyCode != r.currencyCode || t.Amount <= r.maxAmount {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("amount %s exceeds %s", t.CurrencyCode.Format(t.Amount), r.currencyCode.Format(r.maxAmount)), nil
+}
+
+// CustomerKey is the customer data velocity is measured by
+type CustomerKey string
+
+const (
+	KeyEmail CustomerKey = "EMAIL"
+	KeyPhone CustomerKey = "PHONE"
+)
+
+// VelocityRule fires when a customer, identified by its email or phone, already has maxCount transactions
+// with the merchant within window
+type VelocityRule struct {
+	baseRule
+	history  History
+	key      CustomerKey
+	window   time.Duration
+	maxCount int64
+}
+
+func NewVelocityRule(id string, decision models.RiskDecision, history History, key CustomerKey, window time.Duration, maxCount int64) *VelocityRule {
+	return &VelocityRule{baseRule: baseRule{id: id, decision: decision}, history: history, key: key, window: window, maxCount: maxCount}
+}
+
+func (r *VelocityRule) Evaluate(ctx context.Context, t *models.Transaction) (bool, string, error) {
+	var email, phone, value string
+	if r.key == KeyPhone {
+		phone, value = t.CustomerPhone, t.CustomerPhone
+	} else {
+		email, value = t.CustomerEmail, t.CustomerEmail
+	}
+	count, err := r.history.CountCustomerTransactions(ctx, t.MerchantID, email, phone, time.Now().Add(-r.window))
+	if err != nil || count < r.maxCount {
+		return false, "", err
+	}
+	return true, fmt.Sprintf("%s has %d transactions within %s", value, count, r.window), nil
+}
+
+// BlocklistRule fires for customers with a blocked email, email domain or phone
+type BlocklistRule struct {
+	baseRule
+	emails  map[string]bool
+	domains map[string]bool
+	phones  map[string]bool
+}
+
+func NewBlocklistRule(id string, decision models.RiskDecision, emails, domains, phones []string) *BlocklistRule {
+	return &BlocklistRule{baseRule: baseRule{id: id, decision: decision}, emails: toSet(emails, strings.ToLower), domains: toSet(domains, strings.ToLower), phones: toSet(phones, normalizePhone)}
+}
+
+func (r *BlocklistRule) Evaluate(_ context.Context, t *models.Transaction) (bool, string, error) {
+	email := strings.ToLower(t.CustomerEmail)
+	switch {
+	case r.emails[email]:
+		return true, fmt.Sprintf("email %s is blocked", email), nil
+	case r.domains[email[strings.LastIndex(email, "@")+1:]]:
+		return true, fmt.Sprintf("email domain of %s is blocked", email), nil
+	case r.phones[normalizePhone(t.CustomerPhone)]:
+		return true, fmt.Sprintf("phone %s is blocked", t.CustomerPhone), nil
+	default:
+		return false, "", nil
+	}
+}
+
+// MismatchedCustomerRule fires when the email of a customer has been used with another phone or
+// its phone has been used with another email within window
+type MismatchedCustomerRule struct {
+	baseRule
+	history History
+	window  time.Duration
+}
+
+func NewMismatchedCustomerRule(id string, decision models.RiskDecision, history History, window time.Duration) *MismatchedCustomerRule {
+	return &MismatchedCustomerRule{baseRule: baseRule{id: id, decision: decision}, history: history, window: window}
+}
+
+func (r *MismatchedCustomerRule) Evaluate(ctx context.Context, t *models.Transaction) (bool, string, error) {
+	count, err := r.history.CountMismatchedCustomerTransactions(ctx, t.MerchantID, t.CustomerEmail, t.CustomerPhone, time.Now().Add(-r.window))
+	if err != nil || count == 0 {
+		return false, "", err
+	}
+	return true, fmt.Sprintf("%s or %s has been used with other customer data %d times", t.CustomerEmail, t.CustomerPhone, count), nil
+}
+
+func toSet(values []string, normalize func(string) string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v = normalize(strings.TrimSpace(v)); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// normalizePhone returns phone in E.164 format, so that differently formatted numbers match
+func normalizePhone(phone string) string {
+	if normalized, err := models.NormalizePhone(phone); err == nil {
+		return normalized
+	}
+	return phone
+}
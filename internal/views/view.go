@@ -9,20 +9,22 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/krasish/payment-system/internal/controllers"
+	"github.com/krasish/payment-system/internal/models"
 )
 
 type Merchant struct {
 	*controllers.Merchant
 	Transactions []*controllers.Transaction
+	Disputes     []*controllers.Dispute
 }
 
 func NewMerchant(merchant *controllers.Merchant) *Merchant {
-	return &Merchant{Merchant: merchant, Transactions: make([]*controllers.Transaction, 0)}
+	return &Merchant{Merchant: merchant, Transactions: make([]*controllers.Transaction, 0), Disputes: make([]*controllers.Dispute, 0)}
 }
 
 type MerchantsData map[string]*Merchant
 
-func NewMerchantsData(merchants []*controllers.Merchant, transactions []*controllers.Transaction) MerchantsData {
+func NewMerchantsData(merchants []*controllers.Merchant, transactions []*controllers.Transaction, disputes []*controllers.Dispute) MerchantsData {
 	md := make(MerchantsData, len(merchants))
 	for i, merchant := range merchants {
 		md[merchant.Email] = NewMerchant(merchants[i])
@@ -30,6 +32,9 @@ func NewMerchantsData(merchants []*controllers.Merchant, transactions []*control
 	for i, transaction := range transactions {
 		md[transaction.MerchantEmail].Transactions = append(md[transaction.MerchantEmail].Transactions, transactions[i])
 	}
+	for i, dispute := range disputes {
+		md[dispute.MerchantEmail].Disputes = append(md[dispute.MerchantEmail].Disputes, disputes[i])
+	}
 	return md
 }
 
@@ -44,7 +49,7 @@ func NewView(layout, templatesDir string) (*View, error) {
 		logrus.Errorf("while opening files with templates: %v", err)
 		return nil, fmt.Errorf("while opening files with templates: %w", err)
 	}
-	tpl, err := template.ParseFiles(files...)
+	tpl, err := template.New("views").Funcs(template.FuncMap{"formatAmount": formatAmount}).ParseFiles(files...)
 	if err != nil {
 		logrus.Errorf("while parsing file tempaltes: %v", err)
 		return nil, fmt.Errorf("while parsing file tempaltes: %w", err)
@@ -52,6 +57,19 @@ func NewView(layout, templatesDir string) (*View, error) {
 	return &View{Template: tpl, Layout: layout}, nil
 }
 
+// formatAmount formats an amount using the decimal places of its currency.
+// Amounts can be negative, e.g. totals of merchants with chargebacks.
+func formatAmount(amount float64, currency string) string {
+	currencyCode, err := models.NewCurrencyCode(currency)
+	if err != nil {
+		return fmt.Sprintf("%v %s", amount, currency)
+	}
+	if amount < 0 {
+		return "-" + currencyCode.Format(currencyCode.ToCurrency(-amount))
+	}
+	return currencyCode.Format(currencyCode.ToCurrency(amount))
+}
+
 func (v *View) Render(w http.ResponseWriter, merchants MerchantsData) error {
 	return v.Template.ExecuteTemplate(w, v.Layout, merchants)
 }
@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for webhook endpoints which are, or resolve to, addresses of the
+// internal network, so that merchants cannot make the application send requests to internal services
+var ErrForbiddenAddress = errors.New("webhook endpoints cannot be on loopback, link-local, private or unspecified addresses")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which is not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkIP returns ErrForbiddenAddress unless ip is a public unicast address
+func checkIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%s: %w", ip, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// CheckEndpointHost returns ErrForbiddenAddress if host is, or resolves to, an address of the internal network
+func CheckEndpointHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("while resolving %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialControl rejects connections to the internal network. It is called with the resolved address of
+// every connection, so endpoints whose names are changed to resolve to internal addresses are rejected too.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s is not an IP address", host)
+	}
+	return checkIP(ip)
+}
+
+// newClient returns the client webhooks are delivered with. It connects only to public addresses,
+// without any proxy, and does not follow redirects, which are reported as failed deliveries instead.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
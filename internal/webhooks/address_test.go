@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckIP(t *testing.T) {
+	for ip, forbidden := range map[string]bool{
+		"127.0.0.1":       true,
+		"::1":             true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"fe80::1":         true,
+		"fc00::1":         true,
+		"0.0.0.0":         true,
+		"100.64.0.1":      true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	} {
+		err := checkIP(net.ParseIP(ip))
+		if got := errors.Is(err, ErrForbiddenAddress); got != forbidden {
+			t.Errorf("checkIP(%s) = %v, forbidden: %v", ip, err, forbidden)
+		}
+	}
+}
+
+func TestCheckEndpointHost(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "::1", "localhost"} {
+		if err := CheckEndpointHost(context.Background(), host); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckEndpointHost(%s) = %v, expected %v", host, err, ErrForbiddenAddress)
+		}
+	}
+}
+
+func TestClientRejectsInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := newClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("expected %v when requesting %s, got %v", ErrForbiddenAddress, server.URL, err)
+	}
+}
@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/krasish/payment-system/internal/common"
+	"github.com/krasish/payment-system/internal/models"
+)
+
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventTypeHeader = "X-Event-Type"
+	// SignatureHeader carries the signature of an event in the t=<unix timestamp>,v1=<hex HMAC-SHA256> format
+	SignatureHeader = "X-Signature"
+
+	// batchSize is the maximum number of events dispatched and deliveries attempted by a single run
+	batchSize = 100
+	// maxResponseBodySize is the maximum number of bytes read from the responses of webhook endpoints
+	maxResponseBodySize = 4096
+)
+
+// Deliverer dispatches the events in the outbox to the webhook endpoints of their merchants
+// and delivers them, retrying failed deliveries according to its retry policy.
+type Deliverer struct {
+	store   *models.WebhookStore
+	policy  models.RetryPolicy
+	client  *http.Client
+	timeout time.Duration
+}
+
+func NewDeliverer(store *models.WebhookStore, policy models.RetryPolicy, timeout time.Duration) *Deliverer {
+	return &Deliverer{store: store, policy: policy, client: newClient(timeout), timeout: timeout}
+}
+
+// GetPeriodicJobDeliverer returns a job which dispatches and delivers events every jobExecutionInterval
+func (d *Deliverer) GetPeriodicJobDeliverer(jobExecutionInterval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(jobExecutionInterval)
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.Deliver(ctx); err != nil {
+					logrus.Warnf("periodic webhook delivery job failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Deliver dispatches new events and attempts the deliveries which are due
+func (d *Deliverer) Deliver(ctx context.Context) error {
+	if _, err := d.store.DispatchEvents(ctx, batchSize); err != nil {
+		return err
+	}
+	// deliveries are claimed for longer than an attempt can take, so that they are not attempted twice
+	deliveries, err := d.store.ClaimDueDeliveries(ctx, batchSize, 2*d.timeout*batchSize)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		status, attemptErr := d.attempt(ctx, delivery)
+		if err := d.store.RecordAttempt(ctx, delivery, status, attemptErr, d.policy); err != nil {
+			return err
+		}
+		if attemptErr != nil {
+			logrus.Infof("delivery %d of event %s to %s failed: %v", delivery.ID, delivery.Event.ExternalID, delivery.Endpoint.URL, attemptErr)
+		}
+	}
+	return nil
+}
+
+// attempt posts the event of delivery to its endpoint. It returns the response status, if any, and
+// an error unless the endpoint responded with a 2xx status.
+func (d *Deliverer) attempt(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Event.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("while creating request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, delivery.Event.ExternalID)
+	req.Header.Set(EventTypeHeader, string(delivery.Event.Type))
+	req.Header.Set(SignatureHeader, "t="+strconv.FormatInt(timestamp, 10)+",v1="+common.ComputeSignature(delivery.Endpoint.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer common.CloseWithLogOnError(resp.Body)
+	// the body is read so that the connection can be reused
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize)); err != nil {
+		logrus.Debugf("could not read response of webhook endpoint %s: %v", delivery.Endpoint.URL, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Idempotency key
+CREATE TABLE idempotency_key(
+                                id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                                merchant_id BIGINT NOT NULL,
+                                transaction_id BIGINT NULL,
+                                _key VARCHAR(255) NOT NULL,
+
+                                request_hash VARCHAR(64) NOT NULL,
+                                response_status INTEGER NOT NULL,
+                                response_body BYTEA NOT NULL
+);
+ALTER TABLE idempotency_key ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX idempotency_key_merchant_id_key_unique ON idempotency_key USING btree(merchant_id, _key);
+
+ALTER TABLE idempotency_key ADD CONSTRAINT idempotency_key_merchant_id_foreign FOREIGN KEY(merchant_id) REFERENCES merchant(user_id) ON DELETE CASCADE;
+ALTER TABLE idempotency_key ADD CONSTRAINT idempotency_key_transaction_id_foreign FOREIGN KEY(transaction_id) REFERENCES transaction(id) ON DELETE SET NULL;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE transaction DROP COLUMN IF EXISTS captured_amount;
+
+COMMIT;
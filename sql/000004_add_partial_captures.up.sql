@@ -0,0 +1,21 @@
+BEGIN;
+
+ALTER TYPE transaction_status ADD VALUE 'PARTIALLY_CAPTURED';
+ALTER TYPE transaction_status ADD VALUE 'CAPTURED';
+
+COMMIT;
+
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN captured_amount BIGINT NOT NULL DEFAULT 0;
+
+UPDATE transaction a
+SET captured_amount = c.total,
+    status = CASE WHEN c.total >= a.amount THEN 'CAPTURED'::transaction_status ELSE 'PARTIALLY_CAPTURED'::transaction_status END
+FROM (SELECT belongs_to, SUM(amount) AS total
+      FROM transaction
+      WHERE _type = 'CHARGE' AND status <> 'ERROR' AND belongs_to IS NOT NULL
+      GROUP BY belongs_to) c
+WHERE a.id = c.belongs_to AND a._type = 'AUTHORIZE' AND a.status = 'APPROVED';
+
+COMMIT;
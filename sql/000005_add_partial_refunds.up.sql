@@ -0,0 +1,20 @@
+BEGIN;
+
+ALTER TYPE transaction_status ADD VALUE 'PARTIALLY_REFUNDED';
+
+COMMIT;
+
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN refunded_amount BIGINT NOT NULL DEFAULT 0;
+
+UPDATE transaction c
+SET refunded_amount = r.total,
+    status = CASE WHEN r.total >= c.amount THEN 'REFUNDED'::transaction_status ELSE 'PARTIALLY_REFUNDED'::transaction_status END
+FROM (SELECT belongs_to, SUM(amount) AS total
+      FROM transaction
+      WHERE _type = 'REFUND' AND status <> 'ERROR' AND belongs_to IS NOT NULL
+      GROUP BY belongs_to) r
+WHERE c.id = r.belongs_to AND c._type = 'CHARGE' AND c.status IN ('APPROVED', 'REFUNDED');
+
+COMMIT;
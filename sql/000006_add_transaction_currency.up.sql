@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN currency_code CHAR(3) NOT NULL DEFAULT 'USD';
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS posting;
+DROP TABLE IF EXISTS journal_entry;
+DROP TABLE IF EXISTS ledger_account;
+DROP TYPE IF EXISTS ledger_account_type;
+
+COMMIT;
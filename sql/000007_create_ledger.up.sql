@@ -0,0 +1,75 @@
+BEGIN;
+
+-- Ledger account
+CREATE TYPE ledger_account_type AS ENUM ('MERCHANT_BALANCE', 'MERCHANT_HOLDS', 'CUSTOMER_FUNDS', 'CUSTOMER_HOLDS');
+
+CREATE TABLE ledger_account(
+                               id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                               created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                               merchant_id BIGINT NOT NULL,
+                               _type ledger_account_type NOT NULL,
+                               currency_code CHAR(3) NOT NULL
+);
+ALTER TABLE ledger_account ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX ledger_account_merchant_id_type_currency_unique ON ledger_account USING btree(merchant_id, _type, currency_code);
+
+ALTER TABLE ledger_account ADD CONSTRAINT ledger_account_merchant_id_foreign FOREIGN KEY(merchant_id) REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+-- Journal entry
+CREATE TABLE journal_entry(
+                              id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                              created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                              merchant_id BIGINT NOT NULL,
+                              transaction_id BIGINT NULL,
+                              description VARCHAR(255) NOT NULL
+);
+ALTER TABLE journal_entry ADD PRIMARY KEY(id);
+CREATE INDEX journal_entry_transaction_id_index ON journal_entry USING btree(transaction_id);
+
+ALTER TABLE journal_entry ADD CONSTRAINT journal_entry_merchant_id_foreign FOREIGN KEY(merchant_id) REFERENCES merchant(user_id) ON DELETE CASCADE;
+ALTER TABLE journal_entry ADD CONSTRAINT journal_entry_transaction_id_foreign FOREIGN KEY(transaction_id) REFERENCES transaction(id) ON DELETE SET NULL;
+
+-- Posting
+CREATE TABLE posting(
+                        id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                        journal_entry_id BIGINT NOT NULL,
+                        account_id BIGINT NOT NULL,
+                        amount BIGINT NOT NULL
+);
+ALTER TABLE posting ADD PRIMARY KEY(id);
+CREATE INDEX posting_account_id_created_at_index ON posting USING btree(account_id, created_at);
+
+ALTER TABLE posting ADD CONSTRAINT posting_journal_entry_id_foreign FOREIGN KEY(journal_entry_id) REFERENCES journal_entry(id) ON DELETE CASCADE;
+ALTER TABLE posting ADD CONSTRAINT posting_account_id_foreign FOREIGN KEY(account_id) REFERENCES ledger_account(id) ON DELETE CASCADE;
+
+-- Backfill of existing transactions
+INSERT INTO ledger_account(created_at, merchant_id, _type, currency_code)
+SELECT now(), m.merchant_id, a._type::ledger_account_type, m.currency_code
+FROM (SELECT DISTINCT merchant_id, currency_code FROM transaction) m
+CROSS JOIN (VALUES ('MERCHANT_BALANCE'), ('MERCHANT_HOLDS'), ('CUSTOMER_FUNDS'), ('CUSTOMER_HOLDS')) a(_type);
+
+CREATE TEMPORARY TABLE ledger_backfill ON COMMIT DROP AS
+SELECT id AS transaction_id, merchant_id, currency_code, created_at,
+       CASE _type WHEN 'AUTHORIZE' THEN 'MERCHANT_HOLDS' ELSE 'MERCHANT_BALANCE' END AS debit_type,
+       CASE _type WHEN 'AUTHORIZE' THEN 'CUSTOMER_HOLDS' ELSE 'CUSTOMER_FUNDS' END AS credit_type,
+       CASE _type WHEN 'AUTHORIZE' THEN amount - captured_amount WHEN 'REFUND' THEN -amount ELSE amount END AS amount
+FROM transaction
+WHERE (_type = 'AUTHORIZE' AND status IN ('APPROVED', 'PARTIALLY_CAPTURED'))
+   OR (_type = 'CHARGE' AND status IN ('APPROVED', 'PARTIALLY_REFUNDED', 'REFUNDED'))
+   OR (_type = 'REFUND' AND status <> 'ERROR');
+
+INSERT INTO journal_entry(created_at, merchant_id, transaction_id, description)
+SELECT created_at, merchant_id, transaction_id, 'ledger backfill'
+FROM ledger_backfill;
+
+INSERT INTO posting(created_at, journal_entry_id, account_id, amount)
+SELECT b.created_at, j.id, a.id, CASE WHEN a._type::text = b.debit_type THEN b.amount ELSE -b.amount END
+FROM ledger_backfill b
+JOIN journal_entry j ON j.transaction_id = b.transaction_id
+JOIN ledger_account a ON a.merchant_id = b.merchant_id AND a.currency_code = b.currency_code AND a._type::text IN (b.debit_type, b.credit_type);
+
+COMMIT;
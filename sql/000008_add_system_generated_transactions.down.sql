@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transaction_type_status_created_at_index;
+ALTER TABLE transaction DROP COLUMN IF EXISTS system_generated;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN system_generated BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX transaction_type_status_created_at_index ON transaction USING btree(_type, status, created_at);
+
+COMMIT;
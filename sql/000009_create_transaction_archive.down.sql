@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transaction_belongs_to_index;
+DROP TABLE IF EXISTS transaction_archive;
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TABLE transaction_archive(
+                            id BIGINT NOT NULL,
+                            created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                            updated_at TIMESTAMP WITH TIME ZONE NULL,
+                            archived_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                            ext_uuid UUID NOT NULL,
+                            merchant_id BIGINT NOT NULL,
+                            belongs_to BIGINT NULL,
+
+                            customer_email VARCHAR(255) NOT NULL,
+                            customer_phone VARCHAR(255) NOT NULL,
+                            amount BIGINT NOT NULL,
+                            currency_code CHAR(3) NOT NULL,
+                            captured_amount BIGINT NOT NULL,
+                            refunded_amount BIGINT NOT NULL,
+                            system_generated BOOLEAN NOT NULL,
+
+                            status transaction_status NOT NULL,
+                            _type transaction_type NOT NULL
+);
+ALTER TABLE transaction_archive ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX transaction_archive_ext_uuid_unique ON transaction_archive USING btree(ext_uuid);
+CREATE INDEX transaction_archive_merchant_id_index ON transaction_archive USING btree(merchant_id);
+CREATE INDEX transaction_belongs_to_index ON transaction USING btree(belongs_to);
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+CREATE TABLE admin(
+                         user_id BIGINT NOT NULL,
+                         email VARCHAR(255) NOT NULL
+);
+
+ALTER TABLE admin ADD PRIMARY KEY(user_id);
+CREATE UNIQUE INDEX admin_email_unique ON admin USING btree(email);
+
+ALTER TABLE admin ADD CONSTRAINT admin_user_id_foreign FOREIGN KEY(user_id)
+    REFERENCES payment_system_user(id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+COMMIT;
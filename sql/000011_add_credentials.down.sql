@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS refresh_token;
+ALTER TABLE payment_system_user DROP COLUMN IF EXISTS password_hash;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+ALTER TABLE payment_system_user ADD COLUMN password_hash VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE refresh_token(
+                              id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                              created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                              user_id BIGINT NOT NULL,
+                              token_hash CHAR(64) NOT NULL,
+                              expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                              revoked_at TIMESTAMP WITH TIME ZONE NULL
+);
+ALTER TABLE refresh_token ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX refresh_token_token_hash_unique ON refresh_token USING btree(token_hash);
+CREATE INDEX refresh_token_user_id_index ON refresh_token USING btree(user_id);
+
+ALTER TABLE refresh_token ADD CONSTRAINT refresh_token_user_id_foreign FOREIGN KEY(user_id)
+    REFERENCES payment_system_user(id) ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE api_key(
+                        id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                        merchant_id BIGINT NOT NULL,
+                        name VARCHAR(255) NOT NULL,
+                        prefix VARCHAR(16) NOT NULL,
+                        key_hash CHAR(64) NOT NULL,
+                        last_used_at TIMESTAMP WITH TIME ZONE NULL,
+                        expires_at TIMESTAMP WITH TIME ZONE NULL,
+                        revoked_at TIMESTAMP WITH TIME ZONE NULL
+);
+ALTER TABLE api_key ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX api_key_prefix_unique ON api_key USING btree(prefix);
+CREATE UNIQUE INDEX api_key_key_hash_unique ON api_key USING btree(key_hash);
+CREATE INDEX api_key_merchant_id_index ON api_key USING btree(merchant_id);
+
+ALTER TABLE api_key ADD CONSTRAINT api_key_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+COMMIT;
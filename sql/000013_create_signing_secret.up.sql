@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE TABLE signing_secret(
+                               merchant_id BIGINT NOT NULL,
+                               created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                               secret VARCHAR(255) NOT NULL
+);
+ALTER TABLE signing_secret ADD PRIMARY KEY(merchant_id);
+
+ALTER TABLE signing_secret ADD CONSTRAINT signing_secret_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+COMMIT;
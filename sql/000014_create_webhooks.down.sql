@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS webhook_delivery_attempt;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook_endpoint;
+DROP TABLE IF EXISTS outbox_event;
+
+COMMIT;
@@ -0,0 +1,69 @@
+BEGIN;
+
+CREATE TABLE outbox_event(
+                             id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                             created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                             ext_uuid UUID NOT NULL,
+                             merchant_id BIGINT NOT NULL,
+                             _type VARCHAR(64) NOT NULL,
+                             payload TEXT NOT NULL,
+                             dispatched_at TIMESTAMP WITH TIME ZONE NULL
+);
+ALTER TABLE outbox_event ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX outbox_event_ext_uuid_unique ON outbox_event USING btree(ext_uuid);
+CREATE INDEX outbox_event_undispatched_index ON outbox_event USING btree(id) WHERE dispatched_at IS NULL;
+
+ALTER TABLE outbox_event ADD CONSTRAINT outbox_event_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+CREATE TABLE webhook_endpoint(
+                                 id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                 created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                                 merchant_id BIGINT NOT NULL,
+                                 url VARCHAR(2048) NOT NULL,
+                                 secret VARCHAR(255) NOT NULL
+);
+ALTER TABLE webhook_endpoint ADD PRIMARY KEY(id);
+CREATE INDEX webhook_endpoint_merchant_id_index ON webhook_endpoint USING btree(merchant_id);
+
+ALTER TABLE webhook_endpoint ADD CONSTRAINT webhook_endpoint_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+CREATE TABLE webhook_delivery(
+                                 id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                 created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                                 event_id BIGINT NOT NULL,
+                                 endpoint_id BIGINT NOT NULL,
+                                 status VARCHAR(16) NOT NULL,
+                                 attempts INT NOT NULL DEFAULT 0,
+                                 next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                 delivered_at TIMESTAMP WITH TIME ZONE NULL
+);
+ALTER TABLE webhook_delivery ADD PRIMARY KEY(id);
+CREATE INDEX webhook_delivery_event_id_index ON webhook_delivery USING btree(event_id);
+CREATE INDEX webhook_delivery_endpoint_id_index ON webhook_delivery USING btree(endpoint_id);
+CREATE INDEX webhook_delivery_due_index ON webhook_delivery USING btree(next_attempt_at) WHERE status = 'PENDING';
+
+ALTER TABLE webhook_delivery ADD CONSTRAINT webhook_delivery_event_id_foreign FOREIGN KEY(event_id)
+    REFERENCES outbox_event(id) ON DELETE CASCADE;
+ALTER TABLE webhook_delivery ADD CONSTRAINT webhook_delivery_endpoint_id_foreign FOREIGN KEY(endpoint_id)
+    REFERENCES webhook_endpoint(id) ON DELETE CASCADE;
+
+CREATE TABLE webhook_delivery_attempt(
+                                         id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                         created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                                         delivery_id BIGINT NOT NULL,
+                                         response_status INT NOT NULL DEFAULT 0,
+                                         error TEXT NOT NULL DEFAULT ''
+);
+ALTER TABLE webhook_delivery_attempt ADD PRIMARY KEY(id);
+CREATE INDEX webhook_delivery_attempt_delivery_id_index ON webhook_delivery_attempt USING btree(delivery_id);
+
+ALTER TABLE webhook_delivery_attempt ADD CONSTRAINT webhook_delivery_attempt_delivery_id_foreign FOREIGN KEY(delivery_id)
+    REFERENCES webhook_delivery(id) ON DELETE CASCADE;
+
+COMMIT;
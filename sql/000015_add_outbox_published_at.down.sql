@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS outbox_event_unpublished_index;
+ALTER TABLE outbox_event DROP COLUMN IF EXISTS published_at;
+
+COMMIT;
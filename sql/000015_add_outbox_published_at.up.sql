@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE outbox_event ADD COLUMN published_at TIMESTAMP WITH TIME ZONE NULL;
+CREATE INDEX outbox_event_unpublished_index ON outbox_event USING btree(id) WHERE published_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+DROP TABLE IF EXISTS dispute_evidence;
+DROP TRIGGER IF EXISTS transaction_archive_delete_dispute ON transaction_archive;
+DROP TRIGGER IF EXISTS transaction_delete_dispute ON transaction;
+DROP TABLE IF EXISTS dispute;
+DROP FUNCTION IF EXISTS delete_dispute_transactions();
+DROP FUNCTION IF EXISTS check_dispute_transactions();
+DROP FUNCTION IF EXISTS transaction_exists(BIGINT);
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS disputed_amount;
+ALTER TABLE transaction DROP COLUMN IF EXISTS disputed_amount;
+
+COMMIT;
@@ -0,0 +1,99 @@
+BEGIN;
+
+ALTER TYPE transaction_type ADD VALUE 'CHARGEBACK';
+ALTER TYPE transaction_type ADD VALUE 'CHARGEBACK_REVERSAL';
+
+COMMIT;
+
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN disputed_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_archive ADD COLUMN disputed_amount BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE dispute(
+                        id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                        updated_at TIMESTAMP WITH TIME ZONE NULL,
+
+                        ext_uuid UUID NOT NULL,
+                        merchant_id BIGINT NOT NULL,
+                        transaction_id BIGINT NOT NULL,
+                        chargeback_id BIGINT NULL,
+                        chargeback_reversal_id BIGINT NULL,
+
+                        status VARCHAR(32) NOT NULL,
+                        reason VARCHAR(255) NOT NULL DEFAULT '',
+                        amount BIGINT NOT NULL,
+                        currency_code CHAR(3) NOT NULL,
+                        evidence_due_by TIMESTAMP WITH TIME ZONE NOT NULL,
+                        evidence_submitted_at TIMESTAMP WITH TIME ZONE NULL,
+                        resolved_at TIMESTAMP WITH TIME ZONE NULL
+);
+ALTER TABLE dispute ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX dispute_ext_uuid_unique ON dispute USING btree(ext_uuid);
+CREATE INDEX dispute_merchant_id_index ON dispute USING btree(merchant_id);
+CREATE INDEX dispute_transaction_id_index ON dispute USING btree(transaction_id);
+CREATE INDEX dispute_opened_evidence_due_by_index ON dispute USING btree(evidence_due_by) WHERE status = 'OPENED';
+
+ALTER TABLE dispute ADD CONSTRAINT dispute_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+-- Archived transactions keep their IDs, so that the records of a transaction, e.g. resolved disputes, are kept
+-- when it is archived. Since such records reference either table, their integrity is enforced by triggers instead
+-- of foreign keys: the referenced transactions have to exist in one of the tables and deleting a transaction
+-- from both of them deletes the records like ON DELETE CASCADE.
+CREATE FUNCTION transaction_exists(transaction_id BIGINT) RETURNS BOOLEAN AS $$
+    SELECT EXISTS(SELECT 1 FROM transaction WHERE id = transaction_id)
+        OR EXISTS(SELECT 1 FROM transaction_archive WHERE id = transaction_id)
+$$ LANGUAGE SQL STABLE;
+
+CREATE FUNCTION check_dispute_transactions() RETURNS TRIGGER AS $$
+BEGIN
+    IF NOT transaction_exists(NEW.transaction_id)
+        OR (NEW.chargeback_id IS NOT NULL AND NOT transaction_exists(NEW.chargeback_id))
+        OR (NEW.chargeback_reversal_id IS NOT NULL AND NOT transaction_exists(NEW.chargeback_reversal_id)) THEN
+        RAISE foreign_key_violation USING
+            MESSAGE = format('dispute %s references a transaction which does not exist', NEW.id),
+            CONSTRAINT = 'dispute_transaction_id_foreign';
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION delete_dispute_transactions() RETURNS TRIGGER AS $$
+BEGIN
+    -- transactions are archived by inserting them into the archive before deleting them
+    IF NOT transaction_exists(OLD.id) THEN
+        DELETE FROM dispute WHERE transaction_id = OLD.id;
+        UPDATE dispute SET chargeback_id = NULL WHERE chargeback_id = OLD.id;
+        UPDATE dispute SET chargeback_reversal_id = NULL WHERE chargeback_reversal_id = OLD.id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER dispute_transaction_id_foreign AFTER INSERT OR UPDATE ON dispute
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION check_dispute_transactions();
+CREATE TRIGGER transaction_delete_dispute AFTER DELETE ON transaction
+    FOR EACH ROW EXECUTE FUNCTION delete_dispute_transactions();
+CREATE TRIGGER transaction_archive_delete_dispute AFTER DELETE ON transaction_archive
+    FOR EACH ROW EXECUTE FUNCTION delete_dispute_transactions();
+CREATE INDEX dispute_chargeback_id_index ON dispute USING btree(chargeback_id);
+CREATE INDEX dispute_chargeback_reversal_id_index ON dispute USING btree(chargeback_reversal_id);
+
+CREATE TABLE dispute_evidence(
+                                 id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                 created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                                 dispute_id BIGINT NOT NULL,
+                                 file_name VARCHAR(255) NOT NULL,
+                                 content_type VARCHAR(255) NOT NULL,
+                                 size BIGINT NOT NULL,
+                                 description TEXT NOT NULL DEFAULT ''
+);
+ALTER TABLE dispute_evidence ADD PRIMARY KEY(id);
+CREATE INDEX dispute_evidence_dispute_id_index ON dispute_evidence USING btree(dispute_id);
+
+ALTER TABLE dispute_evidence ADD CONSTRAINT dispute_evidence_dispute_id_foreign FOREIGN KEY(dispute_id)
+    REFERENCES dispute(id) ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS payout_batch_id;
+ALTER TABLE transaction DROP COLUMN IF EXISTS payout_batch_id;
+DROP TABLE IF EXISTS payout_batch;
+
+COMMIT;
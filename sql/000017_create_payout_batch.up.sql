@@ -0,0 +1,33 @@
+BEGIN;
+
+CREATE TABLE payout_batch(
+                             id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                             created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                             ext_uuid UUID NOT NULL,
+                             merchant_id BIGINT NOT NULL,
+                             currency_code CHAR(3) NOT NULL,
+
+                             gross_amount BIGINT NOT NULL,
+                             fee_amount BIGINT NOT NULL,
+                             net_amount BIGINT NOT NULL,
+                             transaction_count INTEGER NOT NULL
+);
+ALTER TABLE payout_batch ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX payout_batch_ext_uuid_unique ON payout_batch USING btree(ext_uuid);
+CREATE INDEX payout_batch_merchant_id_index ON payout_batch USING btree(merchant_id);
+
+ALTER TABLE payout_batch ADD CONSTRAINT payout_batch_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+ALTER TABLE transaction ADD COLUMN payout_batch_id BIGINT NULL;
+ALTER TABLE transaction ADD CONSTRAINT transaction_payout_batch_id_foreign FOREIGN KEY(payout_batch_id)
+    REFERENCES payout_batch(id) ON DELETE SET NULL;
+CREATE INDEX transaction_payout_batch_id_index ON transaction USING btree(payout_batch_id);
+CREATE INDEX transaction_unsettled_index ON transaction USING btree(merchant_id, currency_code) WHERE payout_batch_id IS NULL;
+
+-- archived transactions keep their batch, so that settlement reports stay complete
+ALTER TABLE transaction_archive ADD COLUMN payout_batch_id BIGINT NULL;
+CREATE INDEX transaction_archive_payout_batch_id_index ON transaction_archive USING btree(payout_batch_id);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS fee_plan_override;
+DROP TABLE IF EXISTS fee_plan;
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS fee_amount;
+ALTER TABLE transaction DROP COLUMN IF EXISTS fee_amount;
+
+COMMIT;
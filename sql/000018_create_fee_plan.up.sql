@@ -0,0 +1,46 @@
+BEGIN;
+
+ALTER TYPE ledger_account_type ADD VALUE 'MERCHANT_FEES';
+ALTER TYPE ledger_account_type ADD VALUE 'PLATFORM_REVENUE';
+
+COMMIT;
+
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN fee_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_archive ADD COLUMN fee_amount BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE fee_plan(
+                         id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                         created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                         updated_at TIMESTAMP WITH TIME ZONE NULL,
+
+                         merchant_id BIGINT NOT NULL,
+                         currency_code CHAR(3) NOT NULL,
+                         basis_points INTEGER NOT NULL DEFAULT 0,
+                         fixed_amount BIGINT NOT NULL DEFAULT 0,
+                         minimum_amount BIGINT NOT NULL DEFAULT 0,
+                         refund_policy VARCHAR(32) NOT NULL DEFAULT 'NONE'
+);
+ALTER TABLE fee_plan ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX fee_plan_merchant_id_unique ON fee_plan USING btree(merchant_id);
+
+ALTER TABLE fee_plan ADD CONSTRAINT fee_plan_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+CREATE TABLE fee_plan_override(
+                                  id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+
+                                  fee_plan_id BIGINT NOT NULL,
+                                  _type transaction_type NOT NULL,
+                                  basis_points INTEGER NOT NULL DEFAULT 0,
+                                  fixed_amount BIGINT NOT NULL DEFAULT 0,
+                                  minimum_amount BIGINT NOT NULL DEFAULT 0
+);
+ALTER TABLE fee_plan_override ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX fee_plan_override_fee_plan_id_type_unique ON fee_plan_override USING btree(fee_plan_id, _type);
+
+ALTER TABLE fee_plan_override ADD CONSTRAINT fee_plan_override_fee_plan_id_foreign FOREIGN KEY(fee_plan_id)
+    REFERENCES fee_plan(id) ON DELETE CASCADE;
+
+COMMIT;
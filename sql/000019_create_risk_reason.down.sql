@@ -0,0 +1,15 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transaction_merchant_id_customer_phone_index;
+DROP INDEX IF EXISTS transaction_merchant_id_customer_email_index;
+DROP TRIGGER IF EXISTS transaction_archive_delete_risk_reason ON transaction_archive;
+DROP TRIGGER IF EXISTS transaction_delete_risk_reason ON transaction;
+DROP TABLE IF EXISTS risk_reason;
+DROP FUNCTION IF EXISTS delete_risk_reason_transaction();
+DROP FUNCTION IF EXISTS check_risk_reason_transaction();
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS risk_rule_id;
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS risk_decision;
+ALTER TABLE transaction DROP COLUMN IF EXISTS risk_rule_id;
+ALTER TABLE transaction DROP COLUMN IF EXISTS risk_decision;
+
+COMMIT;
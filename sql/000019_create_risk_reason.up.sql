@@ -0,0 +1,52 @@
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN risk_decision VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE transaction ADD COLUMN risk_rule_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE transaction_archive ADD COLUMN risk_decision VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE transaction_archive ADD COLUMN risk_rule_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE risk_reason(
+                            id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                            created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+                            transaction_id BIGINT NOT NULL,
+                            rule_id VARCHAR(64) NOT NULL,
+                            decision VARCHAR(16) NOT NULL,
+                            reason TEXT NOT NULL DEFAULT ''
+);
+ALTER TABLE risk_reason ADD PRIMARY KEY(id);
+CREATE INDEX risk_reason_transaction_id_index ON risk_reason USING btree(transaction_id);
+
+-- risk reasons are kept when their transaction is archived, so like disputes they reference either table
+CREATE FUNCTION check_risk_reason_transaction() RETURNS TRIGGER AS $$
+BEGIN
+    IF NOT transaction_exists(NEW.transaction_id) THEN
+        RAISE foreign_key_violation USING
+            MESSAGE = format('risk reason %s references transaction %s which does not exist', NEW.id, NEW.transaction_id),
+            CONSTRAINT = 'risk_reason_transaction_id_foreign';
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION delete_risk_reason_transaction() RETURNS TRIGGER AS $$
+BEGIN
+    IF NOT transaction_exists(OLD.id) THEN
+        DELETE FROM risk_reason WHERE transaction_id = OLD.id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER risk_reason_transaction_id_foreign AFTER INSERT OR UPDATE ON risk_reason
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION check_risk_reason_transaction();
+CREATE TRIGGER transaction_delete_risk_reason AFTER DELETE ON transaction
+    FOR EACH ROW EXECUTE FUNCTION delete_risk_reason_transaction();
+CREATE TRIGGER transaction_archive_delete_risk_reason AFTER DELETE ON transaction_archive
+    FOR EACH ROW EXECUTE FUNCTION delete_risk_reason_transaction();
+
+-- velocity rules count the recent transactions of a customer
+CREATE INDEX transaction_merchant_id_customer_email_index ON transaction USING btree(merchant_id, customer_email, created_at);
+CREATE INDEX transaction_merchant_id_customer_phone_index ON transaction USING btree(merchant_id, customer_phone, created_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transaction_pending_review_index;
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE transaction DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE transaction DROP COLUMN IF EXISTS reviewed_at;
+
+COMMIT;
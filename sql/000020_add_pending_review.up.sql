@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TYPE transaction_status ADD VALUE 'PENDING_REVIEW';
+
+COMMIT;
+
+BEGIN;
+
+ALTER TABLE transaction ADD COLUMN reviewed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE transaction ADD COLUMN reviewed_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE transaction_archive ADD COLUMN reviewed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE transaction_archive ADD COLUMN reviewed_by VARCHAR(255) NOT NULL DEFAULT '';
+
+-- the review queue lists held transactions from the oldest
+CREATE INDEX transaction_pending_review_index ON transaction USING btree(created_at) WHERE status = 'PENDING_REVIEW';
+
+COMMIT;
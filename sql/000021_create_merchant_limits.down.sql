@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transaction_merchant_id_created_at_index;
+DROP TABLE IF EXISTS merchant_limits;
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+CREATE TABLE merchant_limits(
+                                id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                                created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                updated_at TIMESTAMP WITH TIME ZONE NULL,
+
+                                merchant_id BIGINT NOT NULL,
+                                currency_code CHAR(3) NOT NULL,
+                                max_amount BIGINT NOT NULL DEFAULT 0,
+                                daily_volume BIGINT NOT NULL DEFAULT 0,
+                                monthly_volume BIGINT NOT NULL DEFAULT 0,
+                                daily_count INTEGER NOT NULL DEFAULT 0,
+                                max_refund_basis_points INTEGER NOT NULL DEFAULT 0
+);
+ALTER TABLE merchant_limits ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX merchant_limits_merchant_id_unique ON merchant_limits USING btree(merchant_id);
+
+ALTER TABLE merchant_limits ADD CONSTRAINT merchant_limits_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+-- limits sum the recent transactions of a merchant
+CREATE INDEX transaction_merchant_id_created_at_index ON transaction USING btree(merchant_id, created_at);
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+UPDATE transaction t SET customer_email = o.customer_email, customer_phone = o.customer_phone
+FROM transaction_contact_original o WHERE o.transaction_id = t.id;
+UPDATE transaction_archive t SET customer_email = o.customer_email, customer_phone = o.customer_phone
+FROM transaction_contact_original o WHERE o.transaction_id = t.id;
+DROP TABLE IF EXISTS transaction_contact_original;
+
+ALTER TABLE transaction DROP CONSTRAINT IF EXISTS transaction_customer_id_foreign;
+DROP INDEX IF EXISTS transaction_archive_customer_id_index;
+DROP INDEX IF EXISTS transaction_customer_id_index;
+ALTER TABLE transaction_archive DROP COLUMN IF EXISTS customer_id;
+ALTER TABLE transaction DROP COLUMN IF EXISTS customer_id;
+DROP TABLE IF EXISTS customer;
+
+COMMIT;
@@ -0,0 +1,80 @@
+BEGIN;
+
+CREATE TABLE customer(
+                         id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+                         created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                         updated_at TIMESTAMP WITH TIME ZONE NULL,
+
+                         ext_uuid UUID NOT NULL,
+                         merchant_id BIGINT NOT NULL,
+                         email VARCHAR(255) NOT NULL,
+                         phone VARCHAR(255) NOT NULL DEFAULT ''
+);
+ALTER TABLE customer ADD PRIMARY KEY(id);
+CREATE UNIQUE INDEX customer_ext_uuid_unique ON customer USING btree(ext_uuid);
+CREATE UNIQUE INDEX customer_merchant_id_email_unique ON customer USING btree(merchant_id, email);
+
+ALTER TABLE customer ADD CONSTRAINT customer_merchant_id_foreign FOREIGN KEY(merchant_id)
+    REFERENCES merchant(user_id) ON DELETE CASCADE;
+
+ALTER TABLE transaction ADD COLUMN customer_id BIGINT NULL;
+ALTER TABLE transaction_archive ADD COLUMN customer_id BIGINT NULL;
+CREATE INDEX transaction_customer_id_index ON transaction USING btree(customer_id);
+CREATE INDEX transaction_archive_customer_id_index ON transaction_archive USING btree(customer_id);
+
+ALTER TABLE transaction ADD CONSTRAINT transaction_customer_id_foreign FOREIGN KEY(customer_id)
+    REFERENCES customer(id) ON DELETE SET NULL;
+
+-- normalizes phones to E.164 like models.NormalizePhone, numbers in national format are in the default country code.
+-- Phones which models.NormalizePhone rejects are normalized to ''.
+CREATE OR REPLACE FUNCTION pg_temp.normalize_phone(phone TEXT) RETURNS TEXT AS $$
+    SELECT CASE WHEN n ~ '^[1-9][0-9]{6,14}$' THEN '+' || n ELSE '' END
+    FROM (
+        SELECT CASE
+                   WHEN digits LIKE '+%' THEN substr(digits, 2)
+                   WHEN digits LIKE '00%' THEN substr(digits, 3)
+                   WHEN digits LIKE '0%' THEN '359' || substr(digits, 2)
+                   ELSE digits
+               END AS n
+        FROM (SELECT regexp_replace(phone, '[ ()./-]', '', 'g') AS digits) d
+    ) n
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- emails and phones of existing transactions are normalized like the ones of new transactions, so that customers
+-- are matched by the same values regardless of how they were sent. The original values are kept for the down migration.
+CREATE TABLE transaction_contact_original(
+                         transaction_id BIGINT NOT NULL,
+                         customer_email VARCHAR(255) NOT NULL,
+                         customer_phone VARCHAR(255) NOT NULL
+);
+ALTER TABLE transaction_contact_original ADD PRIMARY KEY(transaction_id);
+
+INSERT INTO transaction_contact_original(transaction_id, customer_email, customer_phone)
+SELECT id, customer_email, customer_phone FROM transaction
+WHERE customer_email <> LOWER(customer_email) OR customer_phone <> pg_temp.normalize_phone(customer_phone)
+UNION ALL
+SELECT id, customer_email, customer_phone FROM transaction_archive
+WHERE customer_email <> LOWER(customer_email) OR customer_phone <> pg_temp.normalize_phone(customer_phone);
+
+UPDATE transaction t SET customer_email = LOWER(o.customer_email), customer_phone = pg_temp.normalize_phone(o.customer_phone)
+FROM transaction_contact_original o WHERE o.transaction_id = t.id;
+UPDATE transaction_archive t SET customer_email = LOWER(o.customer_email), customer_phone = pg_temp.normalize_phone(o.customer_phone)
+FROM transaction_contact_original o WHERE o.transaction_id = t.id;
+
+-- a customer per merchant and email, with the latest phone of its transactions
+INSERT INTO customer(created_at, updated_at, ext_uuid, merchant_id, email, phone)
+SELECT MIN(created_at), MAX(created_at), gen_random_uuid(), merchant_id, customer_email,
+       COALESCE((array_agg(customer_phone ORDER BY created_at DESC) FILTER (WHERE customer_phone <> ''))[1], '')
+FROM (
+    SELECT merchant_id, customer_email, customer_phone, created_at FROM transaction
+    UNION ALL
+    SELECT merchant_id, customer_email, customer_phone, created_at FROM transaction_archive
+) t
+GROUP BY merchant_id, customer_email;
+
+UPDATE transaction t SET customer_id = c.id FROM customer c
+WHERE c.merchant_id = t.merchant_id AND c.email = t.customer_email;
+UPDATE transaction_archive t SET customer_id = c.id FROM customer c
+WHERE c.merchant_id = t.merchant_id AND c.email = t.customer_email;
+
+COMMIT;